@@ -0,0 +1,370 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/common"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/hack"
+	"jackcompiler/pkg/vm"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildMain handles `jackcompiler build`, compiling programs to .vm or .asm files and returning the exit code
+// 0 means every file compiled, 1 means at least one didn't, and 2 means a usage error
+func buildMain(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	var exclude patternList
+	flags.Var(&exclude, "exclude", "skip files and directories matching these patterns")
+	outDir := flags.String("outdir", "", "write the .vm files into this directory, mirroring the inputs, instead of next to them")
+	target := flags.String("target", "vm", "what to compile to: vm for a .vm file per class, or asm for a single .asm file per program, including the OS")
+	var notes annotations
+	flags.BoolVar(&notes.sourceMap, "sourcemap", false, "write a JSON source map linking every command or instruction back to its Jack file, line, column, and subroutine next to each output, named after it with .map added")
+	flags.BoolVar(&notes.lineComments, "line-comments", false, "put a comment such as // Board.jack:57 before the code generated from each line")
+	watchInputs := flags.Bool("watch", false, "keep running, recompiling the classes that change along with the classes that refer to them")
+	interval := flags.Duration("interval", 500*time.Millisecond, "how often -watch checks for changes")
+	link := wholeProgramFlags(flags, "Main.main")
+	var opts compiler.Options
+	optimizeFlags(flags, &opts)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jackcompiler build [-target vm|asm] [-O1] [-print-opt-stats] [-inline n] [-strip] [-sourcemap] [-line-comments] [-exclude pattern] [-outdir dir] [-watch] <inputPath>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *target != "vm" && *target != "asm" {
+		fmt.Fprintf(os.Stderr, "jackcompiler build: unknown target %q\n", *target)
+		return 2
+	}
+	// Native code always leaves out what Sys.init can't reach, and has no VM code to inline
+	if *target == "asm" && (link.inline > 0 || link.strip) {
+		fmt.Fprintln(os.Stderr, "jackcompiler build: -inline and -strip only apply to -target vm")
+		return 2
+	}
+	if *watchInputs {
+		// A .asm file holds the whole program, so there is nothing to rebuild a class at a time
+		if *target == "asm" {
+			fmt.Fprintln(os.Stderr, "jackcompiler build: -watch only applies to -target vm")
+			return 2
+		}
+		if opts.Stats != nil {
+			fmt.Fprintln(os.Stderr, "jackcompiler build: -print-opt-stats can't be used with -watch")
+			return 2
+		}
+		buildWatch(flags.Args(), exclude, *interval, *outDir, opts, link, notes)
+	}
+
+	programs, err := analyzer.FindPrograms(flags.Args(), exclude)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	failed := false
+	for _, program := range programs {
+		ok := false
+		if *target == "asm" {
+			ok = buildAsm(program, *outDir, opts, notes)
+		} else {
+			ok = buildProgram(program, *outDir, opts, link, notes)
+		}
+		if !ok {
+			failed = true
+		}
+	}
+	printOptStats(opts)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// buildProgram compiles every file of a program and writes out the ones that compiled, printing any errors
+// Whole program optimizations need every file to compile
+func buildProgram(program analyzer.Program, outDir string, opts compiler.Options, link *wholeProgram, notes annotations) bool {
+	ok := true
+	var files []*vm.File
+	var sources []string
+	for _, file := range program.Files {
+		compiled, err := compiler.CompileFileWith(file, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+			continue
+		}
+		files = append(files, compiled)
+		sources = append(sources, file)
+	}
+	return writeProgram(program, outDir, sources, files, ok, link, notes) && ok
+}
+
+// writeProgram writes out the compiled files of a program, sources holds the .jack file each came from
+// The whole program optimizations only run when the program is complete, since they need every file
+func writeProgram(program analyzer.Program, outDir string, sources []string, files []*vm.File, complete bool, link *wholeProgram, notes annotations) bool {
+	if complete {
+		files = link.apply(program.Path, files, "Sys.init", "Main.main")
+	}
+	ok := true
+	for i, file := range files {
+		output, err := vmOutput(program, sources[i], outDir)
+		if err == nil {
+			err = common.WriteFileAtomic(output, func(w io.Writer) error {
+				if notes.lineComments {
+					return vm.WriteAnnotated(w, file.Commands)
+				}
+				return vm.Write(w, file.Commands)
+			})
+		}
+		if err == nil && notes.sourceMap {
+			err = writeSourceMap(output, vm.CommandUnit, vm.Positions(file.Commands))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// vmOutput returns where the .vm file for a .jack file of a program goes
+func vmOutput(program analyzer.Program, source string, outDir string) (string, error) {
+	output := strings.TrimSuffix(source, ".jack") + ".vm"
+	if outDir == "" {
+		return output, nil
+	}
+	rel, err := filepath.Rel(program.Root, output)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(outDir, rel), nil
+}
+
+// annotations holds the flags for what is written along with the generated code
+type annotations struct {
+	sourceMap    bool
+	lineComments bool
+}
+
+// writeSourceMap writes the source map for output next to it, positions holds where each command or
+// instruction in it came from
+func writeSourceMap(output string, unit string, positions []*vm.Position) error {
+	m := vm.NewSourceMap(filepath.Base(output), unit, positions)
+	return common.WriteFileAtomic(output+".map", m.Write)
+}
+
+// buildAsm compiles a program and the OS straight to Hack assembly, writing it to a .asm file named after
+// the program, then compares its size with the same program translated from VM code
+func buildAsm(program analyzer.Program, outDir string, opts compiler.Options, notes annotations) bool {
+	asm, positions, err := compiler.CompileProgramAsm(program.Path, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	// A directory's program goes inside it, named after it
+	output := strings.TrimSuffix(program.Path, ".jack") + ".asm"
+	if info, err := os.Stat(program.Path); err == nil && info.IsDir() {
+		output = filepath.Join(program.Path, filepath.Base(filepath.Clean(program.Path))+".asm")
+	}
+	if outDir != "" {
+		rel, err := filepath.Rel(program.Root, output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+		output = filepath.Join(outDir, rel)
+	}
+	lines := asm
+	if notes.lineComments {
+		lines = vm.AnnotateAsm(asm, positions)
+	}
+	err = common.WriteFileAtomic(output, func(w io.Writer) error {
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && notes.sourceMap {
+		err = writeSourceMap(output, vm.InstructionUnit, vm.InstructionPositions(asm, positions))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	// The VM code is stripped as well, so the two are compared on the same subroutines
+	// The statistics are only about the code that was written out
+	vmOpts := opts
+	vmOpts.Stats = nil
+	files, err := compiler.CompileProgramWith(program.Path, vmOpts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	files, _ = vm.RemoveUnreachable(files, "Sys.init")
+	native, err := romSize(output, asm)
+	if err == nil {
+		var translated int
+		vmAsm, _ := vm.Translate(files)
+		translated, err = romSize(output, vmAsm)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "%s: %d instructions, %d through VM code (%.1f%% smaller)\n",
+				output, native, translated, 100*float64(translated-native)/float64(translated))
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	if native > hack.ROMSize {
+		fmt.Fprintf(os.Stderr, "%s: warning: %d instructions don't fit in the %d words of ROM\n", output, native, hack.ROMSize)
+	}
+	return true
+}
+
+// romSize assembles a program to find out how many instructions it takes
+func romSize(name string, asm []string) (int, error) {
+	program, err := hack.Assemble(name, strings.NewReader(strings.Join(asm, "\n")))
+	return len(program), err
+}
+
+// wholeProgram holds the flags for the optimizations that work on a whole program at once
+type wholeProgram struct {
+	inline int
+	strip  bool
+}
+
+// wholeProgramFlags adds -inline and -strip to flags, root is where the program starts
+func wholeProgramFlags(flags *flag.FlagSet, root string) *wholeProgram {
+	w := &wholeProgram{}
+	flags.IntVar(&w.inline, "inline", 0, "replace calls to subroutines of at most this many commands that call nothing themselves with their bodies, listing them, 0 to never inline")
+	flags.BoolVar(&w.strip, "strip", false, "leave out the subroutines that can't be reached from "+root+", listing them")
+	return w
+}
+
+// active checks whether any whole program optimization was asked for, which makes every file depend on the rest
+func (w *wholeProgram) active() bool {
+	return w.inline > 0 || w.strip
+}
+
+// apply runs the whole program optimizations that were asked for over files, roots are where the program starts
+// Inlining goes first, so subroutines that are no longer called can be stripped
+func (w *wholeProgram) apply(program string, files []*vm.File, roots ...string) []*vm.File {
+	if w.inline > 0 {
+		var inlined []vm.Inlined
+		files, inlined = vm.Inline(files, w.inline)
+		printInlined(program, inlined)
+	}
+	if w.strip {
+		var removed []vm.Removed
+		files, removed = vm.RemoveUnreachable(files, roots...)
+		printRemoved(program, removed)
+	}
+	return files
+}
+
+// printInlined reports the calls -inline replaced
+func printInlined(program string, inlined []vm.Inlined) {
+	sites := 0
+	for _, call := range inlined {
+		sites += call.Sites
+	}
+	fmt.Fprintf(os.Stderr, "%s: inlined %d calls\n", program, sites)
+	for _, call := range inlined {
+		fmt.Fprintf(os.Stderr, "  %s calling %s (%d sites)\n", call.Caller, call.Callee, call.Sites)
+	}
+}
+
+// printRemoved reports the subroutines -strip removed from a program
+func printRemoved(program string, removed []vm.Removed) {
+	commands := 0
+	for _, function := range removed {
+		commands += function.Commands
+	}
+	fmt.Fprintf(os.Stderr, "%s: removed %d unreachable subroutines, %d commands\n", program, len(removed), commands)
+	for _, function := range removed {
+		fmt.Fprintf(os.Stderr, "  %s (%d commands)\n", function.Name, function.Commands)
+	}
+}
+
+// optimizeFlags adds -O0 and -O1 to flags, which set the optimization level in opts,
+// and -print-opt-stats, which has opts collect what the peephole optimizer does
+func optimizeFlags(flags *flag.FlagSet, opts *compiler.Options) {
+	flags.Var(levelFlag{&opts.Optimize, 0}, "O0", "generate the same code as the reference compiler (the default)")
+	flags.Var(levelFlag{&opts.Optimize, 1}, "O1", "fold constant expressions, simplify arithmetic, and run the peephole optimizer over the generated code")
+	flags.Var(statsFlag{&opts.Stats}, "print-opt-stats", "print how often each peephole optimization was applied")
+}
+
+// printOptStats prints the statistics collected for -print-opt-stats, if it was given
+func printOptStats(opts compiler.Options) {
+	if opts.Stats == nil {
+		return
+	}
+	if opts.Optimize == 0 {
+		fmt.Fprintln(os.Stderr, "peephole optimizer not run, use -O1")
+		return
+	}
+	opts.Stats.Write(os.Stderr)
+}
+
+// levelFlag is a boolean flag that sets an optimization level when given
+type levelFlag struct {
+	level *int
+	value int
+}
+
+func (l levelFlag) String() string {
+	// The flag package calls String on a zero value to find the default
+	return "false"
+}
+
+func (l levelFlag) Set(value string) error {
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if set {
+		*l.level = l.value
+	}
+	return nil
+}
+
+func (l levelFlag) IsBoolFlag() bool {
+	return true
+}
+
+// statsFlag is a boolean flag that starts collecting peephole optimizer statistics when given
+type statsFlag struct {
+	stats **vm.OptStats
+}
+
+func (s statsFlag) String() string {
+	return "false"
+}
+
+func (s statsFlag) Set(value string) error {
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*s.stats = nil
+	if set {
+		*s.stats = &vm.OptStats{}
+	}
+	return nil
+}
+
+func (s statsFlag) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jackcompiler/pkg/xmldiff"
+	"os"
+	"strings"
+)
+
+// compareMain handles `jackcompiler compare`, returning the exit code
+// 0 means the files match, 1 means they differ, and 2 means they couldn't be compared
+func compareMain(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	context := flags.Int("context", 3, "lines of each file to show around the difference")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jackcompiler compare [-context n] <out.xml> <expected.xml>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	gotPath, wantPath := flags.Arg(0), flags.Arg(1)
+
+	got, err := xmldiff.ParseFile(gotPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	want, err := xmldiff.ParseFile(wantPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diff := xmldiff.Compare(got, want)
+	if diff == nil {
+		fmt.Printf("%s matches %s\n", gotPath, wantPath)
+		return 0
+	}
+
+	fmt.Printf("%s differs from %s\n", gotPath, wantPath)
+	fmt.Printf("at %s\n", diff.Path)
+	fmt.Printf("%s\n", diff.Msg)
+	printContext(gotPath, diff.GotLine, *context)
+	printContext(wantPath, diff.WantLine, *context)
+	return 1
+}
+
+// printContext prints the lines of a file around line, marking line itself
+func printContext(path string, line int, context int) {
+	contents, err := os.ReadFile(path)
+	if err != nil || context < 0 {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+
+	fmt.Printf("\n%s:%d\n", path, line)
+	first, last := line-context, line+context
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	for i := first; i <= last; i++ {
+		marker := "  "
+		if i == line {
+			marker = "> "
+		}
+		fmt.Printf("%s%5d  %s\n", marker, i, strings.TrimRight(lines[i-1], "\r"))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/debugger"
+	"jackcompiler/pkg/jackos"
+	"jackcompiler/pkg/vm"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// debugMain handles `jackcompiler debug`, running a program under the debugger and returning the exit code
+// 0 means the session ended normally, 1 means the program couldn't be compiled, and 2 means a usage error
+func debugMain(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	var breaks patternList
+	flags.Var(&breaks, "break", "comma separated list of breakpoints to set before starting, such as Main.main or Board.jack:57")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jackcompiler debug [-break where] <inputPath>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	inputPath := flags.Arg(0)
+
+	symbols := &compiler.Symbols{}
+	files, err := compiler.CompileProgramWith(inputPath, compiler.Options{Symbols: symbols})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	d, err := debugger.New(files, symbols)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, where := range breaks {
+		if _, err := d.Break(where); err != nil {
+			fmt.Fprintf(os.Stderr, "jackcompiler debug: %v\n", err)
+			return 2
+		}
+	}
+
+	// Ctrl-C stops the program instead of the debugger
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			d.Interrupt()
+		}
+	}()
+
+	if err := debugger.Console(d, loadSources(inputPath, files), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// loadSources reads the lines of every class in a program, the OS included, keyed by file name
+// Classes are looked for next to the program first, and then in the OS
+func loadSources(inputPath string, files []*vm.File) map[string][]string {
+	dir := inputPath
+	if info, err := os.Stat(inputPath); err == nil && !info.IsDir() {
+		dir = filepath.Dir(inputPath)
+	}
+
+	sources := make(map[string][]string)
+	for _, file := range files {
+		name := file.Name + ".jack"
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			if contents, err = jackos.FS.ReadFile(name); err != nil {
+				continue
+			}
+		}
+		sources[name] = strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+	}
+	return sources
+}
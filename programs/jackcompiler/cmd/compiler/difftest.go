@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/difftest"
+	"jackcompiler/pkg/jackgen"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// difftestMain handles `jackcompiler difftest`, returning the exit code
+// 0 means every program behaved the same, 1 means at least one didn't, and 2 means the test couldn't be run
+func difftestMain(args []string) int {
+	flags := flag.NewFlagSet("difftest", flag.ExitOnError)
+	ref := flags.String("ref", "", "reference compiler command, run with a directory of .jack files as its last argument")
+	count := flags.Int("n", 100, "number of random programs to generate")
+	seed := flags.Int64("seed", 1, "seed of the first random program")
+	depth := flags.Int("depth", 4, "how deeply statements and expressions of random programs are nested")
+	steps := flags.Uint64("steps", 50000000, "number of VM commands each program may execute")
+	minimize := flags.Bool("minimize", true, "shrink random programs that behave differently before reporting them")
+	out := flags.String("out", "difftest-failures", "directory the reproducers are written to")
+	var opts compiler.Options
+	optimizeFlags(flags, &opts)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jackcompiler difftest [-O1] -ref command [-n count] [-seed n] [-out dir] [flags]\n       jackcompiler difftest -O1 [-n count] [-seed n] [-out dir] [flags]\n       jackcompiler difftest [-O1] [-steps n] <fixtureDir>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	got := difftest.JackWith(opts)
+	// Fixtures bring their own reference output
+	if flags.NArg() > 0 {
+		code := difftestFixtures(flags.Args(), got, *steps)
+		printOptStats(opts)
+		return code
+	}
+	// Optimized code can be checked against the unoptimized code without another compiler
+	if (*ref == "" && opts.Optimize == 0) || *count < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	reference := difftest.Jack
+	if *ref != "" {
+		reference = difftest.Command(strings.Fields(*ref))
+	}
+	failures := 0
+	for i := 0; i < *count; i++ {
+		n := *seed + int64(i)
+		gen := jackgen.New(n)
+		gen.MaxDepth = *depth
+		classes := gen.Program()
+		sources, err := difftest.Sources(classes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		diff := difftest.Check(sources, got, reference, *steps)
+		if diff == nil {
+			continue
+		}
+		failures++
+		fmt.Printf("seed %d: %s\n", n, diff.Msg)
+		if *minimize {
+			diff = difftest.Minimize(classes, diff, got, reference, *steps)
+			fmt.Printf("  minimized: %s\n", diff.Msg)
+		}
+		dir := filepath.Join(*out, "seed-"+strconv.FormatInt(n, 10))
+		if err := difftest.WriteSources(dir, diff.Sources); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Printf("  jackcompiler: %s\n  reference:    %s\n  reproducer written to %s\n", diff.Got, diff.Want, dir)
+	}
+
+	printOptStats(opts)
+	fmt.Printf("%d programs, %d behaved differently\n", *count, failures)
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// difftestFixtures compares the compiler against the reference .vm files stored next to the .jack files in dirs
+func difftestFixtures(dirs []string, got difftest.Compiler, steps uint64) int {
+	failures := 0
+	for _, dir := range dirs {
+		fixture, err := difftest.LoadFixture(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		diff := difftest.Check(fixture.Sources, got, fixture, steps)
+		if diff == nil {
+			fmt.Printf("ok   %s\n", dir)
+			continue
+		}
+		failures++
+		fmt.Printf("FAIL %s: %s\n  jackcompiler: %s\n  reference:    %s\n", dir, diff.Msg, diff.Got, diff.Want)
+	}
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
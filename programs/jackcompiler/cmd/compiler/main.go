@@ -5,30 +5,134 @@ import (
 	"fmt"
 	. "jackcompiler/pkg/analyzer"
 	"os"
+	"runtime"
+	"strings"
+	"time"
 )
 
+// patternList is a flag that can be given more than once, each value holding comma separated patterns
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	*p = append(*p, splitList(value)...)
+	return nil
+}
+
 func main() {
+	// Subcommands get their own flags
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		os.Exit(buildMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		os.Exit(compareMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "difftest" {
+		os.Exit(difftestMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reduce" {
+		os.Exit(reduceMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		os.Exit(debugMain(os.Args[2:]))
+	}
+
+	jobs := flag.Int("j", runtime.NumCPU(), "number of files to compile at the same time")
+	var exclude patternList
+	flag.Var(&exclude, "exclude", "skip files and directories matching these patterns")
+	output := flag.String("o", "", "write the output to this file, - for stdout")
+	outDir := flag.String("outdir", "", "write the output into this directory, mirroring the inputs")
+	formatName := flag.String("format", "xml", "output format: xml, json, sexpr, or dot")
+	function := flag.String("func", "", "only write out the subroutine named Class.sub")
+	useCache := flag.Bool("cache", true, "reuse the output of files that haven't changed since they were last compiled")
+	cleanCache := flag.Bool("clean-cache", false, "empty the build cache first")
+	verbose := flag.Bool("v", false, "print cache statistics")
+	watchInputs := flag.Bool("watch", false, "keep running, recompiling files as they change, each file on its own since xml doesn't depend on other classes, see build -watch for .vm files")
+	interval := flag.Duration("interval", 500*time.Millisecond, "how often -watch checks for changes")
 	flag.Parse()
 
+	cacheDir, cacheErr := DefaultCacheDir()
+	if *cleanCache {
+		if cacheErr != nil {
+			fmt.Fprintln(os.Stderr, cacheErr)
+			os.Exit(1)
+		}
+		if err := CleanCache(cacheDir); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// Cleaning the cache is a command on its own
+		if flag.NArg() == 0 {
+			return
+		}
+	}
+
 	// Make sure we have an input path
-	if flag.NArg() != 1 {
-		_, err := fmt.Fprintf(os.Stderr, "Usage: jackcompiler <inputPath>\n")
+	if flag.NArg() == 0 {
+		_, err := fmt.Fprintf(os.Stderr, "Usage: jackcompiler [-j n] [-exclude pattern] [-format xml|json|sexpr|dot] [-func Class.sub] [-o file | -outdir dir] [-watch] [-v] [-clean-cache] <inputPath>...\n       jackcompiler build [-target vm|asm] [-O1] [-inline n] [-strip] [-sourcemap] [-line-comments] [-outdir dir] [-watch] <inputPath>...\n       jackcompiler run [-O1] [-inline n] [-strip] [-tty] [flags] <inputPath>\n       jackcompiler compare [-context n] <out.xml> <expected.xml>\n       jackcompiler difftest [-O1] -ref command [-n count] [-seed n] | <fixtureDir>...\n       jackcompiler reduce [-keep diagnostic|panic|mismatch] [-ref command] [-o dir] <inputPath>\n       jackcompiler debug [-break where] <inputPath>\n")
 		if err != nil {
 			return
 		}
 		return
 	}
 
-	inputPath := flag.Arg(0)
-	//inputPath := "testsButcher/Square/Main.jack"
+	format, err := ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	if inputPath == "" {
-		panic("inputPath is required")
-		return
+	if *output != "" && *outDir != "" {
+		fmt.Fprintln(os.Stderr, "-o and -outdir can't be used together")
+		os.Exit(2)
 	}
 
-	analyzer := NewAnalyzer(inputPath)
+	// A cache that can't be used only costs speed, so it is left out instead of failing the build
+	var cache *Cache
+	if *useCache && cacheErr == nil {
+		cache, cacheErr = OpenCache(cacheDir)
+	}
+	if *useCache && cacheErr != nil && *verbose {
+		fmt.Fprintln(os.Stderr, "cache disabled:", cacheErr)
+	}
+
+	setup := func(analyzer *Analyzer) {
+		analyzer.SetJobs(*jobs)
+		analyzer.SetOutput(*output)
+		analyzer.SetOutputDir(*outDir)
+		analyzer.SetCache(cache)
+		analyzer.SetFormat(format)
+		analyzer.SetFunction(*function)
+	}
 
-	analyzer.Analyze()
+	if *watchInputs {
+		watch(flag.Args(), exclude, *interval, setup)
+	}
+
+	// Paths may be files, directories, globs, or dir/... to find every program below dir
+	programs, err := FindPrograms(flag.Args(), exclude)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	analyzer := NewProgramsAnalyzer(programs)
+	setup(analyzer)
+	err = analyzer.Analyze()
+
+	if *verbose && cache != nil {
+		hits, misses := cache.Stats()
+		fmt.Fprintf(os.Stderr, "cache: %d hits, %d misses (%s)\n", hits, misses, cacheDir)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 }
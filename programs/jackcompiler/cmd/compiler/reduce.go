@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/difftest"
+	"jackcompiler/pkg/reduce"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// reduceMain handles `jackcompiler reduce`, returning the exit code
+// 0 means a smaller program was written, 1 means the input doesn't fail the way it was asked to, and 2 means a usage error
+func reduceMain(args []string) int {
+	flags := flag.NewFlagSet("reduce", flag.ExitOnError)
+	keep := flags.String("keep", "auto", "what the program has to keep doing: diagnostic, panic, mismatch, or auto to pick whichever it does")
+	ref := flags.String("ref", "", "reference compiler command for -keep mismatch, run with a directory of .jack files as its last argument")
+	steps := flags.Uint64("steps", 50000000, "number of VM commands each program may execute for -keep mismatch")
+	out := flags.String("o", "reduced", "directory the reduced program is written to, which must be empty or not exist yet")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: jackcompiler reduce [-keep diagnostic|panic|mismatch] [-ref command] [-o dir] <inputPath>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	// Check where the result goes before spending time reducing
+	if err := checkOutputDir(*out, flags.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "jackcompiler reduce: %v\n", err)
+		return 2
+	}
+	sources, err := readSources(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if *keep == "auto" {
+		if *keep = checkSources(sources).kind; *keep == "" {
+			*keep = "mismatch"
+		}
+	}
+
+	var reduced []difftest.Source
+	var behaviour string
+	switch *keep {
+	case "diagnostic", "panic":
+		want := checkSources(sources)
+		if want.kind != *keep {
+			fmt.Fprintf(os.Stderr, "jackcompiler reduce: %s does not %s\n", flags.Arg(0), describeKeep(*keep))
+			return 1
+		}
+		behaviour = want.String()
+		reduced = reduceFailure(sources, func(candidate []difftest.Source) bool {
+			return checkSources(candidate) == want
+		})
+	case "mismatch":
+		if *ref == "" {
+			fmt.Fprintln(os.Stderr, "jackcompiler reduce: -keep mismatch needs -ref")
+			return 2
+		}
+		classes, err := parseSources(sources)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		reference := difftest.Command(strings.Fields(*ref))
+		diff := difftest.Check(sources, difftest.Jack, reference, *steps)
+		if diff == nil {
+			fmt.Fprintf(os.Stderr, "jackcompiler reduce: %s behaves the same with both compilers\n", flags.Arg(0))
+			return 1
+		}
+		diff = difftest.Minimize(classes, diff, difftest.Jack, reference, *steps)
+		behaviour = diff.Msg
+		reduced = diff.Sources
+	default:
+		fmt.Fprintf(os.Stderr, "jackcompiler reduce: unknown -keep %q\n", *keep)
+		return 2
+	}
+
+	if err := difftest.WriteSources(*out, reduced); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Printf("reduced %d lines in %d files to %d lines in %d files\n%s\nwritten to %s\n",
+		countLines(sources), len(sources), countLines(reduced), len(reduced), behaviour, *out)
+	return 0
+}
+
+// checkOutputDir makes sure the reduced program can be written to out without overwriting anything, since the
+// files that were reduced away mustn't be left behind and the input mustn't be written over
+func checkOutputDir(out string, inputPath string) error {
+	absOut, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	absInput, err := filepath.Abs(inputPath)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absOut, absInput); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("-o %s would hold the input %s, pick another directory", out, inputPath)
+	}
+
+	entries, err := os.ReadDir(out)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("-o %s already exists and isn't empty, remove it or pick another directory", out)
+	}
+	return nil
+}
+
+// describeKeep describes a -keep mode for error messages
+func describeKeep(keep string) string {
+	if keep == "panic" {
+		return "make the analyzer or compiler panic"
+	}
+	return "get a diagnostic from the analyzer or compiler"
+}
+
+// readSources reads the .jack file at inputPath, or every .jack file in it if it is a directory
+func readSources(inputPath string) ([]difftest.Source, error) {
+	paths := []string{inputPath}
+	if info, err := os.Stat(inputPath); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(inputPath, "*.jack")); err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no .jack files in %s", inputPath)
+	}
+
+	sources := make([]difftest.Source, len(paths))
+	for i, path := range paths {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[i] = difftest.Source{Name: filepath.Base(path), Code: string(code)}
+	}
+	return sources, nil
+}
+
+// parseSources parses every source, failing if any of them doesn't parse
+func parseSources(sources []difftest.Source) (classes []*ast.Class, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parser panicked: %v", r)
+		}
+	}()
+	for _, source := range sources {
+		class, err := compiler.Parse(source.Name, source.Code)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// reduceFailure shrinks a program that the analyzer or compiler fails on
+// Programs that parse are reduced a piece of syntax at a time so they stay valid Jack,
+// otherwise whole files and then single lines are removed
+func reduceFailure(sources []difftest.Source, keep func([]difftest.Source) bool) []difftest.Source {
+	check := func(classes []*ast.Class) bool {
+		formatted, err := difftest.Sources(classes)
+		return err == nil && keep(formatted)
+	}
+	// Formatting throws away comments and layout, which may be what the problem needs
+	if classes, err := parseSources(sources); err == nil && check(classes) {
+		formatted, _ := difftest.Sources(reduce.Reduce(classes, check))
+		return formatted
+	}
+
+	sources = append([]difftest.Source{}, sources...)
+	for i := 0; i < len(sources) && len(sources) > 1; {
+		candidate := append(append([]difftest.Source{}, sources[:i]...), sources[i+1:]...)
+		if keep(candidate) {
+			sources = candidate
+			continue
+		}
+		i++
+	}
+	for i := range sources {
+		sources[i].Code = reduce.Lines(sources[i].Code, func(code string) bool {
+			candidate := append([]difftest.Source{}, sources...)
+			candidate[i].Code = code
+			return keep(candidate)
+		})
+	}
+	return sources
+}
+
+// failure is the first problem found in a program, kind is "" if there wasn't one
+type failure struct {
+	kind string
+	file string
+	msg  string
+}
+
+func (f failure) String() string {
+	return f.file + ": " + f.kind + ": " + f.msg
+}
+
+// checkSources runs the analyzer and then the compiler over every file, returning the first panic or diagnostic
+// Line numbers are left out of the message, since they change as the program shrinks
+func checkSources(sources []difftest.Source) failure {
+	for _, source := range sources {
+		if f := checkSource(source); f.kind != "" {
+			return f
+		}
+	}
+	return failure{}
+}
+
+// checkSource runs the analyzer and compiler over a single file
+func checkSource(source difftest.Source) (f failure) {
+	f.file = source.Name
+	defer func() {
+		if r := recover(); r != nil {
+			f.kind, f.msg = "panic", fmt.Sprint(r)
+		}
+	}()
+
+	engine := analyzer.NewStringEngine(source.Name, source.Code)
+	if _, err := engine.Tree(); err != nil {
+		f.kind, f.msg = "diagnostic", err.Error()
+		if diagnostics := engine.Diagnostics(); len(diagnostics) > 0 {
+			f.msg = diagnostics[0]
+		}
+		// Diagnostics look like file:line: message
+		if parts := strings.SplitN(f.msg, ": ", 2); len(parts) == 2 && strings.HasPrefix(parts[0], source.Name+":") {
+			f.msg = parts[1]
+		}
+		return f
+	}
+
+	if _, err := compiler.Compile(source.Name, source.Code); err != nil {
+		f.kind, f.msg = "diagnostic", err.Error()
+		var compileErr *compiler.Error
+		if errors.As(err, &compileErr) {
+			f.msg = compileErr.Msg
+		}
+		return f
+	}
+	return failure{}
+}
+
+// countLines counts the lines of every source
+func countLines(sources []difftest.Source) int {
+	n := 0
+	for _, source := range sources {
+		n += strings.Count(source.Code, "\n")
+	}
+	return n
+}
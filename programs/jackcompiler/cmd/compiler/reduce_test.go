@@ -0,0 +1,111 @@
+package main
+
+import (
+	"jackcompiler/pkg/difftest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// undefinedSource parses, but uses a variable it never declares in one of its statements
+const undefinedSource = `class Main {
+    field int unused;
+
+    function void main() {
+        var int x, z;
+        let x = 1;
+        do Main.helper(x, 2);
+        while (x < 10) {
+            let x = x + 1;
+            if (x = 5) {
+                let y = x * 2;
+            }
+        }
+        return;
+    }
+
+    function int helper(int a, int b) {
+        return a + b;
+    }
+}
+`
+
+// brokenSource doesn't parse, so it is reduced a line at a time
+const brokenSource = `class Main {
+    // The let is missing its value
+    function void main() {
+        var int x;
+        do Output.printInt(3);
+        let x = ;
+        return;
+    }
+}
+`
+
+// TestReduceFailure checks that reduced programs are smaller and still fail with the same diagnostic
+func TestReduceFailure(t *testing.T) {
+	for _, code := range []string{undefinedSource, brokenSource} {
+		sources := []difftest.Source{{Name: "Main.jack", Code: code}, {Name: "Other.jack", Code: "class Other {\n}\n"}}
+		want := checkSources(sources)
+		if want.kind != "diagnostic" {
+			t.Fatalf("got %v, want a diagnostic", want)
+		}
+		reduced := reduceFailure(sources, func(candidate []difftest.Source) bool {
+			return checkSources(candidate) == want
+		})
+		if got := checkSources(reduced); got != want {
+			t.Errorf("reduced program fails with %v, want %v", got, want)
+		}
+		if len(reduced) != 1 || countLines(reduced) >= countLines(sources[:1]) {
+			t.Errorf("reduced to %d lines in %d files, want fewer than %d in 1 file", countLines(reduced), len(reduced), countLines(sources[:1]))
+		}
+	}
+}
+
+// TestCheckOutputDir checks that the reduced program is never written over the input or other files
+func TestCheckOutputDir(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	full := filepath.Join(dir, "full")
+	for _, d := range []string{src, full, filepath.Join(dir, "empty")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(src, "Main.jack"), filepath.Join(full, "Keep.txt")} {
+		if err := os.WriteFile(path, []byte("class Main {\n}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		out   string
+		input string
+		// err is part of the error wanted, or "" if out can be used
+		err string
+	}{
+		{filepath.Join(dir, "new"), src, ""},
+		{filepath.Join(dir, "empty"), src, ""},
+		{filepath.Join(dir, "sr"), src, ""},
+		{filepath.Join(dir, "src2"), filepath.Join(src, "Main.jack"), ""},
+		{src, src, "would hold the input"},
+		{src, filepath.Join(src, "Main.jack"), "would hold the input"},
+		{dir, src, "would hold the input"},
+		{full, src, "isn't empty"},
+	}
+	for _, test := range tests {
+		err := checkOutputDir(test.out, test.input)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("-o %s for %s: got error %v, want %q", test.out, test.input, err, test.err)
+		}
+	}
+
+	// Refusing happens before anything is written or removed
+	if code := reduceMain([]string{"-keep", "diagnostic", "-o", src, src}); code != 2 {
+		t.Errorf("reducing into the input exited with %d, want 2", code)
+	}
+	if _, err := os.Stat(filepath.Join(src, "Main.jack")); err != nil {
+		t.Errorf("input is gone after being refused: %v", err)
+	}
+}
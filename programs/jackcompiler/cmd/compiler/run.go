@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/screen"
+	"jackcompiler/pkg/tty"
+	"jackcompiler/pkg/vm"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runMain compiles a program along with the OS and executes it, returning the exit code
+func runMain(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	useTTY := flags.Bool("tty", false, "draw the screen in the terminal and send key presses to the keyboard register")
+	mode := flags.String("mode", "braille", "how pixels are drawn with -tty: braille or halfblock")
+	scale := flags.Int("scale", tty.DefaultOptions.Scale, "number of screen pixels (in each direction) covered by one terminal dot")
+	rate := flags.Int("rate", tty.DefaultOptions.Rate, "VM commands executed per second with -tty")
+	hold := flags.Duration("hold", tty.DefaultOptions.KeyHold, "how long a key press stays in the keyboard register with -tty")
+	steps := flags.Uint64("steps", 10000000, "number of VM commands to execute without -tty")
+	pngPath := flags.String("png", "", "write the screen to this PNG file once execution stops")
+	pbmPath := flags.String("pbm", "", "write the screen to this PBM file once execution stops")
+	capture := flags.String("capture", "", "comma separated list of steps to capture the screen at")
+	frames := flags.String("frames", "frame-%d.png", "file name for captured frames, %d is replaced by the step and the extension picks PNG or PBM")
+	keys := flags.String("keys", "", "comma separated list of step:keycode pairs to write to the keyboard register without -tty")
+	link := wholeProgramFlags(flags, "Sys.init")
+	var opts compiler.Options
+	optimizeFlags(flags, &opts)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: jackcompiler run -tty [flags] <inputPath>\n       jackcompiler run [-steps n] [-png file] [-pbm file] [-capture steps] [flags] <inputPath>\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	machine, err := loadProgram(flags.Arg(0), opts, link)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printOptStats(opts)
+
+	if *useTTY {
+		opts := tty.DefaultOptions
+		opts.Scale = *scale
+		opts.Rate = *rate
+		opts.KeyHold = *hold
+		var ok bool
+		if opts.Mode, ok = screen.ModeMap[*mode]; !ok {
+			fmt.Fprintf(os.Stderr, "jackcompiler run: unknown mode %q\n", *mode)
+			return 2
+		}
+		if opts.Scale < 1 || opts.Rate < opts.FPS {
+			fmt.Fprintf(os.Stderr, "jackcompiler run: -scale must be at least 1 and -rate at least %d\n", opts.FPS)
+			return 2
+		}
+		return runTTY(machine, opts)
+	}
+
+	// Everything that needs to happen at a particular step is an event
+	events, err := parseEvents(*capture, *keys)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jackcompiler run: %v\n", err)
+		return 2
+	}
+	if *pngPath == "" && *pbmPath == "" && len(events) == 0 {
+		fmt.Fprintln(os.Stderr, "jackcompiler run: nothing to do, use -tty, -png, -pbm, or -capture")
+		return 2
+	}
+	return runHeadless(machine, *steps, events, *frames, []string{*pngPath, *pbmPath})
+}
+
+// runTTY plays the program in the terminal until Ctrl-C is pressed
+func runTTY(machine *vm.Machine, opts tty.Options) int {
+	restore, err := tty.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jackcompiler run: stdin is not a terminal: %v\n", err)
+		return 1
+	}
+	err = tty.Run(machine, os.Stdin, os.Stdout, opts)
+	restore()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// event is something the headless runner does once the machine reaches a step
+// A key of -1 means the screen is captured instead
+type event struct {
+	step uint64
+	key  int
+}
+
+// parseEvents builds the sorted list of events from the -capture and -keys flags
+func parseEvents(capture string, keys string) ([]event, error) {
+	events := make([]event, 0)
+
+	for _, field := range splitList(capture) {
+		step, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture step %q", field)
+		}
+		events = append(events, event{step: step, key: -1})
+	}
+
+	for _, field := range splitList(keys) {
+		stepStr, keyStr, found := strings.Cut(field, ":")
+		step, err := strconv.ParseUint(stepStr, 10, 64)
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid key press %q, expected step:keycode", field)
+		}
+		key, err := strconv.Atoi(keyStr)
+		if err != nil || key < 0 || key > 32767 {
+			return nil, fmt.Errorf("invalid key code in %q", field)
+		}
+		events = append(events, event{step: step, key: key})
+	}
+
+	// Key presses go before captures at the same step, otherwise keep the order they were given in
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].step != events[j].step {
+			return events[i].step < events[j].step
+		}
+		return events[i].key > events[j].key
+	})
+	return events, nil
+}
+
+// splitList splits a comma separated flag value, ignoring empty entries
+func splitList(list string) []string {
+	fields := make([]string, 0)
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// runHeadless executes the program for the given number of steps, handling events along the way,
+// then writes the final screen to every non-empty path in outputs
+func runHeadless(machine *vm.Machine, steps uint64, events []event, frames string, outputs []string) int {
+	mem := machine.RAM[screen.Base : screen.Base+screen.Words]
+
+	var runErr error
+	for _, ev := range events {
+		if ev.step > steps {
+			break
+		}
+		if runErr == nil && ev.step > machine.Steps() {
+			runErr = machine.Run(ev.step - machine.Steps())
+		}
+
+		if ev.key >= 0 {
+			machine.RAM[vm.KeyboardAddr] = int16(ev.key)
+			continue
+		}
+		path := strings.Replace(frames, "%d", strconv.FormatUint(ev.step, 10), 1)
+		if err := screen.WriteFile(path, mem); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if runErr == nil && steps > machine.Steps() {
+		runErr = machine.Run(steps - machine.Steps())
+	}
+
+	// Write the screen even when the program failed so it is possible to see how far it got
+	for _, path := range outputs {
+		if path == "" {
+			continue
+		}
+		if err := screen.WriteFile(path, mem); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if runErr != nil {
+		fmt.Fprintln(os.Stderr, runErr)
+		return 1
+	}
+	return 0
+}
+
+// loadProgram compiles the program at inputPath, links it with the OS, and boots it
+// The whole program optimizations in link cover the OS as well as the program
+func loadProgram(inputPath string, opts compiler.Options, link *wholeProgram) (*vm.Machine, error) {
+	files, err := compiler.CompileProgramWith(inputPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	files = link.apply(inputPath, files, "Sys.init")
+	machine, err := vm.NewMachine(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := machine.Boot(); err != nil {
+		return nil, err
+	}
+	return machine, nil
+}
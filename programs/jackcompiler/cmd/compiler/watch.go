@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	. "jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileState is what we remember about a source file to notice when it changes
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watch compiles the programs matched by args, then polls them forever, recompiling only the files that changed
+// Every .jack file becomes its own xml file, so nothing else has to be rebuilt when one of them changes
+// setup configures each analyzer the same way a normal build would
+func watch(args []string, exclude []string, interval time.Duration, setup func(*Analyzer)) {
+	states := make(map[string]fileState)
+	first := true
+
+	for ; ; time.Sleep(interval) {
+		// Look for programs again every time so new files and directories are picked up
+		programs, err := FindPrograms(args, exclude)
+		if err != nil {
+			if first {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			continue
+		}
+
+		total := 0
+		seen := make(map[string]bool)
+		changed := make([]Program, 0)
+		for _, program := range programs {
+			files := make([]string, 0)
+			for _, file := range program.Files {
+				total++
+				seen[file] = true
+				info, err := os.Stat(file)
+				if err != nil {
+					continue
+				}
+				state := fileState{modTime: info.ModTime(), size: info.Size()}
+				if old, ok := states[file]; !ok || old != state {
+					states[file] = state
+					files = append(files, file)
+				}
+			}
+			if len(files) > 0 {
+				program.Files = files
+				changed = append(changed, program)
+			}
+		}
+
+		// Forget deleted files so they are rebuilt if they come back
+		for file := range states {
+			if !seen[file] {
+				delete(states, file)
+			}
+		}
+
+		if len(changed) == 0 && !first {
+			continue
+		}
+		first = false
+
+		rebuilt := 0
+		for _, program := range changed {
+			rebuilt += len(program.Files)
+		}
+
+		start := time.Now()
+		analyzer := NewProgramsAnalyzer(changed)
+		setup(analyzer)
+		err = analyzer.Analyze()
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		failed := 0
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			failed = len(joined.Unwrap())
+		} else if err != nil {
+			failed = 1
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		status := "ok"
+		if failed > 0 {
+			status = fmt.Sprintf("%d failed", failed)
+		}
+		fmt.Fprintf(os.Stderr, "[%s] rebuilt %d of %d files in %v: %s\n", start.Format("15:04:05"), rebuilt, total, elapsed, status)
+	}
+}
+
+// watchedFile is what buildWatch remembers about a source file
+type watchedFile struct {
+	state fileState
+	// compiled is nil when the file didn't compile
+	compiled *vm.File
+	// refs holds the names the class might refer to other classes by
+	refs map[string]bool
+}
+
+// buildWatch builds the programs matched by args, then polls them forever, recompiling the classes that
+// changed along with the classes of the same program that refer to them
+// With -inline or -strip every .vm file depends on the whole program, so all of them are written again
+// once every file compiles
+func buildWatch(args []string, exclude []string, interval time.Duration, outDir string, opts compiler.Options, link *wholeProgram, notes annotations) {
+	watched := make(map[string]*watchedFile)
+	first := true
+
+	for ; ; time.Sleep(interval) {
+		programs, err := FindPrograms(args, exclude)
+		if err != nil {
+			if first {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			continue
+		}
+
+		start := time.Now()
+		total, rebuilt, dependents, failed := 0, 0, 0, 0
+		seen := make(map[string]bool)
+		for _, program := range programs {
+			changed := make(map[string]bool)
+			var build []string
+			for _, file := range program.Files {
+				total++
+				seen[file] = true
+				info, err := os.Stat(file)
+				if err != nil {
+					continue
+				}
+				state := fileState{modTime: info.ModTime(), size: info.Size()}
+				if w, ok := watched[file]; !ok || w.state != state {
+					watched[file] = &watchedFile{state: state}
+					changed[className(file)] = true
+					build = append(build, file)
+				}
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			for _, file := range program.Files {
+				w, ok := watched[file]
+				if !ok || changed[className(file)] {
+					continue
+				}
+				for name := range w.refs {
+					if changed[name] {
+						build = append(build, file)
+						dependents++
+						break
+					}
+				}
+			}
+
+			rebuilt += len(build)
+			var files []*vm.File
+			var sources []string
+			for _, file := range build {
+				w := watched[file]
+				w.compiled, w.refs = nil, nil
+				class, err := compiler.ParseFile(file)
+				if err == nil {
+					w.refs = compiler.References(class)
+					w.compiled, err = compiler.CompileFileWith(file, opts)
+				}
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					failed++
+					continue
+				}
+				files = append(files, w.compiled)
+				sources = append(sources, file)
+			}
+
+			complete := !link.active()
+			if link.active() {
+				// Every file is written again once the whole program compiles
+				files, sources, complete = nil, nil, true
+				for _, file := range program.Files {
+					w, ok := watched[file]
+					if !ok || w.compiled == nil {
+						complete = false
+						continue
+					}
+					files = append(files, w.compiled)
+					sources = append(sources, file)
+				}
+				if !complete {
+					files, sources = nil, nil
+				}
+			}
+			if !writeProgram(program, outDir, sources, files, complete, link, notes) {
+				failed++
+			}
+		}
+
+		// Forget deleted files so they are rebuilt if they come back
+		for file := range watched {
+			if !seen[file] {
+				delete(watched, file)
+			}
+		}
+
+		if rebuilt == 0 && !first {
+			continue
+		}
+		first = false
+
+		status := "ok"
+		if failed > 0 {
+			status = fmt.Sprintf("%d failed", failed)
+		}
+		fmt.Fprintf(os.Stderr, "[%s] rebuilt %d of %d files, %d of them for referring to a changed class, in %v: %s\n",
+			start.Format("15:04:05"), rebuilt, total, dependents, time.Since(start).Round(time.Millisecond), status)
+	}
+}
+
+// className returns the name of the class a .jack file holds
+func className(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), ".jack")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"jackcompiler/pkg/hdl"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func main() {
+	os.Exit(checkMain(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// checkMain checks the chips named by args, printing their problems to stdout, and returns the exit code
+// 0 means no problems were found, 1 means some were, and 2 means a usage error
+func checkMain(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hdlcheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	path := flags.String("path", "", "directories to look for parts in after the chip's own, separated by "+string(os.PathListSeparator))
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: hdlcheck [-path dir1%cdir2] <chip.hdl | directory>...\n", os.PathListSeparator)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	files, err := findChips(flags.Args())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var search []string
+	if *path != "" {
+		search = filepath.SplitList(*path)
+	}
+
+	problems := 0
+	for _, file := range files {
+		for _, e := range hdl.CheckFile(file, search) {
+			fmt.Fprintln(stdout, e)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		fmt.Fprintf(stderr, "%d problem(s) found in %d chip(s)\n", problems, len(files))
+		return 1
+	}
+	return 0
+}
+
+// findChips expands directories into the .hdl files they contain
+func findChips(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		found := make([]string, 0)
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(p) == ".hdl" {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckMain checks what hdlcheck prints for a broken chip, with and without -path pointing at its parts
+func TestCheckMain(t *testing.T) {
+	chip := filepath.Join("..", "..", "pkg", "hdl", "testdata", "Broken.hdl")
+	hardware := filepath.Join("..", "..", "..", "..", "hardware")
+	path := filepath.Join(hardware, "01") + string(os.PathListSeparator) + filepath.Join(hardware, "02")
+
+	var stdout, stderr bytes.Buffer
+	if code := checkMain([]string{"-path", path, chip}, &stdout, &stderr); code != 1 {
+		t.Errorf("exited with %d, want 1", code)
+	}
+	want := []string{
+		chip + ":4: output wide[8..15] is not connected",
+		chip + ":4: output loose is not connected",
+		chip + ":7: combinational loop: loop1 -> loop2 -> loop1",
+		chip + ":10: width mismatch: out of Not16 is 16 bits but wide[8..15] is 8 bits",
+		chip + ":10: width mismatch: in of Not16 is 16 bits but a is 1 bit",
+		chip + ":11: And has no pin named c",
+		chip + ":12: b[16] is out of range, b has bits 0..15",
+		chip + ":13: unknown chip Xnor",
+		chip + ":14: out has more than one driver",
+		chip + ":14: pin nowhere is not connected to the output of any part",
+		chip + ":16: output out of Not can't drive input pin a",
+	}
+	if got := strings.TrimSuffix(stdout.String(), "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("printed\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+	if stderr.String() != "11 problem(s) found in 1 chip(s)\n" {
+		t.Errorf("printed %q to stderr", stderr.String())
+	}
+
+	// Without -path only the builtin parts are found, testdata isn't next to the other projects
+	stdout.Reset()
+	stderr.Reset()
+	checkMain([]string{chip}, &stdout, &stderr)
+	if !strings.Contains(stdout.String(), chip+":9: unknown chip Not16") {
+		t.Errorf("printed\n%s\nwithout -path, want Not16 to be unknown", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := checkMain([]string{filepath.Join(hardware, "03")}, &stdout, &stderr); code != 0 || stdout.Len() != 0 {
+		t.Errorf("the repository's chips exited with %d and printed\n%s", code, stdout.String())
+	}
+	if code := checkMain(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("no arguments exited with %d, want 2", code)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"jackcompiler/pkg/tst"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "print the echo messages of every script")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: jacktest [-v] <script.tst | directory>...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	scripts, err := findScripts(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	failed := 0
+	for _, script := range scripts {
+		result, err := tst.RunFile(script)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n     %v\n", script, err)
+			var cmpErr *tst.CompareError
+			if errors.As(err, &cmpErr) {
+				fmt.Printf("     want: %s\n     got:  %s\n", cmpErr.Want, cmpErr.Got)
+			}
+			continue
+		}
+
+		status := "ok  "
+		if !result.Compared {
+			status = "done"
+		}
+		fmt.Printf("%s %s (%d lines)\n", status, script, result.Lines)
+		if *verbose {
+			for _, msg := range result.Echo {
+				fmt.Printf("     %s\n", msg)
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d scripts failed\n", failed, len(scripts))
+		os.Exit(1)
+	}
+}
+
+// findScripts expands directories into the .tst files they contain
+func findScripts(paths []string) ([]string, error) {
+	scripts := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			scripts = append(scripts, path)
+			continue
+		}
+
+		found := make([]string, 0)
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(p) == ".tst" {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		scripts = append(scripts, found...)
+	}
+	return scripts, nil
+}
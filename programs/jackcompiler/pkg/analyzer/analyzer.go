@@ -1,14 +1,29 @@
 package analyzer
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	. "jackcompiler/pkg/common"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // Analyzer handles the top level of analysis
 type Analyzer struct {
-	inputPath string
-	isDir     bool
+	programs []Program
+	jobs     int
+	// output is a single file to write to, - for stdout
+	output string
+	// outDir mirrors the inputs into another directory instead of writing next to them
+	outDir string
+	cache  *Cache
+	format Format
+	// function limits the output to a single subroutine, written as Class.sub
+	function string
 }
 
 // NewAnalyzer constructs an analyzer from an input file
@@ -21,39 +36,218 @@ func NewAnalyzer(inputPath string) *Analyzer {
 		return nil
 	}
 
-	isDir := info.IsDir()
+	program := Program{Path: inputPath, Files: []string{inputPath}, Root: filepath.Dir(inputPath)}
+	if info.IsDir() {
+		// Get all jack files in the directory
+		if program, err = dirProgram(inputPath, nil); err != nil {
+			panic(err)
+		}
+	}
 
-	return &Analyzer{inputPath: inputPath, isDir: isDir}
+	return NewProgramsAnalyzer([]Program{program})
 }
 
-// Analyze will analyze the input file(s) and output the xml file(s)
-func (a *Analyzer) Analyze() {
-	jackFiles := make([]string, 0)
+// NewProgramsAnalyzer constructs an analyzer for programs found with FindPrograms
+func NewProgramsAnalyzer(programs []Program) *Analyzer {
+	return &Analyzer{programs: programs, jobs: 1, format: FormatXML}
+}
 
-	if a.isDir {
-		// Get all jack files in the directory
-		files, err := os.ReadDir(a.inputPath)
-		if err != nil {
-			panic(err)
-			return
+// SetJobs sets how many files are compiled at the same time
+func (a *Analyzer) SetJobs(jobs int) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	a.jobs = jobs
+}
+
+// SetOutput sends the output to a single file instead, - writes every file to stdout in order
+func (a *Analyzer) SetOutput(path string) {
+	a.output = path
+}
+
+// SetOutputDir writes the output into dir, keeping the layout of the inputs below their root
+func (a *Analyzer) SetOutputDir(dir string) {
+	a.outDir = dir
+}
+
+// SetFormat changes the format the parse tree is written in, xml by default
+func (a *Analyzer) SetFormat(format Format) {
+	a.format = format
+}
+
+// SetFunction limits the output to the subroutine named Class.sub, only Class.jack is compiled
+func (a *Analyzer) SetFunction(name string) {
+	a.function = name
+}
+
+// SetCache skips compiling files whose output is already in cache
+func (a *Analyzer) SetCache(cache *Cache) {
+	a.cache = cache
+}
+
+// job is a single file to compile and where its output goes, an empty output means stdout
+type job struct {
+	input  string
+	output string
+	format Format
+	// subroutine is the only subroutine to write out, when set
+	subroutine string
+}
+
+// result is what happened when a single file was compiled
+type result struct {
+	diagnostics []string
+	data        []byte
+	err         error
+}
+
+// jobList works out where every input file is written
+func (a *Analyzer) jobList() ([]job, error) {
+	class, subroutine := "", ""
+	if a.function != "" {
+		var ok bool
+		if class, subroutine, ok = strings.Cut(a.function, "."); !ok || class == "" || subroutine == "" {
+			return nil, fmt.Errorf("-func %s should look like Class.subroutine", a.function)
+		}
+	}
+
+	jobs := make([]job, 0)
+	for _, program := range a.programs {
+		for _, file := range program.Files {
+			// Every class lives in the file of the same name
+			if class != "" && filepath.Base(file) != class+".jack" {
+				continue
+			}
+
+			output := OutputPath(file, a.format)
+			switch {
+			case a.output == "-":
+				output = ""
+			case a.output != "":
+				output = a.output
+			case a.outDir != "":
+				rel, err := filepath.Rel(program.Root, file)
+				if err != nil {
+					return nil, err
+				}
+				output = filepath.Join(a.outDir, OutputPath(rel, a.format))
+			}
+			jobs = append(jobs, job{input: file, output: output, format: a.format, subroutine: subroutine})
 		}
+	}
+
+	if class != "" && len(jobs) == 0 {
+		return nil, fmt.Errorf("no %s.jack found for -func %s", class, a.function)
+	}
+
+	if a.output != "" && a.output != "-" && len(jobs) > 1 {
+		return nil, fmt.Errorf("-o %s given with %d input files, use -outdir instead", a.output, len(jobs))
+	}
+	return jobs, nil
+}
+
+// Analyze will analyze the input file(s) and output the xml file(s)
+// Diagnostics are printed in file order no matter how many jobs are used,
+// and the errors of every file that failed are returned together
+func (a *Analyzer) Analyze() error {
+	jobs, err := a.jobList()
+	if err != nil {
+		return err
+	}
 
-		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".jack") {
-				jackFiles = append(jackFiles, a.inputPath+"/"+file.Name())
+	// Hand the files out to a fixed number of workers, each file gets its own slot for its result
+	results := make([]result, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < a.jobs && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = analyzeFile(jobs[i], a.cache)
 			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	// Keep stdout for the output when that is where it is going
+	var diagnostics io.Writer = os.Stdout
+	if a.output == "-" {
+		diagnostics = os.Stderr
+	}
+
+	errs := make([]error, 0)
+	for _, res := range results {
+		for _, diagnostic := range res.diagnostics {
+			fmt.Fprintln(diagnostics, diagnostic)
+		}
+		if res.err != nil {
+			errs = append(errs, res.err)
+		} else if _, err := os.Stdout.Write(res.data); err != nil {
+			errs = append(errs, err)
 		}
-	} else {
-		jackFiles = append(jackFiles, a.inputPath)
 	}
+	return errors.Join(errs...)
+}
+
+// analyzeFile compiles a single file, using the cache if there is one
+func analyzeFile(j job, cache *Cache) result {
+	contents, err := os.ReadFile(j.input)
+	if err != nil {
+		return result{err: err}
+	}
+
+	var key string
+	var data []byte
+	ok := false
+	if cache != nil {
+		options := string(j.format) + "\x00" + j.subroutine
+		// Every format but XML writes the path of the file into the output
+		if j.format != FormatXML {
+			options += "\x00" + j.input
+		}
+		key = cache.Key(contents, options)
+		data, ok = cache.Get(key)
+	}
+
+	if !ok {
+		// Create the engine and process
+		engine := NewStringEngine(j.input, string(contents))
+		tree, err := engine.Tree()
+		if err != nil {
+			return result{diagnostics: engine.Diagnostics(), err: err}
+		}
+		if j.subroutine != "" {
+			if tree = FindSubroutine(tree, j.subroutine); tree == nil {
+				return result{err: fmt.Errorf("%s: no subroutine named %s", j.input, j.subroutine)}
+			}
+		}
 
-	// Now we will loop through all files and run analysis
-	for _, jackFile := range jackFiles {
-		// Create the engine
-		engine := NewEngine(jackFile)
-		// Process and write
-		engine.WriteXML()
+		var buf bytes.Buffer
+		if err := WriteTree(&buf, j.input, tree, j.format); err != nil {
+			return result{err: err}
+		}
+		data = buf.Bytes()
 
+		// Only clean compiles are cached, so problems are always reported again
+		if cache != nil {
+			if err := cache.Put(key, data); err != nil {
+				return result{err: err}
+			}
+		}
 	}
 
+	// Output for stdout is held until every file before it has been printed
+	if j.output == "" {
+		return result{data: data}
+	}
+	err = WriteFileAtomic(j.output, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	return result{err: err}
 }
@@ -0,0 +1,86 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	. "jackcompiler/pkg/common"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// CacheVersion is part of every cache key, bump it whenever the output for the same source changes
+const CacheVersion = "2"
+
+// Cache holds the output of files that compiled cleanly, keyed by a hash of their source
+type Cache struct {
+	dir    string
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/jackcompiler, or the platform's equivalent
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jackcompiler"), nil
+}
+
+// OpenCache uses dir as a cache, creating it if needed
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Key returns the key for a source file compiled with the given options
+func (c *Cache) Key(contents []byte, options string) string {
+	h := sha256.New()
+	io.WriteString(h, CacheVersion+"\x00"+options+"\x00")
+	h.Write(contents)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// path returns where an entry lives, entries are spread over directories named after the first byte of the key
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Get returns the output stored under key
+func (c *Cache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return data, true
+}
+
+// Put stores output under key
+func (c *Cache) Put(key string, data []byte) error {
+	return WriteFileAtomic(c.path(key), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Stats returns how many lookups were hits and misses
+func (c *Cache) Stats() (hits int64, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// CleanCache removes the cache directory and everything in it
+func CleanCache(dir string) error {
+	err := os.RemoveAll(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
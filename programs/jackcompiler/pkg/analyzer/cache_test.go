@@ -0,0 +1,54 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCacheKeepsPaths checks that files with the same contents at different paths don't share output
+// in the formats that write the path out, but still do in xml
+func TestCacheKeepsPaths(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := "class Main {\n    function void main() {\n        return;\n    }\n}\n"
+	var inputs []string
+	for _, name := range []string{"a", "b"} {
+		input := filepath.Join(dir, name, "Main.jack")
+		if err := os.MkdirAll(filepath.Dir(input), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(input, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, input)
+	}
+
+	for _, format := range []Format{FormatJSON, FormatSexpr, FormatDot} {
+		for _, input := range inputs {
+			res := analyzeFile(job{input: input, format: format}, cache)
+			if res.err != nil {
+				t.Fatal(res.err)
+			}
+			for _, other := range inputs {
+				if other != input && strings.Contains(string(res.data), other) {
+					t.Errorf("%s output for %s names %s", format, input, other)
+				}
+			}
+		}
+	}
+
+	hits, _ := cache.Stats()
+	for _, input := range inputs {
+		if res := analyzeFile(job{input: input, format: FormatXML}, cache); res.err != nil {
+			t.Fatal(res.err)
+		}
+	}
+	if after, _ := cache.Stats(); after != hits+1 {
+		t.Errorf("%d cache hits for the same xml at two paths, want 1", after-hits)
+	}
+}
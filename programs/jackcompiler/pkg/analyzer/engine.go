@@ -2,70 +2,153 @@ package analyzer
 
 import (
 	"fmt"
+	"io"
 	. "jackcompiler/pkg/common"
-	"os"
 	"strconv"
 	"strings"
 )
 
 // Engine is the handler of compilation
 type Engine struct {
-	tokenizer  *Tokenizer
-	indentVal  int
-	inputPath  string
-	outputFile *os.File
+	tokenizer *Tokenizer
+	// root is the parse tree built so far, stack holds the nodes that are still open
+	root        *Node
+	stack       []*Node
+	depth       int
+	inputPath   string
+	diagnostics []string
 }
 
 // NewEngine constructs an engine and tokenizer from an input file
 func NewEngine(inputFilePath string) *Engine {
-	return &Engine{tokenizer: NewTokenizer(inputFilePath), inputPath: inputFilePath}
+	return newEngine(inputFilePath, NewTokenizer(inputFilePath))
 }
 
-// write Will write a string to the output file, obeying indentation and adding new lines
-// The caller is responsible for setting the indentation value
-func (e *Engine) write(strToWrite string) {
-	formattedOutput := strings.Repeat("\t", e.indentVal) + strToWrite + "\n"
-	_, err := e.outputFile.WriteString(formattedOutput)
-	if err != nil {
-		panic(err)
+// NewStringEngine constructs an engine for a file whose contents have already been read
+func NewStringEngine(inputFilePath string, contents string) *Engine {
+	return newEngine(inputFilePath, NewStringTokenizer(contents))
+}
+
+// newEngine sets up an engine so the tokenizer's errors are collected along with its own
+func newEngine(inputFilePath string, tokenizer *Tokenizer) *Engine {
+	e := &Engine{tokenizer: tokenizer, inputPath: inputFilePath}
+	tokenizer.SetErrorHandler(e.report)
+	return e
+}
+
+// maxNesting is how deeply terms and statements can be nested before the engine gives up,
+// which keeps hostile input from exhausting the stack
+const maxNesting = 1000
+
+// report records a problem at the tokenizer's current line
+// Parsing stops at the first problem, so anything reported after it would only be noise
+func (e *Engine) report(msg string) {
+	if len(e.diagnostics) > 0 {
 		return
 	}
+	e.diagnostics = append(e.diagnostics, e.inputPath+":"+strconv.Itoa(e.tokenizer.line)+": "+msg)
 }
 
-// writeKeyword will write a keyword's xml to the output file, then advance
+// token returns the current token
+// An invalid token is returned at the end of the input and once a problem has been reported,
+// since it matches nothing every loop in the engine comes to an end
+func (e *Engine) token() *Token {
+	if len(e.diagnostics) > 0 {
+		return &Token{tokenType: Invalid}
+	}
+	token := e.tokenizer.Token()
+	if token == nil {
+		return &Token{tokenType: Invalid}
+	}
+	return token
+}
+
+// enter goes a level deeper into the input, returning false once it is nested past maxNesting
+// Every call needs a matching leave
+func (e *Engine) enter() bool {
+	e.depth++
+	if e.depth > maxNesting {
+		e.report("Too deeply nested")
+		return false
+	}
+	return true
+}
+
+// leave comes back out of a level entered with enter
+func (e *Engine) leave() {
+	e.depth--
+}
+
+// Diagnostics returns the problems found while compiling, in the order they were found
+func (e *Engine) Diagnostics() []string {
+	return e.diagnostics
+}
+
+// open starts a node of the parse tree, every node after it is a child until it is closed
+func (e *Engine) open(kind string) {
+	node := &Node{Kind: kind}
+	if len(e.stack) == 0 {
+		e.root = node
+	} else {
+		parent := e.stack[len(e.stack)-1]
+		parent.Children = append(parent.Children, node)
+	}
+	e.stack = append(e.stack, node)
+}
+
+// closeNode finishes the most recently opened node, which has to be of the given kind
+func (e *Engine) closeNode(kind string) {
+	if len(e.stack) == 0 || e.stack[len(e.stack)-1].Kind != kind {
+		open := "nothing"
+		if len(e.stack) > 0 {
+			open = e.stack[len(e.stack)-1].Kind
+		}
+		e.report("Internal error: closing " + kind + " while " + open + " is open")
+		return
+	}
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+// leaf adds a token to the node that is currently open
+func (e *Engine) leaf(token *Token) {
+	parent := e.stack[len(e.stack)-1]
+	parent.Children = append(parent.Children, &Node{Kind: TokenKinds[token.TokenType()], Token: token})
+}
+
+// writeKeyword will write a keyword's node to the parse tree, then advance
 // It will return false if the keyword is not the next token
 func (e *Engine) writeKeyword() bool {
-	if !(e.tokenizer.Token().TokenType() == Keyword) {
+	if !(e.token().TokenType() == Keyword) {
 		return false
 	}
-	e.write("<keyword> " + KeywordStrMap[e.tokenizer.Token().KeywordType()] + " </keyword>")
+	e.leaf(e.token())
 	e.tokenizer.Advance()
 
 	return true
 }
 
-// writeSpecSymbol will write a specific symbol's xml to the output file, then advance
+// writeSpecSymbol will write a specific symbol's node to the parse tree, then advance
 // It will return false if the symbol is not the next token
 func (e *Engine) writeSpecSymbol(symbol rune) bool {
-	if !(e.tokenizer.Token().TokenType() == Symbol && e.tokenizer.Token().Symbol() == symbol) {
+	if !(e.token().TokenType() == Symbol && e.token().Symbol() == symbol) {
 		return false
 	}
 	e.writeSymbol()
 	return true
 }
 
-// writeType will write a type's xml to the output file, then advance
+// writeType will write a type's node to the parse tree, then advance
 // It will return false if the type is not the next token
 func (e *Engine) writeType() bool {
 	// Check if we have an identifier
-	if e.tokenizer.Token().TokenType() == Identifier {
+	if e.token().TokenType() == Identifier {
 		// This can be a type
 		e.writeIdentifier()
 		return true
-	} else if e.tokenizer.Token().TokenType() == Keyword {
+	} else if e.token().TokenType() == Keyword {
 		// Make sure this is either int, char, or boolean
-		if e.tokenizer.Token().KeywordType() == Int || e.tokenizer.Token().KeywordType() == Char ||
-			e.tokenizer.Token().KeywordType() == Boolean || e.tokenizer.Token().KeywordType() == Void {
+		if e.token().KeywordType() == Int || e.token().KeywordType() == Char ||
+			e.token().KeywordType() == Boolean || e.token().KeywordType() == Void {
 			e.writeKeyword()
 			return true
 		}
@@ -75,35 +158,26 @@ func (e *Engine) writeType() bool {
 	return false
 }
 
-// writeSymbol will write a symbol's xml to the output file, then advance
+// writeSymbol will write a symbol's node to the parse tree, then advance
 // It will return false if the symbol is not the next token
 func (e *Engine) writeSymbol() bool {
-	if !(e.tokenizer.Token().TokenType() == Symbol) {
+	if !(e.token().TokenType() == Symbol) {
 		return false
 	}
 
-	// Escape special characters
-	cleanedSymbol := string(e.tokenizer.Token().Symbol())
-	if cleanedSymbol == "<" {
-		cleanedSymbol = "&lt;"
-	} else if cleanedSymbol == ">" {
-		cleanedSymbol = "&gt;"
-	} else if cleanedSymbol == "&" {
-		cleanedSymbol = "&amp;"
-	}
-	e.write("<symbol> " + cleanedSymbol + " </symbol>")
+	e.leaf(e.token())
 	e.tokenizer.Advance()
 
 	return true
 }
 
-// writeIdentifier will write an identifier's xml to the output file, then advance
+// writeIdentifier will write an identifier's node to the parse tree, then advance
 // It will return false if the identifier is not the next token
 func (e *Engine) writeIdentifier() bool {
-	if !(e.tokenizer.Token().TokenType() == Identifier) {
+	if !(e.token().TokenType() == Identifier) {
 		return false
 	}
-	e.write("<identifier> " + e.tokenizer.Token().Identifier() + " </identifier>")
+	e.leaf(e.token())
 	e.tokenizer.Advance()
 
 	return true
@@ -113,24 +187,26 @@ func (e *Engine) writeIdentifier() bool {
 // This will also handle the top level of the program
 func (e *Engine) compileClass() bool {
 	// Exit if we are trying to compile a class when no class keyword is available
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == Class) {
-		fmt.Println("Expected class keyword")
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == Class) {
+		e.report("Expected class keyword")
 		return false
 	}
-	e.write("<class>")
-	e.indentVal++
+	e.open("class")
 
 	// Now set keyword to class
 	e.writeKeyword()
 
 	// Now we should have a class name
 	if !e.writeIdentifier() {
-		fmt.Println("Expected identifier")
+		e.report("Expected identifier")
 		return false
 	}
 
 	// Write the open brace
-	e.writeSpecSymbol('{')
+	if !e.writeSpecSymbol('{') {
+		e.report("Expected open brace")
+		return false
+	}
 
 	// Now we move on to class variable declarations
 	for e.compileClassVarDec() {
@@ -143,11 +219,12 @@ func (e *Engine) compileClass() bool {
 	}
 
 	// Ensure that we have a closing brace
-	e.writeSpecSymbol('}')
-
-	e.indentVal--
+	if !e.writeSpecSymbol('}') {
+		e.report("Expected close brace")
+		return false
+	}
 
-	e.write("</class>")
+	e.closeNode("class")
 
 	return true
 
@@ -156,20 +233,19 @@ func (e *Engine) compileClass() bool {
 // compileClassVarDec will write the xml for static and field variable declarations
 func (e *Engine) compileClassVarDec() bool {
 	// Next should be static or field
-	if !(e.tokenizer.Token().TokenType() == Keyword && (e.tokenizer.Token().KeywordType() == Static || e.tokenizer.Token().KeywordType() == Field)) {
+	if !(e.token().TokenType() == Keyword && (e.token().KeywordType() == Static || e.token().KeywordType() == Field)) {
 		return false
 	}
 
 	// Otherwise we do
-	e.write("<classVarDec>")
-	e.indentVal++
+	e.open("classVarDec")
 
 	// Grab the keyword (static or field)
 	e.writeKeyword()
 
 	// Now we should have a name of a type (int, char, boolean, or identifier)
 	if !e.writeType() {
-		fmt.Println("Expected type")
+		e.report("Expected type")
 		return false
 	}
 
@@ -178,12 +254,12 @@ func (e *Engine) compileClassVarDec() bool {
 	for moreIdent {
 		// Try to write an identifier
 		if !e.writeIdentifier() {
-			fmt.Println("Expected identifier")
+			e.report("Expected identifier")
 			return false
 		}
 
 		// Check if we have a comma
-		if e.tokenizer.Token().TokenType() == Symbol && e.tokenizer.Token().Symbol() == ',' {
+		if e.token().TokenType() == Symbol && e.token().Symbol() == ',' {
 			// Write the comma
 			e.writeSymbol()
 		} else {
@@ -193,11 +269,13 @@ func (e *Engine) compileClassVarDec() bool {
 	}
 
 	// Now we should have a semicolon
-	e.writeSpecSymbol(';')
+	if !e.writeSpecSymbol(';') {
+		e.report("Expected semicolon")
+		return false
+	}
 
 	// Write the closing
-	e.indentVal--
-	e.write("</classVarDec>")
+	e.closeNode("classVarDec")
 
 	return true
 
@@ -206,47 +284,55 @@ func (e *Engine) compileClassVarDec() bool {
 // compileSubroutine will write the xml for a subroutine
 func (e *Engine) compileSubroutine() bool {
 	// Check if next we have a constructor, function, or method
-	if !(e.tokenizer.Token().TokenType() == Keyword && (e.tokenizer.Token().KeywordType() == Constructor ||
-		e.tokenizer.Token().KeywordType() == Function || e.tokenizer.Token().KeywordType() == Method)) {
+	if !(e.token().TokenType() == Keyword && (e.token().KeywordType() == Constructor ||
+		e.token().KeywordType() == Function || e.token().KeywordType() == Method)) {
 		// If not then we return false
 		return false
 	}
 
 	// Write subroutine
-	e.write("<subroutineDec>")
-	e.indentVal++
+	e.open("subroutineDec")
 
 	// Eat the function/constructor/method keyword
 	e.writeKeyword()
 
 	// Now we should have a return type
 	if !e.writeType() {
-		fmt.Println("Expected type")
+		e.report("Expected type")
 		return false
 	}
 
 	// Next should be an identifier
 	if !e.writeIdentifier() {
-		fmt.Println("Expected identifier")
+		e.report("Expected identifier")
 		return false
 	}
 
 	// Next should be an open parenthesis
-	e.writeSpecSymbol('(')
+	if !e.writeSpecSymbol('(') {
+		e.report("Expected open parenthesis")
+		return false
+	}
 
 	// Now we should have a parameter list
-	// We don't need an if statement since it always prints the tags
-	e.compileParameterList()
+	if !e.compileParameterList() {
+		return false
+	}
 
 	// Now we should have a closing parenthesis
-	e.writeSpecSymbol(')')
+	if !e.writeSpecSymbol(')') {
+		e.report("Expected close parenthesis")
+		return false
+	}
 
 	// Now we should have a subroutine body
-	e.write("<subroutineBody>")
-	e.indentVal++
+	e.open("subroutineBody")
 
 	// Now we should have an open brace
-	e.writeSpecSymbol('{')
+	if !e.writeSpecSymbol('{') {
+		e.report("Expected open brace")
+		return false
+	}
 
 	// Now we should have variable declarations
 	for e.compileVarDec() {
@@ -254,19 +340,20 @@ func (e *Engine) compileSubroutine() bool {
 	}
 
 	// Now we should have statements
-	for !((e.tokenizer.Token().TokenType() == Symbol) && (e.tokenizer.Token().Symbol() == '}')) {
-		// This will loop until we are done with statements
-		e.compileStatements()
+	if !e.compileStatements() {
+		e.report("Expected statements")
+		return false
 	}
 
-	// Now we should have a closing brace
-	e.writeSpecSymbol('}')
+	// Now we should have a closing brace, anything else is a statement we don't understand
+	if !e.writeSpecSymbol('}') {
+		e.report("Expected statement or close brace")
+		return false
+	}
 
-	e.indentVal--
-	e.write("</subroutineBody>")
+	e.closeNode("subroutineBody")
 
-	e.indentVal--
-	e.write("</subroutineDec>")
+	e.closeNode("subroutineDec")
 
 	return true
 }
@@ -274,26 +361,25 @@ func (e *Engine) compileSubroutine() bool {
 // compileParameterList will write the xml for a parameter list
 func (e *Engine) compileParameterList() bool {
 	// Write opening
-	e.write("<parameterList>")
-	e.indentVal++
+	e.open("parameterList")
 
 	moreParams := true
 
 	// If the next token is a closing parenthesis then we are done
-	if e.tokenizer.Token().TokenType() == Symbol && e.tokenizer.Token().Symbol() == ')' {
+	if e.token().TokenType() == Symbol && e.token().Symbol() == ')' {
 		moreParams = false
 	}
 
 	for moreParams {
 		// Check if we have a type
 		if !e.writeType() {
-			fmt.Println("Expected type")
+			e.report("Expected type")
 			return false
 		}
 
 		// Now we should have an identifier
 		if !e.writeIdentifier() {
-			fmt.Println("Expected identifier")
+			e.report("Expected identifier")
 			return false
 		}
 
@@ -303,8 +389,7 @@ func (e *Engine) compileParameterList() bool {
 		}
 	}
 
-	e.indentVal--
-	e.write("</parameterList>")
+	e.closeNode("parameterList")
 
 	return true
 }
@@ -312,20 +397,19 @@ func (e *Engine) compileParameterList() bool {
 // compileVarDec will write the xml for a variable declaration
 func (e *Engine) compileVarDec() bool {
 	// Check if we have a var keyword
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == Var) {
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == Var) {
 		return false
 	}
 
 	// Write opening
-	e.write("<varDec>")
-	e.indentVal++
+	e.open("varDec")
 
 	// Write var keyword
 	e.writeKeyword()
 
 	// Now we should have a type
 	if !e.writeType() {
-		fmt.Println("Expected type")
+		e.report("Expected type")
 		return false
 	}
 
@@ -334,7 +418,7 @@ func (e *Engine) compileVarDec() bool {
 	for moreIdent {
 		// Now we should have an identifier
 		if !e.writeIdentifier() {
-			fmt.Println("Expected identifier")
+			e.report("Expected identifier")
 			return false
 		}
 
@@ -342,15 +426,14 @@ func (e *Engine) compileVarDec() bool {
 		if !e.writeSpecSymbol(',') {
 			// Then we should write a semicolon
 			if !e.writeSpecSymbol(';') {
-				fmt.Println("Expected semicolon")
+				e.report("Expected semicolon")
 				return false
 			}
 			moreIdent = false
 		}
 	}
 
-	e.indentVal--
-	e.write("</varDec>")
+	e.closeNode("varDec")
 
 	return true
 
@@ -358,9 +441,14 @@ func (e *Engine) compileVarDec() bool {
 
 // compileStatements will write the xml for a statement
 func (e *Engine) compileStatements() bool {
+	ok := e.enter()
+	defer e.leave()
+	if !ok {
+		return false
+	}
+
 	// This will write statements regardless
-	e.write("<statements>")
-	e.indentVal++
+	e.open("statements")
 
 	// Loop while we have statements
 	moreStatements := true
@@ -394,8 +482,7 @@ func (e *Engine) compileStatements() bool {
 		moreStatements = false
 	}
 
-	e.indentVal--
-	e.write("</statements>")
+	e.closeNode("statements")
 
 	return true
 }
@@ -403,20 +490,19 @@ func (e *Engine) compileStatements() bool {
 // compileLet will write the xml for a let statement
 func (e *Engine) compileLet() bool {
 	// Check if we have a let keyword
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == Let) {
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == Let) {
 		return false
 	}
 
 	// Write opening
-	e.write("<letStatement>")
-	e.indentVal++
+	e.open("letStatement")
 
 	// Eat the keyword
 	e.writeKeyword()
 
 	// Now we should have an identifier
 	if !e.writeIdentifier() {
-		fmt.Println("Expected identifier")
+		e.report("Expected identifier")
 		return false
 	}
 
@@ -424,37 +510,36 @@ func (e *Engine) compileLet() bool {
 	if e.writeSpecSymbol('[') {
 		// We have an open brace so we should have an expression
 		if !e.compileExpression() {
-			fmt.Println("Expected expression")
+			e.report("Expected expression")
 			return false
 		}
 
 		// Now we should have a closing brace
 		if !e.writeSpecSymbol(']') {
-			fmt.Println("Expected closing brace")
+			e.report("Expected closing brace")
 			return false
 		}
 	}
 
 	// Now we should have an equal sign
 	if !e.writeSpecSymbol('=') {
-		fmt.Println("Expected equal sign")
+		e.report("Expected equal sign")
 		return false
 	}
 
 	// Now we should have an expression
 	if !e.compileExpression() {
-		fmt.Println("Expected expression")
+		e.report("Expected expression")
 		return false
 	}
 
 	// Now we should have a semicolon
 	if !e.writeSpecSymbol(';') {
-		fmt.Println("Expected semicolon")
+		e.report("Expected semicolon")
 		return false
 	}
 
-	e.indentVal--
-	e.write("</letStatement>")
+	e.closeNode("letStatement")
 
 	return true
 }
@@ -462,79 +547,77 @@ func (e *Engine) compileLet() bool {
 // compileIf will write the xml for an if statement
 func (e *Engine) compileIf() bool {
 	// Check if we have an if keyword
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == If) {
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == If) {
 		return false
 	}
 
 	// Write opening
-	e.write("<ifStatement>")
-	e.indentVal++
+	e.open("ifStatement")
 
 	// Eat if keyword
 	e.writeKeyword()
 
 	// Now we should have an open parenthesis
 	if !e.writeSpecSymbol('(') {
-		fmt.Println("Expected open parenthesis")
+		e.report("Expected open parenthesis")
 		return false
 	}
 
 	// Now we should have an expression
 	if !e.compileExpression() {
-		fmt.Println("Expected expression")
+		e.report("Expected expression")
 		return false
 	}
 
 	// Now we should have a close parenthesis
 	if !e.writeSpecSymbol(')') {
-		fmt.Println("Expected close parenthesis")
+		e.report("Expected close parenthesis")
 		return false
 	}
 
 	// Now we should have an open brace
 	if !e.writeSpecSymbol('{') {
-		fmt.Println("Expected open brace")
+		e.report("Expected open brace")
 		return false
 	}
 
 	// Now we should have statements
 	if !e.compileStatements() {
-		fmt.Println("Expected statements")
+		e.report("Expected statements")
 		return false
 	}
 
 	// Now we should have a close brace
 	if !e.writeSpecSymbol('}') {
-		fmt.Println("Expected close brace")
+		e.report("Expected close brace")
 		return false
 	}
 
 	// Now we may have an else keyword
-	if e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == Else {
+	if e.token().TokenType() == Keyword && e.token().KeywordType() == Else {
 		// Write the else keyword
 		e.writeKeyword()
 
 		// Now we should have an open brace
 		if !e.writeSpecSymbol('{') {
-			fmt.Println("Expected open brace")
+			e.report("Expected open brace")
 			return false
 		}
 
 		// Now we should have statements
 		if !e.compileStatements() {
-			fmt.Println("Expected statements")
+			e.report("Expected statements")
 			return false
 		}
 
 		// Now we should have a close brace
 		if !e.writeSpecSymbol('}') {
-			fmt.Println("Expected close brace")
+			e.report("Expected close brace")
 			return false
 		}
 	}
 
-	e.indentVal--
-	e.write("</ifStatement>")
+	e.closeNode("ifStatement")
 
 	return true
 }
@@ -542,55 +625,53 @@ func (e *Engine) compileIf() bool {
 // compileWhile will write the xml for a while statement
 func (e *Engine) compileWhile() bool {
 	// Check if we have a while keyword
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == While) {
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == While) {
 		return false
 	}
 
 	// Write opening
-	e.write("<whileStatement>")
-	e.indentVal++
+	e.open("whileStatement")
 
 	// Eat the keyword
 	e.writeKeyword()
 
 	// Now we should have an open parenthesis
 	if !e.writeSpecSymbol('(') {
-		fmt.Println("Expected open parenthesis")
+		e.report("Expected open parenthesis")
 		return false
 	}
 
 	// Now we should have an expression
 	if !e.compileExpression() {
-		fmt.Println("Expected expression")
+		e.report("Expected expression")
 		return false
 	}
 
 	// Now we should have a close parenthesis
 	if !e.writeSpecSymbol(')') {
-		fmt.Println("Expected close parenthesis")
+		e.report("Expected close parenthesis")
 		return false
 	}
 
 	// Now we should have an open brace
 	if !e.writeSpecSymbol('{') {
-		fmt.Println("Expected open brace")
+		e.report("Expected open brace")
 		return false
 	}
 
 	// Now we should have statements
 	if !e.compileStatements() {
-		fmt.Println("Expected statements")
+		e.report("Expected statements")
 		return false
 	}
 
 	// Now we should have a close brace
 	if !e.writeSpecSymbol('}') {
-		fmt.Println("Expected close brace")
+		e.report("Expected close brace")
 		return false
 	}
 
-	e.indentVal--
-	e.write("</whileStatement>")
+	e.closeNode("whileStatement")
 
 	return true
 
@@ -599,20 +680,19 @@ func (e *Engine) compileWhile() bool {
 // compileDo will write the xml for a do statement
 func (e *Engine) compileDo() bool {
 	// We should have a do keyword
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == Do) {
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == Do) {
 		return false
 	}
 
 	// Write opening
-	e.write("<doStatement>")
-	e.indentVal++
+	e.open("doStatement")
 
 	// Eat the keyword
 	e.writeKeyword()
 
 	// Now we should have an identifier
 	if !e.writeIdentifier() {
-		fmt.Println("Expected identifier")
+		e.report("Expected identifier")
 		return false
 	}
 
@@ -620,7 +700,7 @@ func (e *Engine) compileDo() bool {
 	if e.writeSpecSymbol('.') {
 		// We have a period so we should have an identifier
 		if !e.writeIdentifier() {
-			fmt.Println("Expected identifier")
+			e.report("Expected identifier")
 			return false
 		}
 	}
@@ -629,25 +709,24 @@ func (e *Engine) compileDo() bool {
 	if e.writeSpecSymbol('(') {
 		// We have an open parenthesis so we should have an expression list
 		if !e.compileExpressionList() {
-			fmt.Println("Expected expression list")
+			e.report("Expected expression list")
 			return false
 		}
 
 		// Now we should have a closing parenthesis
 		if !e.writeSpecSymbol(')') {
-			fmt.Println("Expected closing parenthesis")
+			e.report("Expected closing parenthesis")
 			return false
 		}
 	}
 
 	// Now we should have a semicolon
 	if !e.writeSpecSymbol(';') {
-		fmt.Println("Expected semicolon")
+		e.report("Expected semicolon")
 		return false
 	}
 
-	e.indentVal--
-	e.write("</doStatement>")
+	e.closeNode("doStatement")
 
 	return true
 }
@@ -655,37 +734,35 @@ func (e *Engine) compileDo() bool {
 // compileReturn will write the xml for a return statement
 func (e *Engine) compileReturn() bool {
 	// We should have a return keyword
-	if !(e.tokenizer.Token().TokenType() == Keyword && e.tokenizer.Token().KeywordType() == Return) {
+	if !(e.token().TokenType() == Keyword && e.token().KeywordType() == Return) {
 		return false
 	}
 
 	// Write opening
-	e.write("<returnStatement>")
-	e.indentVal++
+	e.open("returnStatement")
 
 	// Eat return keyword
 	e.writeKeyword()
 
 	// We will have an expression or a semi colon
-	statementEnded := e.tokenizer.Token().TokenType() == Symbol && e.tokenizer.Token().Symbol() == ';'
+	statementEnded := e.token().TokenType() == Symbol && e.token().Symbol() == ';'
 
 	// If we have an expression
 	if !statementEnded {
 		// We should have an expression
 		if !e.compileExpression() {
-			fmt.Println("Expected expression")
+			e.report("Expected expression")
 			return false
 		}
 	}
 
 	// Now we should have a semicolon
 	if !e.writeSpecSymbol(';') {
-		fmt.Println("Expected semicolon")
+		e.report("Expected semicolon")
 		return false
 	}
 
-	e.indentVal--
-	e.write("</returnStatement>")
+	e.closeNode("returnStatement")
 
 	return true
 }
@@ -693,19 +770,18 @@ func (e *Engine) compileReturn() bool {
 // compileExpression will write the xml for an expression
 func (e *Engine) compileExpression() bool {
 	// Write opening
-	e.write("<expression>")
-	e.indentVal++
+	e.open("expression")
 
 	// Compile terms until we don't have an operator
 	moreTerms := true
 	for moreTerms {
 		if !e.compileTerm() {
-			fmt.Println("Expected term")
+			e.report("Expected term")
 			return false
 		}
 
 		// Check if we have an operator
-		if e.tokenizer.Token().IsOperator() {
+		if e.token().IsOperator() {
 			// Write the operator
 			e.writeSymbol()
 		} else {
@@ -713,8 +789,7 @@ func (e *Engine) compileExpression() bool {
 		}
 	}
 
-	e.indentVal--
-	e.write("</expression>")
+	e.closeNode("expression")
 
 	return true
 
@@ -722,24 +797,29 @@ func (e *Engine) compileExpression() bool {
 
 // compileTerm will write the xml for a term (sorting out arrays vs calls and such)
 func (e *Engine) compileTerm() bool {
+	ok := e.enter()
+	defer e.leave()
+	if !ok {
+		return false
+	}
+
 	// A term can be an integer constant, string constant, keyword constant, variable name,
 	// array, subroutine call, unary operation
-	isInt := e.tokenizer.Token().TokenType() == IntegerConstant
-	isString := e.tokenizer.Token().TokenType() == StringConstant
-	isKeyword := e.tokenizer.Token().TokenType() == Keyword
-	isVarName := e.tokenizer.Token().TokenType() == Identifier
-	isUnary := e.tokenizer.Token().TokenType() == Symbol && (e.tokenizer.Token().Symbol() == '-' || e.tokenizer.Token().Symbol() == '~')
-	isExpr := e.tokenizer.Token().TokenType() == Symbol && e.tokenizer.Token().Symbol() == '('
+	isInt := e.token().TokenType() == IntegerConstant
+	isString := e.token().TokenType() == StringConstant
+	isKeyword := e.token().TokenType() == Keyword
+	isVarName := e.token().TokenType() == Identifier
+	isUnary := e.token().TokenType() == Symbol && (e.token().Symbol() == '-' || e.token().Symbol() == '~')
+	isExpr := e.token().TokenType() == Symbol && e.token().Symbol() == '('
 
 	// Check if we satisfy any of the above
 	if !(isInt || isString || isKeyword || isVarName || isUnary || isExpr) {
-		fmt.Println("Expected a term")
+		e.report("Expected a term")
 		return false
 	}
 
 	// Write opening
-	e.write("<term>")
-	e.indentVal++
+	e.open("term")
 
 	if isExpr {
 		// We have an open parenthesis
@@ -748,13 +828,13 @@ func (e *Engine) compileTerm() bool {
 
 		// Now we should have an expression
 		if !e.compileExpression() {
-			fmt.Println("Expected expression")
+			e.report("Expected expression")
 			return false
 		}
 
 		// Now we should have a close parenthesis
 		if !e.writeSpecSymbol(')') {
-			fmt.Println("Expected close parenthesis")
+			e.report("Expected close parenthesis")
 			return false
 		}
 
@@ -765,16 +845,20 @@ func (e *Engine) compileTerm() bool {
 
 		// Now we should have a term
 		if !e.compileTerm() {
-			fmt.Println("Expected term")
+			e.report("Expected term")
 			return false
 		}
 	} else if isInt {
-		// We have an integer constant
-		e.write("<integerConstant> " + strconv.Itoa(e.tokenizer.Token().IntVal()) + " </integerConstant>")
+		// We have an integer constant, which has to fit in 15 bits like the compiler wants
+		if e.token().IntVal() > 32767 {
+			e.report("Integer constant " + strconv.Itoa(e.token().IntVal()) + " is too large")
+			return false
+		}
+		e.leaf(e.token())
 		e.tokenizer.Advance()
 	} else if isString {
 		// We have a string constant
-		e.write("<stringConstant> " + e.tokenizer.Token().StringVal() + " </stringConstant>")
+		e.leaf(e.token())
 		e.tokenizer.Advance()
 	} else if isKeyword {
 		// We have a keyword constant
@@ -788,7 +872,7 @@ func (e *Engine) compileTerm() bool {
 		if e.writeSpecSymbol('.') {
 			// We have a period so an identifier should follow
 			if !e.writeIdentifier() {
-				fmt.Println("Expected identifier")
+				e.report("Expected identifier")
 				return false
 			}
 		}
@@ -797,13 +881,13 @@ func (e *Engine) compileTerm() bool {
 		if e.writeSpecSymbol('[') {
 			// In the open bracket we should have an expression
 			if !e.compileExpression() {
-				fmt.Println("Expected expression")
+				e.report("Expected expression")
 				return false
 			}
 
 			// Now we should have a closing bracket
 			if !e.writeSpecSymbol(']') {
-				fmt.Println("Expected closing bracket")
+				e.report("Expected closing bracket")
 				return false
 			}
 		}
@@ -812,21 +896,20 @@ func (e *Engine) compileTerm() bool {
 		if e.writeSpecSymbol('(') {
 			// We have an open parenthesis so we should have an expression list
 			if !e.compileExpressionList() {
-				fmt.Println("Expected expression list")
+				e.report("Expected expression list")
 				return false
 			}
 
 			// Now we should have a closing parenthesis
 			if !e.writeSpecSymbol(')') {
-				fmt.Println("Expected closing parenthesis")
+				e.report("Expected closing parenthesis")
 				return false
 			}
 		}
 
 	}
 
-	e.indentVal--
-	e.write("</term>")
+	e.closeNode("term")
 
 	return true
 }
@@ -834,15 +917,14 @@ func (e *Engine) compileTerm() bool {
 // compileExpressionList will write the xml for an expression list
 func (e *Engine) compileExpressionList() bool {
 	// Write opening
-	e.write("<expressionList>")
-	e.indentVal++
+	e.open("expressionList")
 
 	// We have at least one expression if the next token isn't a closing paranthesis
-	moreExpressions := e.tokenizer.Token().TokenType() != Symbol || e.tokenizer.Token().Symbol() != ')'
+	moreExpressions := e.token().TokenType() != Symbol || e.token().Symbol() != ')'
 	for moreExpressions {
 		// We should have an expression
 		if !e.compileExpression() {
-			fmt.Println("Expected expression")
+			e.report("Expected expression")
 			return false
 		}
 
@@ -850,37 +932,60 @@ func (e *Engine) compileExpressionList() bool {
 		moreExpressions = e.writeSpecSymbol(',')
 	}
 
-	e.indentVal--
-	e.write("</expressionList>")
+	e.closeNode("expressionList")
 
 	return true
 
 }
 
-// WriteXML will process the jack file and write the results to an xml file matching the name
-func (e *Engine) WriteXML() {
-	// Create the xml file
-	outputPath := strings.Replace(e.inputPath, ".jack", ".xml", 1)
-	var err error
-	e.outputFile, err = os.Create(outputPath)
+// XMLPath returns the path of the xml file that goes with a jack file
+func XMLPath(jackPath string) string {
+	return OutputPath(jackPath, FormatXML)
+}
 
-	if err != nil {
-		panic(err)
-		return
+// OutputPath returns the path of the file in the given format that goes with a jack file
+func OutputPath(jackPath string, format Format) string {
+	return strings.TrimSuffix(jackPath, ".jack") + "." + string(format)
+}
+
+// Tree processes the jack file and returns its parse tree
+// It returns an error if the file doesn't compile, see Diagnostics for the details
+func (e *Engine) Tree() (*Node, error) {
+	// Nothing should come after the class
+	if e.compileClass() && e.token().TokenType() != Invalid {
+		e.report("Unexpected token after end of class")
 	}
 
-	// Close the file when we are done, panic if we hit an error
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(e.outputFile)
+	// Some problems are reported without stopping compilation, those still count as a failure
+	if len(e.diagnostics) > 0 {
+		return nil, fmt.Errorf("failed to compile %s", e.inputPath)
+	}
+	return e.root, nil
+}
 
-	// Now compile the class
-	if !e.compileClass() {
-		fmt.Println("Failed to compile... See above for details.")
-		return
+// Compile will process the jack file, writing the xml to w
+// It returns an error if the file doesn't compile, see Diagnostics for the details
+func (e *Engine) Compile(w io.Writer) error {
+	return e.CompileFormat(w, FormatXML)
+}
+
+// CompileFormat will process the jack file, writing the parse tree to w in the given format
+func (e *Engine) CompileFormat(w io.Writer, format Format) error {
+	tree, err := e.Tree()
+	if err != nil {
+		return err
 	}
+	return WriteTree(w, e.inputPath, tree, format)
+}
+
+// WriteXML will process the jack file and write the results to an xml file matching the name
+// It returns an error if the file can't be written or doesn't compile, see Diagnostics for the details
+func (e *Engine) WriteXML() error {
+	return e.WriteXMLFile(XMLPath(e.inputPath))
+}
 
+// WriteXMLFile will process the jack file and write the results to outputPath
+// The file is only replaced once compilation succeeds
+func (e *Engine) WriteXMLFile(outputPath string) error {
+	return WriteFileAtomic(outputPath, e.Compile)
 }
@@ -0,0 +1,24 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCloseNode checks that closing a node other than the one that is open is reported
+func TestCloseNode(t *testing.T) {
+	e := NewStringEngine("Main.jack", "")
+	e.open("class")
+	e.open("term")
+	e.closeNode("expression")
+	if diagnostics := e.Diagnostics(); len(diagnostics) != 1 || !strings.Contains(diagnostics[0], "closing expression while term is open") {
+		t.Errorf("diagnostics %v, want the mismatch", diagnostics)
+	}
+
+	e = NewStringEngine("Main.jack", "")
+	e.open("class")
+	e.closeNode("class")
+	if len(e.stack) != 0 || len(e.Diagnostics()) != 0 {
+		t.Errorf("stack %v and diagnostics %v after closing the only node", e.stack, e.Diagnostics())
+	}
+}
@@ -0,0 +1,167 @@
+package analyzer_test
+
+import (
+	"io"
+	"jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/jackgen"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// seeds are the inputs every fuzz target starts from: the golden programs, generated classes, and known troublemakers
+func seeds(f *testing.F) {
+	paths, _ := filepath.Glob("testdata/*/*.jack")
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(contents))
+	}
+	for seed := int64(0); seed < 20; seed++ {
+		f.Add(jackgen.New(seed).Class("Main"))
+	}
+	for _, src := range []string{
+		"",
+		"class",
+		"class Main { function void main() { let x = 1 $ 2; return; } }",
+		"class Main { function void main() { do ; } }",
+		"class Main { function void main() { let s = \"unterminated; } }",
+		"class Main { /* unterminated comment",
+		"class Main { function void main() { return; } } trailing",
+		"class Main { function void main() { let x = ((((1; } }",
+		"class Main { function void main() { let x = - - - ~ 1; return; } }",
+		"class Main { function void main() { let x = 99999999999999999999999; return; } }",
+		"class \xff { }",
+		"class Main { function void main() { let x = 1 return; } }",
+		"class Main { function void main() { else { } return; } }",
+		"class Main { function void main() { let x = 1; var int y; return; } }",
+		"class Main { function main() { return; } }",
+		"class Main { field int x; static int y; field int z; }",
+		"class Main { function void main() { let a[1 = 2; return; } }",
+		"class Main { function void main() { do Main.f(1,); return; } }",
+		"class Main { function void main() { let x = 1 + + 2; return; } }",
+		"class Main { function void main() { if (x) { } else { } else { } return; } }",
+		"class Main { constructor Main new() { return this; } method void m(int a, char b) { return; } }",
+		"class Main { function void main() { let x = 32768; return; } }",
+		"class Main { function void main() { let x = -32767; return; } }",
+		// Space to Go but not to the regexes
+		"\v",
+		"x\u0085",
+		"class Main {\v}",
+	} {
+		f.Add(src)
+	}
+}
+
+// finish fails the test if run doesn't return in time, so an infinite loop shows up as a failure instead of a hang
+func finish(t *testing.T, src string, run func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("did not finish on input %q", src)
+	}
+}
+
+// FuzzTokenizer checks that the tokenizer always moves forward and stays inside its input
+func FuzzTokenizer(f *testing.F) {
+	seeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		finish(t, src, func() {
+			tokenizer := analyzer.NewStringTokenizer(src)
+			tokenizer.SetErrorHandler(func(string) {})
+
+			end := -1
+			for count := 0; ; count++ {
+				token := tokenizer.Token()
+				if token == nil {
+					return
+				}
+				if count > len(src) {
+					t.Errorf("more tokens than bytes of input")
+					return
+				}
+				if token.Offset() < end || token.Length() <= 0 || token.Offset()+token.Length() > len(src) {
+					t.Errorf("token at %d with length %d is out of place, the last token ended at %d",
+						token.Offset(), token.Length(), end)
+					return
+				}
+				end = token.Offset() + token.Length()
+				tokenizer.Advance()
+			}
+		})
+	})
+}
+
+// FuzzEngine checks that the analyzer finishes on any input, and writes every format when it succeeds
+func FuzzEngine(f *testing.F) {
+	seeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		finish(t, src, func() {
+			engine := analyzer.NewStringEngine("Main.jack", src)
+			tree, err := engine.Tree()
+			if err != nil {
+				if len(engine.Diagnostics()) == 0 {
+					t.Errorf("failed without a diagnostic")
+				}
+				return
+			}
+			for _, format := range analyzer.Formats {
+				if err := analyzer.WriteTree(io.Discard, "Main.jack", tree, format); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	})
+}
+
+// FuzzCompiler checks that the compiler finishes on any input
+func FuzzCompiler(f *testing.F) {
+	seeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		finish(t, src, func() {
+			compiler.Compile("Main.jack", src)
+		})
+	})
+}
+
+// FuzzParsers checks that the analyzer and the compiler's parser accept and reject the same inputs, since the
+// xml and the vm code of a class come from different front ends
+func FuzzParsers(f *testing.F) {
+	seeds(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		finish(t, src, func() {
+			engine := analyzer.NewStringEngine("Main.jack", src)
+			_, engineErr := engine.Tree()
+			_, parseErr := compiler.Parse("Main.jack", src)
+			if (engineErr == nil) != (parseErr == nil) {
+				t.Errorf("the analyzer says %v %v but the compiler says %v", engineErr, engine.Diagnostics(), parseErr)
+			}
+		})
+	})
+}
+
+// TestGeneratedPrograms checks that the analyzer and the compiler's parser both accept every generated class
+func TestGeneratedPrograms(t *testing.T) {
+	for seed := int64(0); seed < 500; seed++ {
+		src := jackgen.New(seed).Class("Main")
+		finish(t, src, func() {
+			engine := analyzer.NewStringEngine("Main.jack", src)
+			if _, err := engine.Tree(); err != nil {
+				t.Errorf("seed %d: %v %v\n%s", seed, err, engine.Diagnostics(), src)
+			}
+			if _, err := compiler.Parse("Main.jack", src); err != nil {
+				t.Errorf("seed %d: %v\n%s", seed, err, src)
+			}
+		})
+	}
+}
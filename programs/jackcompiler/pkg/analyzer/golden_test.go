@@ -0,0 +1,141 @@
+package analyzer_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/vm"
+	"jackcompiler/pkg/xmldiff"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// externalSources maps the golden directories whose programs live elsewhere in the repository to their sources
+var externalSources = map[string]string{
+	"2048": "../../../2048",
+}
+
+// TestGolden compiles every program under testdata and checks the xml and vm output against the golden files
+// next to it, run with -update to regenerate them
+func TestGolden(t *testing.T) {
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		golden := filepath.Join("testdata", entry.Name())
+		source := golden
+		if external, ok := externalSources[entry.Name()]; ok {
+			source = external
+		}
+		t.Run(entry.Name(), func(t *testing.T) {
+			testProgram(t, golden, source)
+		})
+	}
+}
+
+// testProgram checks a single program directory
+func testProgram(t *testing.T, golden string, source string) {
+	programs, err := analyzer.FindPrograms([]string{source}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) != 1 || len(programs[0].Files) == 0 {
+		t.Fatalf("%s: no .jack files found", source)
+	}
+
+	out := t.TempDir()
+	a := analyzer.NewProgramsAnalyzer(programs)
+	a.SetOutputDir(out)
+	if err := a.Analyze(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range programs[0].Files {
+		class := strings.TrimSuffix(filepath.Base(file), ".jack")
+
+		xml, err := os.ReadFile(filepath.Join(out, class+".xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, filepath.Join(golden, class+".xml"), xml)
+
+		compiled, err := compiler.CompileFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var code bytes.Buffer
+		if err := vm.Write(&code, compiled.Commands); err != nil {
+			t.Fatal(err)
+		}
+		check(t, filepath.Join(golden, class+".vm"), code.Bytes())
+	}
+}
+
+// check compares output against a golden file, or replaces the golden file when -update is set
+func check(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("%v (run go test -update to create it)", err)
+		return
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	// Point at the first difference so a failure is easy to track down
+	if strings.HasSuffix(path, ".xml") {
+		gotTree, err := xmldiff.Parse("output", bytes.NewReader(got))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			return
+		}
+		wantTree, err := xmldiff.Parse(path, bytes.NewReader(want))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			return
+		}
+		if diff := xmldiff.Compare(gotTree, wantTree); diff != nil {
+			t.Errorf("%s:%d: %v", path, diff.WantLine, diff)
+			return
+		}
+	}
+	t.Errorf("%s: %s", path, firstDifference(got, want))
+}
+
+// firstDifference describes the first line that differs between two outputs
+func firstDifference(got []byte, want []byte) string {
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, g, w)
+		}
+	}
+	return "outputs differ"
+}
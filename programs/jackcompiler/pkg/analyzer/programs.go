@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Program is a group of .jack files that are compiled together, either a directory or a single file
+type Program struct {
+	Path  string
+	Files []string
+	// Root is the directory output paths are mirrored from, the directory walked for dir/... arguments
+	Root string
+}
+
+// FindPrograms expands command line arguments into programs
+// Each argument can be a .jack file, a directory, a glob pattern, or a directory followed by /... to find every
+// directory below it that holds .jack files, skipping hidden and vendor directories
+// Files and directories matching any of the exclude patterns are skipped, patterns are matched against both
+// the whole path and its last element
+func FindPrograms(args []string, exclude []string) ([]Program, error) {
+	for _, pattern := range exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q", pattern)
+		}
+	}
+
+	programs := make([]Program, 0)
+	seen := make(map[string]bool)
+	add := func(program Program) {
+		key := filepath.Clean(program.Path)
+		if !seen[key] {
+			seen[key] = true
+			programs = append(programs, program)
+		}
+	}
+
+	for _, arg := range args {
+		recursive := false
+		if arg == "..." || strings.HasSuffix(arg, string(filepath.Separator)+"...") || strings.HasSuffix(arg, "/...") {
+			recursive = true
+			arg = strings.TrimSuffix(strings.TrimSuffix(arg, "..."), "/")
+			if arg == "" {
+				arg = "."
+			}
+		}
+
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q", arg)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no matches", arg)
+			}
+			paths = matches
+		}
+
+		for _, path := range paths {
+			if excluded(path, exclude) {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case recursive && info.IsDir():
+				found, err := walkPrograms(path, exclude)
+				if err != nil {
+					return nil, err
+				}
+				if len(found) == 0 {
+					return nil, fmt.Errorf("%s: no .jack files found", path)
+				}
+				for _, program := range found {
+					program.Root = path
+					add(program)
+				}
+			case info.IsDir():
+				program, err := dirProgram(path, exclude)
+				if err != nil {
+					return nil, err
+				}
+				add(program)
+			default:
+				add(Program{Path: path, Files: []string{path}, Root: filepath.Dir(path)})
+			}
+		}
+	}
+
+	return programs, nil
+}
+
+// excluded checks a path against the exclude patterns
+func excluded(path string, exclude []string) bool {
+	path = filepath.Clean(path)
+	for _, pattern := range exclude {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dirProgram builds a program out of the .jack files directly inside a directory
+func dirProgram(dir string, exclude []string) (Program, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Program{}, err
+	}
+	program := Program{Path: dir, Root: dir}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jack") && !excluded(path, exclude) {
+			program.Files = append(program.Files, path)
+		}
+	}
+	return program, nil
+}
+
+// walkPrograms finds every directory below root that holds .jack files
+func walkPrograms(root string, exclude []string) ([]Program, error) {
+	programs := make([]Program, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor" || excluded(path, exclude)) {
+			return filepath.SkipDir
+		}
+
+		program, err := dirProgram(path, exclude)
+		if err != nil {
+			return err
+		}
+		if len(program.Files) > 0 {
+			programs = append(programs, program)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(programs, func(i, j int) bool {
+		return programs[i].Path < programs[j].Path
+	})
+	return programs, nil
+}
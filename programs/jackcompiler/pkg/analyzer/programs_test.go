@@ -0,0 +1,126 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFindPrograms expands arguments over a tree of programs, describing each program found as
+// "path : files" with everything relative to the tree and the root in brackets when it isn't the path
+func TestFindPrograms(t *testing.T) {
+	root := t.TempDir()
+	for _, file := range []string{
+		"Top.jack",
+		"a/Main.jack", "a/Util.jack", "a/notes.txt",
+		"a/sub/Sub.jack",
+		"b/Main.jack", "b/Skip.jack",
+		"c/deep/Deep.jack",
+		".hidden/Main.jack",
+		"vendor/Lib.jack",
+		"empty/readme.txt",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(rel string) string {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		exclude []string
+		want    []string
+		err     string
+	}{
+		{
+			name: "recursive",
+			args: []string{at("...")},
+			want: []string{". : Top.jack", "a : a/Main.jack a/Util.jack [.]", "a/sub : a/sub/Sub.jack [.]",
+				"b : b/Main.jack b/Skip.jack [.]", "c/deep : c/deep/Deep.jack [.]"},
+		},
+		{
+			name:    "exclude by name",
+			args:    []string{at("...")},
+			exclude: []string{"b", "Util.jack"},
+			want:    []string{". : Top.jack", "a : a/Main.jack [.]", "a/sub : a/sub/Sub.jack [.]", "c/deep : c/deep/Deep.jack [.]"},
+		},
+		{
+			name:    "exclude by path",
+			args:    []string{at("a/...")},
+			exclude: []string{at("a/sub")},
+			want:    []string{"a : a/Main.jack a/Util.jack"},
+		},
+		{
+			name:    "exclude a file of a directory",
+			args:    []string{at("b")},
+			exclude: []string{"Skip.*"},
+			want:    []string{"b : b/Main.jack"},
+		},
+		{
+			name: "glob of files",
+			args: []string{at("*/Main.jack")},
+			want: []string{".hidden/Main.jack : .hidden/Main.jack [.hidden]", "a/Main.jack : a/Main.jack [a]", "b/Main.jack : b/Main.jack [b]"},
+		},
+		{
+			name:    "glob of directories",
+			args:    []string{at("[ab]"), at("a") + string(filepath.Separator)},
+			exclude: []string{"*.txt"},
+			want:    []string{"a : a/Main.jack a/Util.jack", "b : b/Main.jack b/Skip.jack"},
+		},
+		{
+			// Hidden and vendor directories are only skipped while walking, not when they are asked for
+			name: "asked for",
+			args: []string{at(".hidden/..."), at("vendor")},
+			want: []string{".hidden : .hidden/Main.jack", "vendor : vendor/Lib.jack"},
+		},
+		{name: "no matches", args: []string{at("x*")}, err: "no matches"},
+		{name: "nothing below", args: []string{at("empty/...")}, err: "no .jack files found"},
+		{name: "missing", args: []string{at("missing")}, err: "no such file"},
+		{name: "bad exclude", args: []string{at("a")}, exclude: []string{"["}, err: "invalid exclude pattern"},
+	}
+
+	rel := func(path string) string {
+		r, err := filepath.Rel(root, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return filepath.ToSlash(r)
+	}
+	for _, test := range tests {
+		programs, err := FindPrograms(test.args, test.exclude)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		got := make([]string, len(programs))
+		for i, program := range programs {
+			files := make([]string, len(program.Files))
+			for k, file := range program.Files {
+				files[k] = rel(file)
+			}
+			got[i] = rel(program.Path) + " : " + strings.Join(files, " ")
+			if program.Root != program.Path {
+				got[i] += " [" + rel(program.Root) + "]"
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
@@ -12,6 +12,10 @@ type Token struct {
 	identifier  string
 	intVal      int
 	stringVal   string
+	line        int
+	column      int
+	offset      int
+	length      int
 }
 
 // TokenType returns the type of the token
@@ -48,3 +52,23 @@ func (t *Token) StringVal() string {
 func (t *Token) IsOperator() bool {
 	return t.tokenType == Symbol && (t.symbol == '+' || t.symbol == '-' || t.symbol == '*' || t.symbol == '/' || t.symbol == '&' || t.symbol == '|' || t.symbol == '<' || t.symbol == '>' || t.symbol == '=')
 }
+
+// Line returns the line of the input file the token was found on
+func (t *Token) Line() int {
+	return t.line
+}
+
+// Column returns the column the token starts at, counting bytes from 1
+func (t *Token) Column() int {
+	return t.column
+}
+
+// Offset returns how many bytes into the input file the token starts
+func (t *Token) Offset() int {
+	return t.offset
+}
+
+// Length returns how many bytes of the input file the token takes up, including the quotes of a string
+func (t *Token) Length() int {
+	return t.length
+}
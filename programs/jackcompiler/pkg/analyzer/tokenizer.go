@@ -8,12 +8,22 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Tokenizer takes in a file and returns tokens as needed
 type Tokenizer struct {
 	inputText    string
 	prevMatchEnd int
+	line         int
+	// offset is how many bytes of the input have been consumed, lineStart is the offset the current line starts at
+	offset    int
+	lineStart int
+	// errorAt is the offset of the last error reported, so asking for the same bad token again stays quiet
+	errorAt int
+	// onError is called with a message whenever something that isn't a token is found
+	onError func(msg string)
 }
 
 // NewTokenizer takes the input file path and loads a new tokenizer
@@ -39,13 +49,23 @@ func NewTokenizer(inputFilePath string) *Tokenizer {
 		contents += scanner.Text() + "\n"
 	}
 
-	return &Tokenizer{inputText: contents, prevMatchEnd: -1}
+	return NewStringTokenizer(contents)
 
 }
 
+// NewStringTokenizer loads a new tokenizer from the contents of a .jack file that is already in memory
+func NewStringTokenizer(contents string) *Tokenizer {
+	return &Tokenizer{inputText: contents, prevMatchEnd: -1, line: 1, errorAt: -1, onError: func(msg string) { fmt.Fprintln(os.Stderr, msg) }}
+}
+
+// SetErrorHandler changes what happens to error messages, which are printed by default
+func (t *Tokenizer) SetErrorHandler(onError func(msg string)) {
+	t.onError = onError
+}
+
 // matchToken will return the current token
 // This assumes that the regex matches the beginning of the inputText
-func (t *Tokenizer) matchToken(regex regexp.Regexp) string {
+func (t *Tokenizer) matchToken(regex *regexp.Regexp) string {
 	// Get the indexes of the match
 	matchEndIdx := regex.FindStringIndex(t.inputText)[1]
 
@@ -67,13 +87,20 @@ func (t *Tokenizer) HasMoreTokens() bool {
 func (t *Tokenizer) Advance() {
 	// Advance the input text
 	if t.prevMatchEnd != -1 {
+		// Keep track of the line we are on so tokens can report where they came from
+		consumed := t.inputText[:t.prevMatchEnd]
+		t.line += strings.Count(consumed, "\n")
+		if i := strings.LastIndexByte(consumed, '\n'); i >= 0 {
+			t.lineStart = t.offset + i + 1
+		}
+		t.offset += t.prevMatchEnd
 		t.inputText = t.inputText[t.prevMatchEnd:]
 		t.prevMatchEnd = -1
 	}
 }
 
 // matchAdvance will match the regex and advance the tokenizer
-func (t *Tokenizer) matchAdvance(regex regexp.Regexp) string {
+func (t *Tokenizer) matchAdvance(regex *regexp.Regexp) string {
 	match := t.matchToken(regex)
 	t.Advance()
 	return match
@@ -90,12 +117,14 @@ func (t *Tokenizer) Token() *Token {
 		changed = false
 		// Clear whitespace
 		if WhitespaceRegex.MatchString(t.inputText) {
-			t.matchAdvance(*WhitespaceRegex)
+			t.matchAdvance(WhitespaceRegex)
 			changed = true
 		}
 		// Clear comments
-		if CommentRegex.MatchString(t.inputText) {
-			t.matchAdvance(*CommentRegex)
+		// CommentRegex anchors each alternative rather than the whole pattern, so it would search the rest of the
+		// file every time it doesn't match, check for the start of a comment first
+		if (strings.HasPrefix(t.inputText, "//") || strings.HasPrefix(t.inputText, "/*")) && CommentRegex.MatchString(t.inputText) {
+			t.matchAdvance(CommentRegex)
 			changed = true
 		}
 
@@ -104,11 +133,15 @@ func (t *Tokenizer) Token() *Token {
 	// We need to check in order of precedence, for example checking an identifier before a symbol would resolve
 	// "int" as a symbol, which is not right
 	if t.HasMoreTokens() {
+		token.line = t.line
+		token.offset = t.offset
+		token.column = t.offset - t.lineStart + 1
+
 		if KeywordRegex.MatchString(t.inputText) {
 			// Next token is keyword
 			token.tokenType = Keyword
 
-			match := t.matchToken(*KeywordRegex)
+			match := t.matchToken(KeywordRegex)
 
 			// Check which keyword it is
 			token.keywordType = KeywordMap[match]
@@ -117,7 +150,7 @@ func (t *Tokenizer) Token() *Token {
 			// Next token is a symbol
 			token.tokenType = Symbol
 
-			match := t.matchToken(*SymbolRegex)
+			match := t.matchToken(SymbolRegex)
 
 			// Symbol should just be a char
 			token.symbol = rune(match[0])
@@ -126,7 +159,7 @@ func (t *Tokenizer) Token() *Token {
 			// Next token is an integer constant
 			token.tokenType = IntegerConstant
 
-			match := t.matchToken(*IntegerConstantRegex)
+			match := t.matchToken(IntegerConstantRegex)
 
 			// Convert string to int
 			token.intVal, _ = strconv.Atoi(match)
@@ -135,7 +168,7 @@ func (t *Tokenizer) Token() *Token {
 			// Next token is a string constant
 			token.tokenType = StringConstant
 
-			match := t.matchToken(*StringConstantRegex)
+			match := t.matchToken(StringConstantRegex)
 
 			// Remove quotes from string and set its value
 			token.stringVal = match[1 : len(match)-1]
@@ -144,13 +177,27 @@ func (t *Tokenizer) Token() *Token {
 			// Next token is an identifier
 			token.tokenType = Identifier
 
-			match := t.matchToken(*IdentifierRegex)
+			match := t.matchToken(IdentifierRegex)
 
 			// Set identifier value
 			token.identifier = match
 		} else {
-			// Next token is invalid
-			fmt.Println("Unexpected token: " + strings.Split(t.inputText, " ")[0])
+			// Next token is invalid, it is skipped a character at a time so the input always moves forward
+			token.tokenType = Invalid
+			r, size := utf8.DecodeRuneInString(t.inputText)
+			t.prevMatchEnd = size
+			if t.errorAt != t.offset {
+				t.errorAt = t.offset
+				// Characters such as \v are whitespace to Go but not to the regexes, so they are quoted to be seen
+				text := string(r)
+				if !unicode.IsPrint(r) {
+					text = strconv.QuoteRune(r)
+				}
+				t.onError("Unexpected token: " + text)
+			}
+		}
+		if t.prevMatchEnd != -1 {
+			token.length = t.prevMatchEnd
 		}
 		return token
 	}
@@ -0,0 +1,35 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestUnexpectedToken checks the message for each character that isn't part of a token, including ones Go
+// counts as space but the regexes don't
+func TestUnexpectedToken(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"let x = 1 $ 2;", []string{"Unexpected token: $"}},
+		{"\v", []string{`Unexpected token: '\v'`}},
+		{"class\v", []string{`Unexpected token: '\v'`}},
+		{"class Main {\v}", []string{`Unexpected token: '\v'`}},
+		{"x\u0085", []string{`Unexpected token: '\u0085'`}},
+		{"a # b ? c", []string{"Unexpected token: #", "Unexpected token: ?"}},
+	}
+	for _, test := range tests {
+		var got []string
+		tokenizer := NewStringTokenizer(test.src)
+		tokenizer.SetErrorHandler(func(msg string) {
+			got = append(got, msg)
+		})
+		for token := tokenizer.Token(); token != nil; token = tokenizer.Token() {
+			tokenizer.Advance()
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.src, got, test.want)
+		}
+	}
+}
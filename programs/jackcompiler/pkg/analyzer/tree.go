@@ -0,0 +1,272 @@
+package analyzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	. "jackcompiler/pkg/common"
+	"strconv"
+	"strings"
+)
+
+// Node is a node of the parse tree
+// Rules such as class or letStatement have children, tokens are leaves with Token set
+// Kind is the same as the tag used in the xml output
+type Node struct {
+	Kind     string
+	Token    *Token
+	Children []*Node
+}
+
+// TokenKinds maps each token type to the kind of its leaf node
+var TokenKinds = map[TokenType]string{
+	Keyword:         "keyword",
+	Symbol:          "symbol",
+	IntegerConstant: "integerConstant",
+	StringConstant:  "stringConstant",
+	Identifier:      "identifier",
+}
+
+// Format is an output format for the parse tree, which is also the extension of the output file
+type Format string
+
+const (
+	FormatXML   Format = "xml"
+	FormatJSON  Format = "json"
+	FormatSexpr Format = "sexpr"
+	FormatDot   Format = "dot"
+)
+
+// Formats lists every supported format
+var Formats = []Format{FormatXML, FormatJSON, FormatSexpr, FormatDot}
+
+// TreeSchemaVersion is the version of the json and sexpr output, bumped whenever their layout changes
+//
+// The json output is a single object:
+//
+//	{"schema": "jackcompiler.tree", "version": 1, "file": "Main.jack", "root": node}
+//
+// where every node is
+//
+//	{"kind": "letStatement", "span": span, "children": [node, ...]}
+//
+// and every token is
+//
+//	{"kind": "identifier", "tokenType": 4, "value": "x", "span": span}
+//
+// kind matches the xml tags, tokenType is the value of common.TokenType, and value is a number for
+// integer constants and a string otherwise (without quotes for string constants)
+// Spans are {"start": pos, "end": pos} with end just past the last byte, and positions are
+// {"offset": 0, "line": 1, "column": 1} with offset counting bytes from 0 and line and column counting from 1
+// Nodes without any tokens, such as an empty parameterList, have no span
+//
+// The sexpr output starts with a comment naming the schema and version, then holds the same tree as
+//
+//	(letStatement (keyword "let" (span 3 9 3 12)) ...)
+//
+// where spans are (span startLine startColumn endLine endColumn) and integer constants are bare numbers
+const TreeSchemaVersion = 1
+
+// WriteTree writes a parse tree to w in the given format
+// file is recorded in formats that have room for it
+func WriteTree(w io.Writer, file string, root *Node, format Format) error {
+	out := bufio.NewWriter(w)
+	switch format {
+	case FormatXML:
+		writeXML(out, root, 0)
+	case FormatJSON:
+		doc := jsonDocument{Schema: "jackcompiler.tree", Version: TreeSchemaVersion, File: file, Root: jsonTree(root)}
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+	case FormatSexpr:
+		fmt.Fprintf(out, "; jackcompiler.tree version %d %s\n", TreeSchemaVersion, strconv.Quote(file))
+		writeSexpr(out, root, 0)
+		out.WriteString("\n")
+	case FormatDot:
+		fmt.Fprintf(out, "digraph %s {\n", dotQuote(file))
+		out.WriteString("\tordering=out;\n\tnode [shape=box, fontname=\"Helvetica\"];\n")
+		id := 0
+		writeDot(out, root, &id)
+		out.WriteString("}\n")
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	return out.Flush()
+}
+
+// ParseFormat checks that name is a supported format
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, expected xml, json, sexpr, or dot", name)
+}
+
+// FindSubroutine returns the subroutineDec node of the named subroutine in a class, or nil if there isn't one
+func FindSubroutine(class *Node, name string) *Node {
+	for _, child := range class.Children {
+		if child.Kind != "subroutineDec" {
+			continue
+		}
+		// The name follows the kind and return type
+		if len(child.Children) > 2 && child.Children[2].Token != nil && child.Children[2].Token.Value() == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Value returns the text of a token as it appears in the xml output, before escaping
+func (t *Token) Value() string {
+	switch t.tokenType {
+	case Keyword:
+		return KeywordStrMap[t.keywordType]
+	case Symbol:
+		return string(t.symbol)
+	case IntegerConstant:
+		return strconv.Itoa(t.intVal)
+	case StringConstant:
+		return t.stringVal
+	}
+	return t.identifier
+}
+
+// writeXML writes a node in the same layout as the nand2tetris tools
+func writeXML(w *bufio.Writer, node *Node, indent int) {
+	tabs := strings.Repeat("\t", indent)
+	if node.Token != nil {
+		value := node.Token.Value()
+		// Only symbols are escaped, the same as the reference output
+		if node.Token.TokenType() == Symbol {
+			switch value {
+			case "<":
+				value = "&lt;"
+			case ">":
+				value = "&gt;"
+			case "&":
+				value = "&amp;"
+			}
+		}
+		w.WriteString(tabs + "<" + node.Kind + "> " + value + " </" + node.Kind + ">\n")
+		return
+	}
+
+	w.WriteString(tabs + "<" + node.Kind + ">\n")
+	for _, child := range node.Children {
+		writeXML(w, child, indent+1)
+	}
+	w.WriteString(tabs + "</" + node.Kind + ">\n")
+}
+
+// jsonDocument is the top level of the json output
+type jsonDocument struct {
+	Schema  string    `json:"schema"`
+	Version int       `json:"version"`
+	File    string    `json:"file"`
+	Root    *jsonNode `json:"root"`
+}
+
+// jsonNode is a node or token in the json output
+type jsonNode struct {
+	Kind      string      `json:"kind"`
+	TokenType *TokenType  `json:"tokenType,omitempty"`
+	Value     any         `json:"value,omitempty"`
+	Span      *jsonSpan   `json:"span,omitempty"`
+	Children  []*jsonNode `json:"children,omitempty"`
+}
+
+type jsonSpan struct {
+	Start jsonPos `json:"start"`
+	End   jsonPos `json:"end"`
+}
+
+type jsonPos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// jsonTree converts a node for the json output
+func jsonTree(node *Node) *jsonNode {
+	out := &jsonNode{Kind: node.Kind}
+	if token := node.Token; token != nil {
+		tokenType := token.TokenType()
+		out.TokenType = &tokenType
+		out.Value = token.Value()
+		if tokenType == IntegerConstant {
+			out.Value = token.IntVal()
+		}
+		out.Span = &jsonSpan{
+			Start: jsonPos{Offset: token.Offset(), Line: token.Line(), Column: token.Column()},
+			End:   jsonPos{Offset: token.Offset() + token.Length(), Line: token.Line(), Column: token.Column() + token.Length()},
+		}
+		return out
+	}
+
+	// Rules have children, so an empty list is written out rather than left off
+	out.Children = make([]*jsonNode, 0, len(node.Children))
+	for _, child := range node.Children {
+		c := jsonTree(child)
+		out.Children = append(out.Children, c)
+		if c.Span == nil {
+			continue
+		}
+		if out.Span == nil {
+			out.Span = &jsonSpan{Start: c.Span.Start}
+		}
+		out.Span.End = c.Span.End
+	}
+	return out
+}
+
+// writeSexpr writes a node as an s-expression, one rule per line
+func writeSexpr(w *bufio.Writer, node *Node, indent int) {
+	if token := node.Token; token != nil {
+		value := strconv.Quote(token.Value())
+		if token.TokenType() == IntegerConstant {
+			value = token.Value()
+		}
+		fmt.Fprintf(w, "(%s %s (span %d %d %d %d))", node.Kind, value,
+			token.Line(), token.Column(), token.Line(), token.Column()+token.Length())
+		return
+	}
+
+	w.WriteString("(" + node.Kind)
+	for _, child := range node.Children {
+		w.WriteString("\n" + strings.Repeat("  ", indent+1))
+		writeSexpr(w, child, indent+1)
+	}
+	w.WriteString(")")
+}
+
+// writeDot writes a node and everything below it as graphviz nodes and edges, numbering them from *id
+// Rules are boxes labelled with their kind, tokens are ellipses that also show their value
+func writeDot(w *bufio.Writer, node *Node, id *int) int {
+	self := *id
+	*id++
+	if node.Token != nil {
+		fmt.Fprintf(w, "\tn%d [label=%s, shape=ellipse];\n", self, dotQuote(node.Kind+"\n"+node.Token.Value()))
+		return self
+	}
+
+	fmt.Fprintf(w, "\tn%d [label=%s];\n", self, dotQuote(node.Kind))
+	for _, child := range node.Children {
+		fmt.Fprintf(w, "\tn%d -> n%d;\n", self, writeDot(w, child, id))
+	}
+	return self
+}
+
+// dotQuote quotes a string for use as a graphviz id or label
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "\n", "\\n")
+	return "\"" + s + "\""
+}
@@ -0,0 +1,175 @@
+package ast
+
+import (
+	"jackcompiler/pkg/common"
+)
+
+// Class is the root of the tree built for a single .jack file
+type Class struct {
+	Name        string
+	Vars        []*ClassVarDec
+	Subroutines []*Subroutine
+	Line        int
+}
+
+// ClassVarDec is a static or field declaration, which may declare several names of the same type
+type ClassVarDec struct {
+	Kind  common.KeywordType // Static or Field
+	Type  string
+	Names []string
+	Line  int
+}
+
+// Subroutine is a constructor, function, or method declaration
+type Subroutine struct {
+	Kind       common.KeywordType // Constructor, Function, or Method
+	ReturnType string
+	Name       string
+	Params     []*Param
+	Locals     []*VarDec
+	Body       []Statement
+	Line       int
+	Column     int
+}
+
+// Param is a single entry within a parameter list
+type Param struct {
+	Type string
+	Name string
+}
+
+// VarDec is a local variable declaration, which may declare several names of the same type
+type VarDec struct {
+	Type  string
+	Names []string
+	Line  int
+}
+
+// Statement is implemented by every statement node
+type Statement interface {
+	statementNode()
+	// StatementLine returns the line the statement starts on
+	StatementLine() int
+	// StatementColumn returns the column the statement starts at
+	StatementColumn() int
+}
+
+// Expression is implemented by every expression node
+type Expression interface {
+	expressionNode()
+}
+
+// LetStatement assigns Value to Name, or to Name[Index] if Index is not nil
+type LetStatement struct {
+	Name   string
+	Index  Expression
+	Value  Expression
+	Line   int
+	Column int
+}
+
+// IfStatement runs Then if Cond is true, otherwise Else (which may be empty)
+type IfStatement struct {
+	Cond   Expression
+	Then   []Statement
+	Else   []Statement
+	Line   int
+	Column int
+}
+
+// WhileStatement runs Body for as long as Cond is true
+type WhileStatement struct {
+	Cond   Expression
+	Body   []Statement
+	Line   int
+	Column int
+}
+
+// DoStatement calls a subroutine and throws away the result
+type DoStatement struct {
+	Call   *CallExpr
+	Line   int
+	Column int
+}
+
+// ReturnStatement returns Value, or nothing if Value is nil
+type ReturnStatement struct {
+	Value  Expression
+	Line   int
+	Column int
+}
+
+func (s *LetStatement) statementNode()    {}
+func (s *IfStatement) statementNode()     {}
+func (s *WhileStatement) statementNode()  {}
+func (s *DoStatement) statementNode()     {}
+func (s *ReturnStatement) statementNode() {}
+
+func (s *LetStatement) StatementLine() int    { return s.Line }
+func (s *IfStatement) StatementLine() int     { return s.Line }
+func (s *WhileStatement) StatementLine() int  { return s.Line }
+func (s *DoStatement) StatementLine() int     { return s.Line }
+func (s *ReturnStatement) StatementLine() int { return s.Line }
+
+func (s *LetStatement) StatementColumn() int    { return s.Column }
+func (s *IfStatement) StatementColumn() int     { return s.Column }
+func (s *WhileStatement) StatementColumn() int  { return s.Column }
+func (s *DoStatement) StatementColumn() int     { return s.Column }
+func (s *ReturnStatement) StatementColumn() int { return s.Column }
+
+// BinaryExpr applies Op to Left and Right
+// Jack has no operator precedence, so a chain of operators is built up from the left
+type BinaryExpr struct {
+	Op    rune
+	Left  Expression
+	Right Expression
+}
+
+// UnaryExpr applies Op ('-' or '~') to Operand
+type UnaryExpr struct {
+	Op      rune
+	Operand Expression
+}
+
+// IntegerConstant is an integer literal between 0 and 32767
+type IntegerConstant struct {
+	Value int
+}
+
+// StringConstant is a string literal without its quotes
+type StringConstant struct {
+	Value string
+}
+
+// KeywordConstant is one of true, false, null, or this
+type KeywordConstant struct {
+	Keyword common.KeywordType
+}
+
+// VarRef is a reference to a variable by name
+type VarRef struct {
+	Name string
+}
+
+// IndexExpr reads Name[Index]
+type IndexExpr struct {
+	Name  string
+	Index Expression
+}
+
+// CallExpr is a subroutine call
+// Receiver is empty for calls such as foo(), otherwise it is the variable or class name before the period
+type CallExpr struct {
+	Receiver string
+	Name     string
+	Args     []Expression
+}
+
+func (e *BinaryExpr) expressionNode()      {}
+func (e *UnaryExpr) expressionNode()       {}
+func (e *IntegerConstant) expressionNode() {}
+func (e *StringConstant) expressionNode()  {}
+func (e *KeywordConstant) expressionNode() {}
+func (e *VarRef) expressionNode()          {}
+func (e *IndexExpr) expressionNode()       {}
+func (e *CallExpr) expressionNode()        {}
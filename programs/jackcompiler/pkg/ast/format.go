@@ -0,0 +1,147 @@
+package ast
+
+import (
+	"bufio"
+	"io"
+	"jackcompiler/pkg/common"
+	"strconv"
+	"strings"
+)
+
+// printer writes a syntax tree back out as Jack source
+type printer struct {
+	w      *bufio.Writer
+	indent int
+}
+
+// Format writes class as Jack source that parses back into the same tree
+func Format(w io.Writer, class *Class) error {
+	p := &printer{w: bufio.NewWriter(w)}
+	p.class(class)
+	return p.w.Flush()
+}
+
+// line writes a single indented line
+func (p *printer) line(parts ...string) {
+	if len(parts) > 0 {
+		p.w.WriteString(strings.Repeat("    ", p.indent))
+	}
+	for _, part := range parts {
+		p.w.WriteString(part)
+	}
+	p.w.WriteString("\n")
+}
+
+// class writes the whole class
+func (p *printer) class(class *Class) {
+	p.line("class ", class.Name, " {")
+	p.indent++
+	for _, dec := range class.Vars {
+		p.line(common.KeywordStrMap[dec.Kind], " ", dec.Type, " ", strings.Join(dec.Names, ", "), ";")
+	}
+	for i, sub := range class.Subroutines {
+		if i > 0 || len(class.Vars) > 0 {
+			p.line()
+		}
+		p.subroutine(sub)
+	}
+	p.indent--
+	p.line("}")
+}
+
+// subroutine writes a subroutine declaration along with its body
+func (p *printer) subroutine(sub *Subroutine) {
+	params := make([]string, len(sub.Params))
+	for i, param := range sub.Params {
+		params[i] = param.Type + " " + param.Name
+	}
+	p.line(common.KeywordStrMap[sub.Kind], " ", sub.ReturnType, " ", sub.Name, "(", strings.Join(params, ", "), ") {")
+	p.indent++
+	for _, dec := range sub.Locals {
+		p.line("var ", dec.Type, " ", strings.Join(dec.Names, ", "), ";")
+	}
+	p.statements(sub.Body)
+	p.indent--
+	p.line("}")
+}
+
+// statements writes a list of statements at the current indentation
+func (p *printer) statements(statements []Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *LetStatement:
+			if s.Index == nil {
+				p.line("let ", s.Name, " = ", expression(s.Value), ";")
+			} else {
+				p.line("let ", s.Name, "[", expression(s.Index), "] = ", expression(s.Value), ";")
+			}
+		case *IfStatement:
+			p.line("if (", expression(s.Cond), ") {")
+			p.block(s.Then)
+			if s.Else != nil {
+				p.line("} else {")
+				p.block(s.Else)
+			}
+			p.line("}")
+		case *WhileStatement:
+			p.line("while (", expression(s.Cond), ") {")
+			p.block(s.Body)
+			p.line("}")
+		case *DoStatement:
+			p.line("do ", expression(s.Call), ";")
+		case *ReturnStatement:
+			if s.Value == nil {
+				p.line("return;")
+			} else {
+				p.line("return ", expression(s.Value), ";")
+			}
+		}
+	}
+}
+
+// block writes statements one level further in
+func (p *printer) block(statements []Statement) {
+	p.indent++
+	p.statements(statements)
+	p.indent--
+}
+
+// expression returns the source of an expression
+// Jack has no operator precedence, so only the right side of an operator ever needs parentheses
+func expression(expr Expression) string {
+	if e, ok := expr.(*BinaryExpr); ok {
+		return expression(e.Left) + " " + string(e.Op) + " " + term(e.Right)
+	}
+	return term(expr)
+}
+
+// term returns the source of an expression used as a single term
+func term(expr Expression) string {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		return "(" + expression(e) + ")"
+	case *UnaryExpr:
+		return string(e.Op) + term(e.Operand)
+	case *IntegerConstant:
+		return strconv.Itoa(e.Value)
+	case *StringConstant:
+		return `"` + e.Value + `"`
+	case *KeywordConstant:
+		return common.KeywordStrMap[e.Keyword]
+	case *VarRef:
+		return e.Name
+	case *IndexExpr:
+		return e.Name + "[" + expression(e.Index) + "]"
+	case *CallExpr:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = expression(arg)
+		}
+		name := e.Name
+		if e.Receiver != "" {
+			name = e.Receiver + "." + e.Name
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWriteFileAtomic checks that a write that fails partway leaves the old file as it was and no temporary
+// file behind, and that one that succeeds replaces it
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Main.vm")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want string) {
+		t.Helper()
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("Main.vm is %q, %v, want %q", got, err, want)
+		}
+		if tmp, err := filepath.Glob(filepath.Join(dir, ".*.tmp")); err != nil || len(tmp) != 0 {
+			t.Errorf("temporary files left behind: %v, %v", tmp, err)
+		}
+	}
+
+	failed := errors.New("disk full")
+	err := WriteFileAtomic(path, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "half of the n"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Errorf("got error %v, want %v", err, failed)
+	}
+	check("old\n")
+
+	err = WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new\n")
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	check("new\n")
+
+	// The directory is created when it doesn't exist yet
+	path = filepath.Join(dir, "out", "Main.vm")
+	dir = filepath.Dir(path)
+	if err := WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new\n")
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+	check("new\n")
+}
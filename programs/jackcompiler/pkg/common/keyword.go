@@ -9,6 +9,8 @@ const (
 	IntegerConstant
 	StringConstant
 	Identifier
+	// Invalid is input that isn't a token, or the end of the input
+	Invalid
 )
 
 // KeywordType is an enum for type of keyword a token has (if it is a keyword)
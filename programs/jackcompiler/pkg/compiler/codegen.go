@@ -0,0 +1,434 @@
+package compiler
+
+import (
+	"fmt"
+	"jackcompiler/pkg/ast"
+	. "jackcompiler/pkg/common"
+	"jackcompiler/pkg/vm"
+	"strconv"
+)
+
+// generator walks the syntax tree of a class and emits VM commands for it
+type generator struct {
+	class    *ast.Class
+	symbols  *SymbolTable
+	commands []vm.Command
+	opts     Options
+
+	// kinds maps the subroutines of the class to whether they are constructors, functions, or methods
+	kinds map[string]KeywordType
+
+	subroutine *ast.Subroutine
+	line       int
+	// pos is where the commands being emitted come from
+	pos        *vm.Position
+	ifCount    int
+	whileCount int
+}
+
+// binaryOps maps the operators that have a matching VM command
+var binaryOps = map[rune]vm.Op{
+	'+': vm.Add,
+	'-': vm.Sub,
+	'&': vm.And,
+	'|': vm.Or,
+	'<': vm.Lt,
+	'>': vm.Gt,
+	'=': vm.Eq,
+}
+
+// Generate compiles a class into VM commands
+func Generate(class *ast.Class) ([]vm.Command, error) {
+	return GenerateWith(class, Options{})
+}
+
+// GenerateWith compiles a class into VM commands with the given options
+func GenerateWith(class *ast.Class, opts Options) ([]vm.Command, error) {
+	g := &generator{class: class, symbols: NewSymbolTable(), kinds: make(map[string]KeywordType), opts: opts}
+
+	for _, dec := range class.Vars {
+		kind := StaticVar
+		if dec.Kind == Field {
+			kind = FieldVar
+		}
+		for _, name := range dec.Names {
+			if !g.symbols.Define(name, dec.Type, kind) {
+				return nil, g.errorf(dec.Line, "%s is already defined", name)
+			}
+		}
+	}
+
+	opts.Symbols.addClass(class.Name, g.symbols)
+
+	for _, sub := range class.Subroutines {
+		if _, ok := g.kinds[sub.Name]; ok {
+			return nil, g.errorf(sub.Line, "subroutine %s is already defined", sub.Name)
+		}
+		g.kinds[sub.Name] = sub.Kind
+	}
+
+	for _, sub := range class.Subroutines {
+		if err := g.subroutineDec(sub); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.commands, nil
+}
+
+// errorf builds an error within the class being compiled
+func (g *generator) errorf(line int, format string, args ...any) error {
+	return &Error{File: g.class.Name + ".jack", Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// emit adds a command to the output
+func (g *generator) emit(command vm.Command) {
+	command.Pos = g.pos
+	g.commands = append(g.commands, command)
+}
+
+// at sets the position of the commands emitted from now on
+func (g *generator) at(line int, column int) {
+	g.pos = &vm.Position{File: g.class.Name + ".jack", Line: line, Column: column, Subroutine: g.class.Name + "." + g.subroutine.Name}
+}
+
+// push emits a push command
+func (g *generator) push(segment vm.Segment, index int) {
+	g.emit(vm.Command{Op: vm.Push, Segment: segment, Index: index})
+}
+
+// pop emits a pop command
+func (g *generator) pop(segment vm.Segment, index int) {
+	g.emit(vm.Command{Op: vm.Pop, Segment: segment, Index: index})
+}
+
+// op emits an arithmetic or return command
+func (g *generator) op(op vm.Op) {
+	g.emit(vm.Command{Op: op})
+}
+
+// jump emits a label, goto, or if-goto command
+func (g *generator) jump(op vm.Op, label string) {
+	g.emit(vm.Command{Op: op, Name: label})
+}
+
+// call emits a call command
+func (g *generator) call(name string, nArgs int) {
+	g.emit(vm.Command{Op: vm.Call, Name: name, Index: nArgs})
+}
+
+// subroutineDec compiles a whole subroutine
+func (g *generator) subroutineDec(sub *ast.Subroutine) error {
+	g.subroutine = sub
+	g.line = sub.Line
+	g.at(sub.Line, sub.Column)
+	g.ifCount = 0
+	g.whileCount = 0
+	g.symbols.StartSubroutine()
+
+	// Methods get the object as a hidden first argument
+	if sub.Kind == Method {
+		g.symbols.Define("this", g.class.Name, ArgVar)
+	}
+	for _, param := range sub.Params {
+		if !g.symbols.Define(param.Name, param.Type, ArgVar) {
+			return g.errorf(sub.Line, "%s is already defined", param.Name)
+		}
+	}
+	for _, dec := range sub.Locals {
+		for _, name := range dec.Names {
+			if !g.symbols.Define(name, dec.Type, LocalVar) {
+				return g.errorf(dec.Line, "%s is already defined", name)
+			}
+		}
+	}
+
+	g.opts.Symbols.addSubroutine(g.class.Name+"."+sub.Name, sub.Kind, g.symbols)
+
+	g.emit(vm.Command{Op: vm.Function, Name: g.class.Name + "." + sub.Name, Index: g.symbols.Count(LocalVar)})
+
+	switch sub.Kind {
+	case Constructor:
+		// Allocate the object and anchor this to it
+		g.push(vm.Constant, g.symbols.Count(FieldVar))
+		g.call("Memory.alloc", 1)
+		g.pop(vm.Pointer, 0)
+	case Method:
+		g.push(vm.Argument, 0)
+		g.pop(vm.Pointer, 0)
+	}
+
+	return g.statements(sub.Body)
+}
+
+// statements compiles a list of statements
+func (g *generator) statements(statements []ast.Statement) error {
+	// Whatever the enclosing statement emits after these belongs to it
+	pos := g.pos
+	defer func() { g.pos = pos }()
+	for _, statement := range statements {
+		g.line = statement.StatementLine()
+		g.at(statement.StatementLine(), statement.StatementColumn())
+
+		var err error
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			err = g.letStatement(s)
+		case *ast.IfStatement:
+			err = g.ifStatement(s)
+		case *ast.WhileStatement:
+			err = g.whileStatement(s)
+		case *ast.DoStatement:
+			err = g.doStatement(s)
+		case *ast.ReturnStatement:
+			err = g.returnStatement(s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds a variable, making sure it can be used from the current subroutine
+func (g *generator) lookup(name string) (*Variable, error) {
+	symbol, ok := g.symbols.Lookup(name)
+	if !ok {
+		return nil, g.errorf(g.line, "undefined variable %s", name)
+	}
+	if symbol.Kind == FieldVar && g.subroutine.Kind == Function {
+		return nil, g.errorf(g.line, "field %s used in function %s", name, g.subroutine.Name)
+	}
+	return symbol, nil
+}
+
+// letStatement compiles a let statement
+func (g *generator) letStatement(s *ast.LetStatement) error {
+	symbol, err := g.lookup(s.Name)
+	if err != nil {
+		return err
+	}
+
+	if s.Index == nil {
+		if err := g.expression(s.Value); err != nil {
+			return err
+		}
+		g.pop(segments[symbol.Kind], symbol.Index)
+		return nil
+	}
+
+	// The value is stashed in temp 0 because evaluating it may move that
+	if err := g.expression(s.Index); err != nil {
+		return err
+	}
+	g.push(segments[symbol.Kind], symbol.Index)
+	g.op(vm.Add)
+	if err := g.expression(s.Value); err != nil {
+		return err
+	}
+	g.pop(vm.Temp, 0)
+	g.pop(vm.Pointer, 1)
+	g.push(vm.Temp, 0)
+	g.pop(vm.That, 0)
+	return nil
+}
+
+// ifStatement compiles an if statement using the same labels as the reference compiler
+func (g *generator) ifStatement(s *ast.IfStatement) error {
+	id := strconv.Itoa(g.ifCount)
+	g.ifCount++
+
+	if err := g.expression(s.Cond); err != nil {
+		return err
+	}
+	g.jump(vm.IfGoto, "IF_TRUE"+id)
+	g.jump(vm.Goto, "IF_FALSE"+id)
+	g.jump(vm.Label, "IF_TRUE"+id)
+	if err := g.statements(s.Then); err != nil {
+		return err
+	}
+
+	if s.Else == nil {
+		g.jump(vm.Label, "IF_FALSE"+id)
+		return nil
+	}
+
+	g.jump(vm.Goto, "IF_END"+id)
+	g.jump(vm.Label, "IF_FALSE"+id)
+	if err := g.statements(s.Else); err != nil {
+		return err
+	}
+	g.jump(vm.Label, "IF_END"+id)
+	return nil
+}
+
+// whileStatement compiles a while statement using the same labels as the reference compiler
+func (g *generator) whileStatement(s *ast.WhileStatement) error {
+	id := strconv.Itoa(g.whileCount)
+	g.whileCount++
+
+	g.jump(vm.Label, "WHILE_EXP"+id)
+	if err := g.expression(s.Cond); err != nil {
+		return err
+	}
+	g.op(vm.Not)
+	g.jump(vm.IfGoto, "WHILE_END"+id)
+	if err := g.statements(s.Body); err != nil {
+		return err
+	}
+	g.jump(vm.Goto, "WHILE_EXP"+id)
+	g.jump(vm.Label, "WHILE_END"+id)
+	return nil
+}
+
+// doStatement compiles a do statement, throwing the return value away
+func (g *generator) doStatement(s *ast.DoStatement) error {
+	if err := g.callExpr(s.Call); err != nil {
+		return err
+	}
+	g.pop(vm.Temp, 0)
+	return nil
+}
+
+// returnStatement compiles a return statement, void subroutines return 0
+func (g *generator) returnStatement(s *ast.ReturnStatement) error {
+	if s.Value == nil {
+		g.push(vm.Constant, 0)
+	} else if err := g.expression(s.Value); err != nil {
+		return err
+	}
+	g.op(vm.Return)
+	return nil
+}
+
+// expression compiles an expression, leaving its value on the stack
+func (g *generator) expression(expr ast.Expression) error {
+	if g.opts.Optimize >= 1 {
+		if value, ok := constantValue(expr); ok {
+			g.constant(value)
+			return nil
+		}
+		if simpler := simplify(expr); simpler != expr {
+			return g.expression(simpler)
+		}
+	}
+
+	switch e := expr.(type) {
+	case *ast.IntegerConstant:
+		g.push(vm.Constant, e.Value)
+	case *ast.StringConstant:
+		g.push(vm.Constant, len(e.Value))
+		g.call("String.new", 1)
+		for _, c := range []byte(e.Value) {
+			g.push(vm.Constant, int(c))
+			g.call("String.appendChar", 2)
+		}
+	case *ast.KeywordConstant:
+		switch e.Keyword {
+		case True:
+			g.push(vm.Constant, 0)
+			g.op(vm.Not)
+		case False, Null:
+			g.push(vm.Constant, 0)
+		case This:
+			if g.subroutine.Kind == Function {
+				return g.errorf(g.line, "this used in function %s", g.subroutine.Name)
+			}
+			g.push(vm.Pointer, 0)
+		}
+	case *ast.VarRef:
+		symbol, err := g.lookup(e.Name)
+		if err != nil {
+			return err
+		}
+		g.push(segments[symbol.Kind], symbol.Index)
+	case *ast.IndexExpr:
+		symbol, err := g.lookup(e.Name)
+		if err != nil {
+			return err
+		}
+		if err := g.expression(e.Index); err != nil {
+			return err
+		}
+		g.push(segments[symbol.Kind], symbol.Index)
+		g.op(vm.Add)
+		g.pop(vm.Pointer, 1)
+		g.push(vm.That, 0)
+	case *ast.CallExpr:
+		return g.callExpr(e)
+	case *ast.UnaryExpr:
+		if err := g.expression(e.Operand); err != nil {
+			return err
+		}
+		if e.Op == '-' {
+			g.op(vm.Neg)
+		} else {
+			g.op(vm.Not)
+		}
+	case *ast.BinaryExpr:
+		if g.opts.Optimize >= 1 && e.Op == '*' {
+			if operand, doublings, ok := powerOfTwoProduct(e); ok {
+				return g.doubled(operand, doublings)
+			}
+		}
+		if err := g.expression(e.Left); err != nil {
+			return err
+		}
+		if err := g.expression(e.Right); err != nil {
+			return err
+		}
+		switch e.Op {
+		case '*':
+			g.call("Math.multiply", 2)
+		case '/':
+			g.call("Math.divide", 2)
+		default:
+			g.op(binaryOps[e.Op])
+		}
+	}
+	return nil
+}
+
+// callExpr compiles a subroutine call, working out whether it is a method call
+func (g *generator) callExpr(e *ast.CallExpr) error {
+	nArgs := len(e.Args)
+	var name string
+
+	if e.Receiver == "" {
+		// Calls without a receiver refer to this class, and methods need this passed along
+		kind, ok := g.kinds[e.Name]
+		if !ok {
+			return g.errorf(g.line, "undefined subroutine %s.%s", g.class.Name, e.Name)
+		}
+		if kind == Method {
+			if g.subroutine.Kind == Function {
+				return g.errorf(g.line, "method %s called from function %s", e.Name, g.subroutine.Name)
+			}
+			g.push(vm.Pointer, 0)
+			nArgs++
+		}
+		name = g.class.Name + "." + e.Name
+	} else if symbol, ok := g.symbols.Lookup(e.Receiver); ok {
+		// Calling a method on an object stored in a variable
+		if _, err := g.lookup(e.Receiver); err != nil {
+			return err
+		}
+		if symbol.Type == "int" || symbol.Type == "char" || symbol.Type == "boolean" {
+			return g.errorf(g.line, "%s.%s called on %s, which is not an object", e.Receiver, e.Name, symbol.Type)
+		}
+		g.push(segments[symbol.Kind], symbol.Index)
+		nArgs++
+		name = symbol.Type + "." + e.Name
+	} else {
+		// Otherwise the receiver is a class name
+		name = e.Receiver + "." + e.Name
+	}
+
+	for _, arg := range e.Args {
+		if err := g.expression(arg); err != nil {
+			return err
+		}
+	}
+	g.call(name, nArgs)
+	return nil
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSourcePositions checks that every command and instruction compiled from Jack knows where it came from,
+// and that code a compound statement emits after its body belongs to the statement itself
+func TestSourcePositions(t *testing.T) {
+	code := `class Main {
+    function void main() {
+        var int x;
+        let x = 1;
+        while (x < 10) {
+            let x = x + 1;
+        }
+        return;
+    }
+}
+`
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Main.jack"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, level := range []int{0, 1} {
+		opts := Options{Optimize: level}
+		files, err := CompileProgramWith(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			for i, command := range file.Commands {
+				if command.Pos == nil {
+					t.Fatalf("-O%d: command %d of %s, %s, has no position", level, i, file.Name, command)
+				}
+			}
+		}
+
+		lines := make(map[string]int)
+		for _, command := range files[0].Commands {
+			lines[command.String()] = command.Pos.Line
+			if command.Pos.File != "Main.jack" || command.Pos.Subroutine != "Main.main" {
+				t.Errorf("-O%d: %s comes from %s in %s", level, command, command.Pos, command.Pos.Subroutine)
+			}
+		}
+		want := map[string]int{"function Main.main 1": 2, "push constant 10": 5, "add": 6, "return": 8}
+		for command, line := range want {
+			if lines[command] != line {
+				t.Errorf("-O%d: %s comes from line %d, want %d", level, command, lines[command], line)
+			}
+		}
+		for command, line := range lines {
+			if strings.HasPrefix(command, "goto") && line != 5 {
+				t.Errorf("-O%d: %s comes from line %d, want the while statement on line 5", level, command, line)
+			}
+		}
+
+		asm, positions, err := CompileProgramAsm(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		limits := 0
+		for i, line := range asm {
+			pos := positions[i]
+			if pos == nil || pos.File != "Main.jack" {
+				continue
+			}
+			if line == "(Main.main)" && pos.Line != 2 {
+				t.Errorf("-O%d: Main.main starts at %s, want line 2", level, pos)
+			}
+			if line == "@10" {
+				limits++
+				if pos.Line != 5 {
+					t.Errorf("-O%d: the loop limit comes from %s, want line 5", level, pos)
+				}
+			}
+		}
+		if limits != 1 {
+			t.Errorf("-O%d: found the loop limit %d times in the assembly for Main.jack, want once", level, limits)
+		}
+	}
+}
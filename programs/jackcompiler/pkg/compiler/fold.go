@@ -0,0 +1,196 @@
+package compiler
+
+import (
+	"jackcompiler/pkg/ast"
+	. "jackcompiler/pkg/common"
+	"jackcompiler/pkg/vm"
+)
+
+// These are the optimizations made to expressions at -O1
+// Constant expressions are worked out with the same 16 bit wraparound as the VM, and products and quotients
+// give the same answers as the OS's Math.multiply and Math.divide, so a program that brings its own Math class
+// may behave differently once optimized. Products with a power of two become additions, but quotients still
+// call Math.divide since the VM has no way of shifting right
+
+// constantValue works out the value of an expression made up only of constants
+// Division by zero is left for the program to report when it runs
+func constantValue(expr ast.Expression) (int16, bool) {
+	switch e := expr.(type) {
+	case *ast.IntegerConstant:
+		return int16(e.Value), true
+	case *ast.KeywordConstant:
+		switch e.Keyword {
+		case True:
+			return -1, true
+		case False, Null:
+			return 0, true
+		}
+	case *ast.UnaryExpr:
+		value, ok := constantValue(e.Operand)
+		if !ok {
+			return 0, false
+		}
+		if e.Op == '-' {
+			return -value, true
+		}
+		return ^value, true
+	case *ast.BinaryExpr:
+		x, ok := constantValue(e.Left)
+		if !ok {
+			return 0, false
+		}
+		y, ok := constantValue(e.Right)
+		if !ok {
+			return 0, false
+		}
+		switch e.Op {
+		case '+':
+			return x + y, true
+		case '-':
+			return x - y, true
+		case '*':
+			return x * y, true
+		case '/':
+			if y == 0 {
+				return 0, false
+			}
+			return divide(x, y), true
+		case '&':
+			return x & y, true
+		case '|':
+			return x | y, true
+		case '<':
+			return boolValue(x < y), true
+		case '>':
+			return boolValue(x > y), true
+		case '=':
+			return boolValue(x == y), true
+		}
+	}
+	return 0, false
+}
+
+// boolValue converts a Go boolean to Jack's true (-1) and false (0)
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
+
+// divide divides the same way as Math.divide, which rounds towards zero
+// and gives 0 for -32768 since its absolute value doesn't fit
+func divide(x int16, y int16) int16 {
+	q := dividePositive(abs(x), abs(y))
+	if (x < 0) == (y < 0) {
+		return q
+	}
+	return -q
+}
+
+// abs returns the absolute value the same way as Math.abs
+func abs(x int16) int16 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// dividePositive is Math.dividePositive, y going negative means doubling it overflowed
+func dividePositive(x int16, y int16) int16 {
+	if y > x || y < 0 {
+		return 0
+	}
+	q := dividePositive(x, y+y)
+	q += q
+	if x-q*y < y {
+		return q
+	}
+	return q + 1
+}
+
+// constant pushes a value, negative values are pushed as the complement of a constant just like true
+func (g *generator) constant(value int16) {
+	if value >= 0 {
+		g.push(vm.Constant, int(value))
+		return
+	}
+	g.push(vm.Constant, int(^value))
+	g.op(vm.Not)
+}
+
+// simplify rewrites an expression into a cheaper one that gives the same value, returning expr if it can't
+// Only constants are ever thrown away, so every call in the expression still happens, in the same order
+// x / 1 is left alone because Math.divide gives 0 for -32768 / 1
+func simplify(expr ast.Expression) ast.Expression {
+	switch e := expr.(type) {
+	case *ast.UnaryExpr:
+		// ~~x and -(-x)
+		if inner, ok := e.Operand.(*ast.UnaryExpr); ok && inner.Op == e.Op {
+			return inner.Operand
+		}
+	case *ast.BinaryExpr:
+		if y, ok := constantValue(e.Right); ok {
+			switch {
+			case y == 0 && (e.Op == '+' || e.Op == '-' || e.Op == '|'):
+				return e.Left
+			case y == 1 && e.Op == '*':
+				return e.Left
+			}
+		}
+		if x, ok := constantValue(e.Left); ok {
+			switch {
+			case x == 0 && (e.Op == '+' || e.Op == '|'):
+				return e.Right
+			case x == 0 && e.Op == '-':
+				return &ast.UnaryExpr{Op: '-', Operand: e.Right}
+			case x == 1 && e.Op == '*':
+				return e.Right
+			}
+		}
+	}
+	return expr
+}
+
+// powerOfTwoProduct checks for a product where one side is a constant power of two,
+// returning the other side and how many times it has to be doubled
+func powerOfTwoProduct(e *ast.BinaryExpr) (ast.Expression, int, bool) {
+	if y, ok := constantValue(e.Right); ok {
+		if n, ok := log2(y); ok {
+			return e.Left, n, true
+		}
+	}
+	if x, ok := constantValue(e.Left); ok {
+		if n, ok := log2(x); ok {
+			return e.Right, n, true
+		}
+	}
+	return nil, 0, false
+}
+
+// log2 returns n for values that are 2 to the power of n
+func log2(value int16) (int, bool) {
+	if value <= 0 || value&(value-1) != 0 {
+		return 0, false
+	}
+	n := 0
+	for ; value > 1; value >>= 1 {
+		n++
+	}
+	return n, true
+}
+
+// doubled compiles operand multiplied by 2 to the power of n as a chain of additions
+// The VM can't duplicate the top of the stack, so the value goes through temp 1 each time
+func (g *generator) doubled(operand ast.Expression, n int) error {
+	if err := g.expression(operand); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		g.pop(vm.Temp, 1)
+		g.push(vm.Temp, 1)
+		g.push(vm.Temp, 1)
+		g.op(vm.Add)
+	}
+	return nil
+}
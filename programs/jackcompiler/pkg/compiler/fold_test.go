@@ -0,0 +1,115 @@
+package compiler
+
+import (
+	"bytes"
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/vm"
+	"strings"
+	"testing"
+)
+
+// foldSource wraps an expression in a function that returns it, with x as a local
+func foldSource(expr string) string {
+	return "class Main {\n    function int f() {\n        var int x;\n        return " + expr + ";\n    }\n}\n"
+}
+
+// TestConstantValue checks that constant expressions are worked out with the VM's 16 bit arithmetic and the
+// OS's division, and that division by zero and expressions with variables are left alone
+func TestConstantValue(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value int16
+		ok    bool
+	}{
+		{"2 * 8 + 1", 17, true},
+		{"32767 + 1", -32768, true},
+		{"-32767 - 2", 32767, true},
+		{"200 * 200", -25536, true},
+		{"256 * 256", 0, true},
+		{"-32767 - 1 * 2", 0, true},
+		// Math.divide can't take the absolute value of -32768, so these come out as 0
+		{"(-32767 - 1) / -1", 0, true},
+		{"(-32767 - 1) / 2", 0, true},
+		{"-7 / 2", -3, true},
+		{"7 / -2", -3, true},
+		{"~0", -1, true},
+		{"-(~5)", 6, true},
+		{"(1 < 2) & (3 > 2)", -1, true},
+		{"null = false", -1, true},
+		{"7 / 0", 0, false},
+		{"1 + (7 / 0)", 0, false},
+		{"x * 1", 0, false},
+		{"0 - x", 0, false},
+	}
+	for _, test := range tests {
+		class, err := Parse("Main.jack", foldSource(test.expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr := class.Subroutines[0].Body[0].(*ast.ReturnStatement).Value
+		value, ok := constantValue(expr)
+		if ok != test.ok || value != test.value {
+			t.Errorf("%s = %d, %v, want %d, %v", test.expr, value, ok, test.value, test.ok)
+		}
+	}
+}
+
+// TestDivide checks that folded quotients round towards zero like Go's, apart from -32768
+func TestDivide(t *testing.T) {
+	values := []int16{-32767, -1000, -7, -2, -1, 1, 2, 3, 7, 1000, 16384, 32767}
+	for _, x := range values {
+		for _, y := range values {
+			if got := divide(x, y); got != x/y {
+				t.Errorf("%d / %d = %d, want %d", x, y, got, x/y)
+			}
+		}
+		if got := divide(-32768, x); got != 0 {
+			t.Errorf("-32768 / %d = %d, want 0 like Math.divide", x, got)
+		}
+	}
+}
+
+// TestConstantFolding checks the code generated for expressions that -O1 simplifies
+func TestConstantFolding(t *testing.T) {
+	double := "\npop temp 1\npush temp 1\npush temp 1\nadd"
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"2 * 8 + 1", "push constant 17"},
+		{"32767 + 1", "push constant 32767\nnot"},
+		{"-7 / 2", "push constant 2\nnot"},
+		{"(-32767 - 1) / -1", "push constant 0"},
+		{"~~x", "push local 0"},
+		{"-(-x)", "push local 0"},
+		{"x + 0", "push local 0"},
+		{"x * 1", "push local 0"},
+		{"1 * x", "push local 0"},
+		{"0 - x", "push local 0\nneg"},
+		{"x - 0", "push local 0"},
+		{"x * 4", "push local 0" + double + double},
+		{"16384 * x", "push local 0" + strings.Repeat(double, 14)},
+		// -32768 is 2 to the 15 in 16 bits, but it isn't treated as a power of two
+		{"x * (-32767 - 1)", "push local 0\npush constant 32767\nnot\ncall Math.multiply 2"},
+		{"x / 4", "push local 0\npush constant 4\ncall Math.divide 2"},
+		// Math.divide gives 0 for -32768 / 1, so dividing by 1 isn't the same as doing nothing
+		{"x / 1", "push local 0\npush constant 1\ncall Math.divide 2"},
+		// Division by zero has to happen when the program runs, for the error it reports
+		{"7 / 0", "push constant 7\npush constant 0\ncall Math.divide 2"},
+	}
+	for _, test := range tests {
+		file, err := CompileWith("Main.jack", foldSource(test.expr), Options{Optimize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := vm.Write(&buf, file.Commands); err != nil {
+			t.Fatal(err)
+		}
+		// Leave out the function declaration and the return
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if got := strings.Join(lines[1:len(lines)-1], "\n"); got != test.want {
+			t.Errorf("%s compiles to\n%s\nwant\n%s", test.expr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,648 @@
+package compiler
+
+import (
+	"jackcompiler/pkg/ast"
+	. "jackcompiler/pkg/common"
+	"jackcompiler/pkg/vm"
+	"strconv"
+)
+
+// The native backend compiles Jack straight to Hack assembly instead of going through the VM
+// Expressions are worked out in D, with simple operands read straight from memory through A, and values that
+// have to wait for the other side of an operator are kept in R5-R12 as long as nothing is called in between,
+// since a call could reuse them. Everything else goes on the stack
+//
+// Frames are laid out as the arguments, the return address, the caller's LCL and THIS, and then the locals,
+// with LCL pointing at the first local. Return values come back in D. Setting up and tearing down a frame is
+// done by routines shared by every subroutine, the same as comparisons
+
+// The registers native code keeps temporaries in, and how far variables can be from a pointer
+const (
+	firstTemporary = 5
+	lastTemporary  = 12
+	// maxIncrements is how far from a pointer a variable can be while still being reached without using D
+	maxIncrements = 6
+)
+
+// native compiles the subroutines of a whole program to assembly
+type native struct {
+	opts    Options
+	class   *ast.Class
+	symbols *SymbolTable
+	kinds   map[string]KeywordType
+
+	sub      *ast.Subroutine
+	function string
+	nArgs    int
+	labels   int
+	// temporaries is the number of R5-R12 holding values
+	temporaries int
+	// returns is set once a return statement has jumped to the end of the subroutine
+	returns bool
+
+	out []string
+	// positions holds where each line of out came from, and pos where the lines being emitted come from
+	positions []*vm.Position
+	pos       *vm.Position
+	calls     map[string]bool
+}
+
+// chunk is the assembly of a single subroutine along with the subroutines it calls
+type chunk struct {
+	name      string
+	code      []string
+	positions []*vm.Position
+	calls     map[string]bool
+}
+
+// place is where a variable lives, either at a symbol or at an offset from the address held by a pointer
+type place struct {
+	symbol string
+	base   string
+	offset int
+}
+
+// GenerateAsm compiles a whole program to Hack assembly that boots by calling Sys.init, returning the lines of
+// assembly along with where in the source each one came from, which is nil for the code shared by the program
+// classes must hold every class the program uses, including the OS, and have already been checked by Generate
+// Subroutines that can't be reached from Sys.init are left out
+func GenerateAsm(classes []*ast.Class, opts Options) ([]string, []*vm.Position) {
+	var chunks []*chunk
+	for _, class := range classes {
+		n := &native{opts: opts, class: class, symbols: NewSymbolTable(), kinds: make(map[string]KeywordType)}
+		for _, dec := range class.Vars {
+			kind := StaticVar
+			if dec.Kind == Field {
+				kind = FieldVar
+			}
+			for _, name := range dec.Names {
+				n.symbols.Define(name, dec.Type, kind)
+			}
+		}
+		for _, sub := range class.Subroutines {
+			n.kinds[sub.Name] = sub.Kind
+		}
+		for _, sub := range class.Subroutines {
+			chunks = append(chunks, n.subroutine(sub))
+		}
+	}
+
+	// Only keep what Sys.init ends up calling
+	byName := make(map[string]*chunk)
+	for _, c := range chunks {
+		byName[c.name] = c
+	}
+	reached := map[string]bool{"Sys.init": true}
+	queue := []string{"Sys.init"}
+	for len(queue) > 0 {
+		c, ok := byName[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		for callee := range c.calls {
+			if !reached[callee] {
+				reached[callee] = true
+				queue = append(queue, callee)
+			}
+		}
+	}
+
+	out := runtime()
+	positions := make([]*vm.Position, len(out))
+	for _, c := range chunks {
+		if reached[c.name] {
+			out = append(out, c.code...)
+			positions = append(positions, c.positions...)
+		}
+	}
+	return out, positions
+}
+
+// runtime returns the bootstrap code and the routines shared by the whole program
+// $ENTER expects the return address in R13, the number of locals in R14, and where to carry on in D
+// $LEAVE expects the return value in R13 and the number of arguments plus 3 in D
+// $LT expects its operands in R13 and R14 and the return address in D, and leaves R13 < R14 in D
+func runtime() []string {
+	push := []string{"@SP", "AM=M+1", "A=A-1", "M=D"}
+	out := []string{"@256", "D=A", "@SP", "M=D", "@$HALT", "D=A", "@Sys.init", "0;JMP", "($HALT)", "@$HALT", "0;JMP"}
+
+	out = append(out, "($ENTER)", "@R15", "M=D", "@R13", "D=M")
+	out = append(out, push...)
+	out = append(out, "@LCL", "D=M")
+	out = append(out, push...)
+	out = append(out, "@THIS", "D=M")
+	out = append(out, push...)
+	out = append(out, "@SP", "D=M", "@LCL", "M=D")
+	out = append(out, "($ENTER$LOOP)", "@R14", "MD=M-1", "@$ENTER$DONE", "D;JLT", "@SP", "AM=M+1", "A=A-1", "M=0", "@$ENTER$LOOP", "0;JMP")
+	out = append(out, "($ENTER$DONE)", "@R15", "A=M", "0;JMP")
+
+	out = append(out, "($LEAVE)", "@R14", "M=D", "@LCL", "D=M", "@R15", "M=D", "@R14", "D=D-M", "@SP", "M=D")
+	out = append(out, "@R15", "A=M-1", "D=M", "@THIS", "M=D")
+	out = append(out, "@R15", "A=M-1", "A=A-1", "D=M", "@LCL", "M=D")
+	out = append(out, "@R15", "A=M-1", "A=A-1", "A=A-1", "D=M", "@R14", "M=D")
+	out = append(out, "@R13", "D=M", "@R14", "A=M", "0;JMP")
+
+	// Values of different signs are decided by their signs alone, since subtracting them may overflow
+	out = append(out, "($LT)", "@R15", "M=D", "@R13", "D=M", "@$LT$NEGATIVE", "D;JLT")
+	out = append(out, "@R14", "D=M", "@$FALSE", "D;JLT", "@$LT$SAME", "0;JMP")
+	out = append(out, "($LT$NEGATIVE)", "@R14", "D=M", "@$TRUE", "D;JGE")
+	out = append(out, "($LT$SAME)", "@R14", "D=M", "@R13", "D=M-D", "@$TRUE", "D;JLT")
+	out = append(out, "($FALSE)", "D=0", "@R15", "A=M", "0;JMP")
+	out = append(out, "($TRUE)", "D=-1", "@R15", "A=M", "0;JMP")
+	return out
+}
+
+// emit adds lines of assembly to the output
+func (n *native) emit(lines ...string) {
+	n.out = append(n.out, lines...)
+	for range lines {
+		n.positions = append(n.positions, n.pos)
+	}
+}
+
+// at sets the position of the lines emitted from now on
+func (n *native) at(line int, column int) {
+	n.pos = &vm.Position{File: n.class.Name + ".jack", Line: line, Column: column, Subroutine: n.function}
+}
+
+// label makes up a new label within the current subroutine
+func (n *native) label(what string) string {
+	n.labels++
+	return n.function + "$" + what + strconv.Itoa(n.labels)
+}
+
+// pushD pushes the D register
+func (n *native) pushD() {
+	n.emit("@SP", "AM=M+1", "A=A-1", "M=D")
+}
+
+// call calls a subroutine whose arguments have been pushed, leaving its return value in D
+// Sys.halt never returns, and ending up in the loop the program halts in is all it does
+func (n *native) call(name string) {
+	if name == "Sys.halt" {
+		n.emit("@$HALT", "0;JMP")
+		return
+	}
+	ret := n.label("RET")
+	n.emit("@"+ret, "D=A", "@"+name, "0;JMP", "("+ret+")")
+	n.calls[name] = true
+}
+
+// subroutine compiles a subroutine into its own chunk
+func (n *native) subroutine(sub *ast.Subroutine) *chunk {
+	n.sub = sub
+	n.function = n.class.Name + "." + sub.Name
+	n.labels = 0
+	n.returns = false
+	n.out = nil
+	n.positions = nil
+	n.at(sub.Line, sub.Column)
+	n.calls = make(map[string]bool)
+	n.symbols.StartSubroutine()
+	if sub.Kind == Method {
+		n.symbols.Define("this", n.class.Name, ArgVar)
+	}
+	for _, param := range sub.Params {
+		n.symbols.Define(param.Name, param.Type, ArgVar)
+	}
+	for _, dec := range sub.Locals {
+		for _, name := range dec.Names {
+			n.symbols.Define(name, dec.Type, LocalVar)
+		}
+	}
+	n.nArgs = n.symbols.Count(ArgVar)
+
+	body := n.function + "$BODY"
+	n.emit("("+n.function+")", "@R13", "M=D")
+	n.loadConstant(int16(n.symbols.Count(LocalVar)))
+	n.emit("@R14", "M=D", "@"+body, "D=A", "@$ENTER", "0;JMP", "("+body+")")
+	switch sub.Kind {
+	case Constructor:
+		n.loadConstant(int16(n.symbols.Count(FieldVar)))
+		n.pushD()
+		n.call("Memory.alloc")
+		n.emit("@THIS", "M=D")
+	case Method:
+		n.load(n.place(n.lookup("this")))
+		n.emit("@THIS", "M=D")
+	}
+
+	n.statements(sub.Body)
+	// A body ending in a return has its value in D already
+	if len(sub.Body) == 0 {
+		n.emit("D=0")
+	} else if _, ok := sub.Body[len(sub.Body)-1].(*ast.ReturnStatement); !ok {
+		n.emit("D=0")
+	}
+	if n.returns {
+		n.emit("(" + n.function + "$RETURN)")
+	}
+	n.emit("@R13", "M=D")
+	n.loadConstant(int16(n.nArgs + 3))
+	n.emit("@$LEAVE", "0;JMP")
+	return &chunk{name: n.function, code: n.out, positions: n.positions, calls: n.calls}
+}
+
+// lookup finds a variable, which Generate has already made sure exists
+func (n *native) lookup(name string) *Variable {
+	symbol, _ := n.symbols.Lookup(name)
+	return symbol
+}
+
+// place works out where a variable lives
+func (n *native) place(symbol *Variable) place {
+	switch symbol.Kind {
+	case StaticVar:
+		// static makes sure the name can't be the same as a subroutine's
+		return place{symbol: n.class.Name + ".static." + symbol.Name}
+	case FieldVar:
+		return place{base: "THIS", offset: symbol.Index}
+	case ArgVar:
+		return place{base: "LCL", offset: symbol.Index - n.nArgs - 3}
+	}
+	return place{base: "LCL", offset: symbol.Index}
+}
+
+// address points A at a place without touching D, returning false if that would take too many instructions
+func (n *native) address(p place) ([]string, bool) {
+	if p.symbol != "" {
+		return []string{"@" + p.symbol}, true
+	}
+	if p.offset > maxIncrements || p.offset < -maxIncrements {
+		return nil, false
+	}
+	lines := []string{"@" + p.base, "A=M"}
+	for i := 0; i < p.offset; i++ {
+		lines = append(lines, "A=A+1")
+	}
+	for i := 0; i > p.offset; i-- {
+		lines = append(lines, "A=A-1")
+	}
+	return lines, true
+}
+
+// load loads the value at a place into D
+func (n *native) load(p place) {
+	if lines, ok := n.address(p); ok && (p.symbol != "" || p.offset <= 2 && p.offset >= -2) {
+		n.emit(lines...)
+		n.emit("D=M")
+		return
+	}
+	if p.offset > 0 {
+		n.emit("@"+strconv.Itoa(p.offset), "D=A", "@"+p.base, "A=D+M", "D=M")
+	} else {
+		n.emit("@"+strconv.Itoa(-p.offset), "D=A", "@"+p.base, "A=M-D", "D=M")
+	}
+}
+
+// store stores D at a place
+func (n *native) store(p place) {
+	if lines, ok := n.address(p); ok {
+		n.emit(lines...)
+		n.emit("M=D")
+		return
+	}
+	n.emit("@R13", "M=D")
+	if p.offset > 0 {
+		n.emit("@"+strconv.Itoa(p.offset), "D=A", "@"+p.base, "D=D+M")
+	} else {
+		n.emit("@"+strconv.Itoa(-p.offset), "D=A", "@"+p.base, "D=M-D")
+	}
+	n.emit("@R14", "M=D", "@R13", "D=M", "@R14", "A=M", "M=D")
+}
+
+// loadConstant loads a constant into D
+func (n *native) loadConstant(value int16) {
+	switch {
+	case value == 0 || value == 1 || value == -1:
+		n.emit("D=" + strconv.Itoa(int(value)))
+	case value > 0:
+		n.emit("@"+strconv.Itoa(int(value)), "D=A")
+	default:
+		n.emit("@"+strconv.Itoa(int(^value)), "D=!A")
+	}
+}
+
+// statements compiles a list of statements
+func (n *native) statements(statements []ast.Statement) {
+	// Whatever the enclosing statement emits after these belongs to it
+	pos := n.pos
+	defer func() { n.pos = pos }()
+	for _, statement := range statements {
+		n.at(statement.StatementLine(), statement.StatementColumn())
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			n.letStatement(s)
+		case *ast.IfStatement:
+			n.ifStatement(s)
+		case *ast.WhileStatement:
+			n.whileStatement(s)
+		case *ast.DoStatement:
+			n.callExpr(s.Call)
+		case *ast.ReturnStatement:
+			if s.Value == nil {
+				n.emit("D=0")
+			} else {
+				n.expression(s.Value)
+			}
+			// The last statement of the body falls through to the end
+			if s != n.sub.Body[len(n.sub.Body)-1] {
+				n.emit("@"+n.function+"$RETURN", "0;JMP")
+				n.returns = true
+			}
+		}
+	}
+}
+
+// letStatement compiles a let statement
+func (n *native) letStatement(s *ast.LetStatement) {
+	p := n.place(n.lookup(s.Name))
+	if s.Index == nil {
+		n.expression(s.Value)
+		n.store(p)
+		return
+	}
+
+	// The element's address is worked out before the value, the same order as the VM code
+	n.expression(s.Index)
+	if lines, ok := n.address(p); ok {
+		n.emit(lines...)
+		n.emit("D=D+M")
+	} else {
+		n.emit("@R13", "M=D")
+		n.load(p)
+		n.emit("@R13", "D=D+M")
+	}
+	n.hold(s.Value, func() {
+		n.expression(s.Value)
+	}, func(temporary string) {
+		if temporary == "" {
+			n.emit("@SP", "AM=M-1", "A=M", "M=D")
+		} else {
+			n.emit("@"+temporary, "A=M", "M=D")
+		}
+	})
+}
+
+// hold keeps D somewhere while evaluate runs, then calls use with the register it is in,
+// or "" if it is on top of the stack
+// Registers are only used when nothing in later can call a subroutine that might use the same register
+func (n *native) hold(later ast.Expression, evaluate func(), use func(temporary string)) {
+	if hasCall(later) || firstTemporary+n.temporaries > lastTemporary {
+		n.pushD()
+		evaluate()
+		use("")
+		return
+	}
+	temporary := "R" + strconv.Itoa(firstTemporary+n.temporaries)
+	n.emit("@"+temporary, "M=D")
+	n.temporaries++
+	evaluate()
+	n.temporaries--
+	use(temporary)
+}
+
+// hasCall checks whether evaluating an expression may call a subroutine
+func hasCall(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.CallExpr, *ast.StringConstant:
+		return true
+	case *ast.IndexExpr:
+		return hasCall(e.Index)
+	case *ast.UnaryExpr:
+		return hasCall(e.Operand)
+	case *ast.BinaryExpr:
+		return e.Op == '*' || e.Op == '/' || hasCall(e.Left) || hasCall(e.Right)
+	}
+	return false
+}
+
+// ifStatement compiles an if statement
+func (n *native) ifStatement(s *ast.IfStatement) {
+	elseLabel, end := n.label("ELSE"), n.label("END")
+	n.expression(s.Cond)
+	n.emit("@"+elseLabel, "D;JEQ")
+	n.statements(s.Then)
+	if s.Else == nil {
+		n.emit("(" + elseLabel + ")")
+		return
+	}
+	n.emit("@"+end, "0;JMP", "("+elseLabel+")")
+	n.statements(s.Else)
+	n.emit("(" + end + ")")
+}
+
+// whileStatement compiles a while statement
+func (n *native) whileStatement(s *ast.WhileStatement) {
+	top, end := n.label("WHILE"), n.label("END")
+	n.emit("(" + top + ")")
+	n.expression(s.Cond)
+	n.emit("@"+end, "D;JEQ")
+	n.statements(s.Body)
+	n.emit("@"+top, "0;JMP", "("+end+")")
+}
+
+// operand returns the instructions that make a simple expression available without touching D,
+// along with whether its value ends up in A or M
+func (n *native) operand(expr ast.Expression) ([]string, string, bool) {
+	switch e := expr.(type) {
+	case *ast.IntegerConstant:
+		return []string{"@" + strconv.Itoa(e.Value)}, "A", true
+	case *ast.KeywordConstant:
+		switch e.Keyword {
+		case True:
+			return []string{"A=-1"}, "A", true
+		case False, Null:
+			return []string{"A=0"}, "A", true
+		case This:
+			return []string{"@THIS"}, "M", true
+		}
+	case *ast.VarRef:
+		if lines, ok := n.address(n.place(n.lookup(e.Name))); ok {
+			return lines, "M", true
+		}
+	}
+	return nil, "", false
+}
+
+// binaryComps maps operators to the computation that combines D with the right operand in A or M,
+// where the right operand is written as X
+var binaryComps = map[rune]string{
+	'+': "D+X",
+	'-': "D-X",
+	'&': "D&X",
+	'|': "D|X",
+	'=': "D-X",
+}
+
+// heldComps maps operators to the computation that combines a held left operand in M with the right one in D
+var heldComps = map[rune]string{
+	'+': "D+M",
+	'-': "M-D",
+	'&': "D&M",
+	'|': "D|M",
+	'=': "M-D",
+}
+
+// expression compiles an expression, leaving its value in D
+func (n *native) expression(expr ast.Expression) {
+	if n.opts.Optimize >= 1 {
+		if value, ok := constantValue(expr); ok {
+			n.loadConstant(value)
+			return
+		}
+		if simpler := simplify(expr); simpler != expr {
+			n.expression(simpler)
+			return
+		}
+	}
+
+	switch e := expr.(type) {
+	case *ast.IntegerConstant:
+		n.loadConstant(int16(e.Value))
+	case *ast.StringConstant:
+		n.loadConstant(int16(len(e.Value)))
+		n.pushD()
+		n.call("String.new")
+		for _, c := range []byte(e.Value) {
+			n.pushD()
+			n.loadConstant(int16(c))
+			n.pushD()
+			n.call("String.appendChar")
+		}
+	case *ast.KeywordConstant:
+		switch e.Keyword {
+		case True:
+			n.emit("D=-1")
+		case False, Null:
+			n.emit("D=0")
+		case This:
+			n.emit("@THIS", "D=M")
+		}
+	case *ast.VarRef:
+		n.load(n.place(n.lookup(e.Name)))
+	case *ast.IndexExpr:
+		n.expression(e.Index)
+		p := n.place(n.lookup(e.Name))
+		if lines, ok := n.address(p); ok {
+			n.emit(lines...)
+		} else {
+			n.emit("@R13", "M=D")
+			n.load(p)
+			n.emit("@R13")
+		}
+		n.emit("A=D+M", "D=M")
+	case *ast.CallExpr:
+		n.callExpr(e)
+	case *ast.UnaryExpr:
+		n.expression(e.Operand)
+		if e.Op == '-' {
+			n.emit("D=-D")
+		} else {
+			n.emit("D=!D")
+		}
+	case *ast.BinaryExpr:
+		n.binaryExpr(e)
+	}
+}
+
+// binaryExpr compiles an operator along with its operands
+func (n *native) binaryExpr(e *ast.BinaryExpr) {
+	if n.opts.Optimize >= 1 && e.Op == '*' {
+		if operand, doublings, ok := powerOfTwoProduct(e); ok {
+			n.expression(operand)
+			// Hack can't add D to itself, so it goes through A
+			for i := 0; i < doublings; i++ {
+				n.emit("A=D", "D=D+A")
+			}
+			return
+		}
+	}
+
+	n.expression(e.Left)
+	switch e.Op {
+	case '*', '/':
+		n.pushD()
+		n.expression(e.Right)
+		n.pushD()
+		if e.Op == '*' {
+			n.call("Math.multiply")
+		} else {
+			n.call("Math.divide")
+		}
+		return
+	case '<', '>':
+		// The left operand goes in R13 for < and R14 for >, since x > y is y < x
+		left, right := "@R13", "@R14"
+		if e.Op == '>' {
+			left, right = right, left
+		}
+		if lines, src, ok := n.operand(e.Right); ok {
+			n.emit(left, "M=D")
+			n.emit(lines...)
+			n.emit("D="+src, right, "M=D")
+		} else {
+			n.hold(e.Right, func() {
+				n.expression(e.Right)
+			}, func(temporary string) {
+				n.emit(right, "M=D")
+				if temporary == "" {
+					n.emit("@SP", "AM=M-1", "D=M")
+				} else {
+					n.emit("@"+temporary, "D=M")
+				}
+				n.emit(left, "M=D")
+			})
+		}
+		ret := n.label("RET")
+		n.emit("@"+ret, "D=A", "@$LT", "0;JMP", "("+ret+")")
+		return
+	}
+
+	if lines, src, ok := n.operand(e.Right); ok {
+		n.emit(lines...)
+		comp := binaryComps[e.Op]
+		n.emit("D=" + comp[:2] + src)
+	} else {
+		n.hold(e.Right, func() {
+			n.expression(e.Right)
+		}, func(temporary string) {
+			if temporary == "" {
+				n.emit("@SP", "AM=M-1")
+			} else {
+				n.emit("@" + temporary)
+			}
+			n.emit("D=" + heldComps[e.Op])
+		})
+	}
+	if e.Op == '=' {
+		// D is 0 exactly when the operands are equal
+		equal, end := n.label("EQ"), n.label("END")
+		n.emit("@"+equal, "D;JEQ", "D=0", "@"+end, "0;JMP", "("+equal+")", "D=-1", "("+end+")")
+	}
+}
+
+// callExpr compiles a subroutine call, leaving the return value in D
+func (n *native) callExpr(e *ast.CallExpr) {
+	var name string
+	if e.Receiver == "" {
+		if n.kinds[e.Name] == Method {
+			n.emit("@THIS", "D=M")
+			n.pushD()
+		}
+		name = n.class.Name + "." + e.Name
+	} else if symbol, ok := n.symbols.Lookup(e.Receiver); ok {
+		n.load(n.place(symbol))
+		n.pushD()
+		name = symbol.Type + "." + e.Name
+	} else {
+		name = e.Receiver + "." + e.Name
+	}
+
+	for _, arg := range e.Args {
+		n.expression(arg)
+		n.pushD()
+	}
+	n.call(name)
+}
@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/hack"
+	"strings"
+	"testing"
+)
+
+// nativeSys is a program that needs nothing from the OS, it reads its inputs from 7000 onwards
+// and writes its results from 8000 onwards
+const nativeSys = `class Sys {
+    function void init() {
+        var Array in, out;
+        var Obj a, b;
+        var int i, o;
+        let in = 7000;
+        let out = 8000;
+        while (i < 16) {
+            let out[o] = in[i] < in[i + 1];
+            let out[o + 1] = in[i] > in[i + 1];
+            let out[o + 2] = in[i] = in[i + 1];
+            let i = i + 2;
+            let o = o + 3;
+        }
+
+        let out[30] = Sys.sum(10);
+        let out[31] = Sys.dirty();
+        let out[32] = Sys.fresh();
+        let out[33] = Sys.args(1, 2, 3);
+        let a = 9000;
+        let b = 9010;
+        do a.set(3);
+        do b.set(4);
+        do a.swap(b);
+        let out[34] = a.get();
+        let out[35] = b.get();
+        let out[36] = Sys.temps(in[20], in[21], in[22]);
+        return;
+    }
+
+    function int sum(int n) {
+        if (n = 0) {
+            return 0;
+        }
+        return n + Sys.sum(n - 1);
+    }
+
+    function int dirty() {
+        var int a, b, c;
+        let a = 111;
+        let b = 222;
+        let c = 333;
+        return a + b + c;
+    }
+
+    function int fresh() {
+        var int a, b, c;
+        return a | b | c;
+    }
+
+    function int args(int a, int b, int c) {
+        return a - b - c;
+    }
+
+    function int deep(int p, int q, int r) {
+        return p - (q - (r - (p - (q - (r - (p - (q - (r - (p - q)))))))));
+    }
+
+    function int temps(int p, int q, int r) {
+        return (p - (q - r)) - Sys.deep(r, q, p);
+    }
+}
+`
+
+// nativeObj is a class of objects placed by hand, since there is no Memory.alloc
+const nativeObj = `class Obj {
+    field int x;
+
+    method void set(int v) {
+        let x = v;
+        return;
+    }
+
+    method int get() {
+        return x;
+    }
+
+    method void swap(Obj other) {
+        var int t;
+        let t = other.get();
+        do other.set(x);
+        let x = t;
+        return;
+    }
+}
+`
+
+// runNative compiles classes with the native backend and runs them until they halt, with input copied to 7000
+func runNative(t *testing.T, opts Options, input []int16, sources ...string) (*hack.CPU, []string) {
+	t.Helper()
+	var classes []*ast.Class
+	for _, source := range sources {
+		class, err := Parse("Class.jack", source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := GenerateWith(class, opts); err != nil {
+			t.Fatal(err)
+		}
+		classes = append(classes, class)
+	}
+	asm, _ := GenerateAsm(classes, opts)
+	program, err := hack.Assemble("Program.asm", strings.NewReader(strings.Join(asm, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := hack.NewCPU(program)
+	copy(cpu.RAM[7000:], input)
+	for !cpu.Looping() && cpu.Steps() < 1000000 {
+		cpu.Step()
+	}
+	if !cpu.Looping() {
+		t.Fatalf("still running after %d instructions", cpu.Steps())
+	}
+	return cpu, asm
+}
+
+// TestNative checks comparisons that overflow when subtracted, setting up and tearing down frames,
+// and the values held in R5-R12 while an expression is worked out
+func TestNative(t *testing.T) {
+	pairs := [][2]int16{{-32767, 32767}, {32767, -32767}, {-32768, 1}, {1, -32768}, {-2, 32767}, {20000, -20000}, {5, 5}, {-1, 0}}
+	var input []int16
+	for _, pair := range pairs {
+		input = append(input, pair[0], pair[1])
+	}
+	input = append(input, make([]int16, 20-len(input))...)
+	input = append(input, 7, -300, 12345)
+	p, q, r := input[20], input[21], input[22]
+	deep := r - (q - (p - (r - (q - (p - (r - (q - (p - (r - q)))))))))
+
+	for _, level := range []int{0, 1} {
+		cpu, asm := runNative(t, Options{Optimize: level}, input, nativeSys, nativeObj)
+		truth := map[bool]int16{false: 0, true: -1}
+		for i, pair := range pairs {
+			got := cpu.RAM[8000+i*3 : 8000+i*3+3]
+			want := []int16{truth[pair[0] < pair[1]], truth[pair[0] > pair[1]], truth[pair[0] == pair[1]]}
+			for k, op := range []string{"<", ">", "="} {
+				if got[k] != want[k] {
+					t.Errorf("-O%d: %d %s %d = %d, want %d", level, pair[0], op, pair[1], got[k], want[k])
+				}
+			}
+		}
+
+		want := map[int]int16{
+			30: 55,
+			31: 666,
+			// The locals left behind by dirty are cleared for fresh
+			32: 0,
+			33: -4,
+			// a had to get its THIS back after calling b
+			34: 4,
+			35: 3,
+			36: (p - (q - r)) - deep,
+		}
+		for addr, value := range want {
+			if got := cpu.RAM[8000+addr]; got != value {
+				t.Errorf("-O%d: RAM[%d] = %d, want %d", level, 8000+addr, got, value)
+			}
+		}
+		// Sys.init's frame is gone once it has returned
+		if sp := cpu.RAM[0]; sp != 256 {
+			t.Errorf("-O%d: SP = %d after halting, want 256", level, sp)
+		}
+
+		// deep nests further than there are registers, so it needs all of them and then the stack
+		code := strings.Join(asm, "\n")
+		if !strings.Contains(code, "@R5\n") || !strings.Contains(code, "@R12\n") {
+			t.Errorf("-O%d: R5-R12 aren't used to hold values", level)
+		}
+	}
+}
@@ -0,0 +1,644 @@
+package compiler
+
+import (
+	"fmt"
+	"jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/ast"
+	. "jackcompiler/pkg/common"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Error is a problem found while compiling a .jack file
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// parser builds the syntax tree of a class from the tokenizer's output
+// It is a separate front end from the analyzer's Engine, which writes the xml, so the two have to agree on what is
+// valid Jack: FuzzParsers in pkg/analyzer checks that they accept and reject the same inputs
+type parser struct {
+	file      string
+	tokenizer *analyzer.Tokenizer
+	token     *analyzer.Token
+	// lexMsg is the first thing the tokenizer couldn't read, parsing stops there as if the file had ended
+	lexMsg string
+	lexErr error
+	depth  int
+}
+
+// maxNesting is how deeply terms and statements can be nested, which keeps hostile input from exhausting the stack
+const maxNesting = 1000
+
+// ParseFile parses a .jack file into a class
+func ParseFile(path string) (*ast.Class, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(filepath.Base(path), string(contents))
+}
+
+// Parse parses the contents of a .jack file into a class
+// file is only used for error messages
+func Parse(file string, contents string) (*ast.Class, error) {
+	p := &parser{file: file, tokenizer: analyzer.NewStringTokenizer(contents)}
+	p.tokenizer.SetErrorHandler(func(msg string) {
+		if p.lexMsg == "" {
+			p.lexMsg = msg
+		}
+	})
+	p.next()
+
+	class, err := p.parseClass()
+	if p.lexErr != nil {
+		return nil, p.lexErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing should come after the class
+	if p.token != nil {
+		return nil, p.errorf("unexpected %s after end of class", describe(p.token))
+	}
+	return class, nil
+}
+
+// errorf builds an error at the current token
+func (p *parser) errorf(format string, args ...any) error {
+	line := 0
+	if p.token != nil {
+		line = p.token.Line()
+	}
+	return &Error{File: p.file, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// expected builds an error saying what we wanted instead of the current token
+func (p *parser) expected(what string) error {
+	if p.token == nil {
+		return p.errorf("expected %s, got end of file", what)
+	}
+	return p.errorf("expected %s, got %s", what, describe(p.token))
+}
+
+// describe returns a human readable version of a token for error messages
+func describe(token *analyzer.Token) string {
+	switch token.TokenType() {
+	case Keyword:
+		return "keyword '" + KeywordStrMap[token.KeywordType()] + "'"
+	case Symbol:
+		return "'" + string(token.Symbol()) + "'"
+	case IntegerConstant:
+		return "integer " + strconv.Itoa(token.IntVal())
+	case StringConstant:
+		return "string \"" + token.StringVal() + "\""
+	}
+	return "identifier '" + token.Identifier() + "'"
+}
+
+// line returns the line of the current token
+func (p *parser) line() int {
+	if p.token == nil {
+		return 0
+	}
+	return p.token.Line()
+}
+
+// column returns the column of the current token
+func (p *parser) column() int {
+	if p.token == nil {
+		return 0
+	}
+	return p.token.Column()
+}
+
+// next reads the current token from the tokenizer, stopping at the first thing that isn't a token
+func (p *parser) next() {
+	p.token = p.tokenizer.Token()
+	if p.lexMsg != "" && p.lexErr == nil {
+		p.lexErr = &Error{File: p.file, Line: p.token.Line(), Msg: p.lexMsg}
+	}
+	if p.lexErr != nil {
+		p.token = nil
+	}
+}
+
+// enter goes a level deeper, failing once the input is nested past maxNesting
+// Every successful call needs a matching leave
+func (p *parser) enter() error {
+	if p.depth >= maxNesting {
+		return p.errorf("nested too deeply")
+	}
+	p.depth++
+	return nil
+}
+
+// leave comes back out of a level entered with enter
+func (p *parser) leave() {
+	p.depth--
+}
+
+// advance moves on to the next token
+func (p *parser) advance() {
+	p.tokenizer.Advance()
+	p.next()
+}
+
+// isKeyword returns true if the current token is one of the given keywords
+func (p *parser) isKeyword(keywords ...KeywordType) bool {
+	if p.token == nil || p.token.TokenType() != Keyword {
+		return false
+	}
+	for _, keyword := range keywords {
+		if p.token.KeywordType() == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// isSymbol returns true if the current token is the given symbol
+func (p *parser) isSymbol(symbol rune) bool {
+	return p.token != nil && p.token.TokenType() == Symbol && p.token.Symbol() == symbol
+}
+
+// expectSymbol eats the given symbol
+func (p *parser) expectSymbol(symbol rune) error {
+	if !p.isSymbol(symbol) {
+		return p.expected("'" + string(symbol) + "'")
+	}
+	p.advance()
+	return nil
+}
+
+// expectIdentifier eats an identifier and returns it
+func (p *parser) expectIdentifier(what string) (string, error) {
+	if p.token == nil || p.token.TokenType() != Identifier {
+		return "", p.expected(what)
+	}
+	name := p.token.Identifier()
+	p.advance()
+	return name, nil
+}
+
+// expectType eats a type (int, char, boolean, or a class name) and returns it
+// void is allowed only when allowVoid is set
+func (p *parser) expectType(allowVoid bool) (string, error) {
+	if p.isKeyword(Int, Char, Boolean) || (allowVoid && p.isKeyword(Void)) {
+		name := KeywordStrMap[p.token.KeywordType()]
+		p.advance()
+		return name, nil
+	}
+	return p.expectIdentifier("type")
+}
+
+// parseClass parses 'class' className '{' classVarDec* subroutineDec* '}'
+func (p *parser) parseClass() (*ast.Class, error) {
+	class := &ast.Class{Line: p.line()}
+	if !p.isKeyword(Class) {
+		return nil, p.expected("keyword 'class'")
+	}
+	p.advance()
+
+	var err error
+	if class.Name, err = p.expectIdentifier("class name"); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol('{'); err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword(Static, Field) {
+		dec, err := p.parseClassVarDec()
+		if err != nil {
+			return nil, err
+		}
+		class.Vars = append(class.Vars, dec)
+	}
+
+	for p.isKeyword(Constructor, Function, Method) {
+		sub, err := p.parseSubroutine()
+		if err != nil {
+			return nil, err
+		}
+		class.Subroutines = append(class.Subroutines, sub)
+	}
+
+	if err := p.expectSymbol('}'); err != nil {
+		return nil, err
+	}
+	return class, nil
+}
+
+// parseNames parses varName (',' varName)* ';'
+func (p *parser) parseNames() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.expectIdentifier("variable name")
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+
+		if !p.isSymbol(',') {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectSymbol(';'); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// parseClassVarDec parses ('static' | 'field') type varName (',' varName)* ';'
+func (p *parser) parseClassVarDec() (*ast.ClassVarDec, error) {
+	dec := &ast.ClassVarDec{Kind: p.token.KeywordType(), Line: p.line()}
+	p.advance()
+
+	var err error
+	if dec.Type, err = p.expectType(false); err != nil {
+		return nil, err
+	}
+	if dec.Names, err = p.parseNames(); err != nil {
+		return nil, err
+	}
+	return dec, nil
+}
+
+// parseSubroutine parses a whole subroutine declaration including its body
+func (p *parser) parseSubroutine() (*ast.Subroutine, error) {
+	sub := &ast.Subroutine{Kind: p.token.KeywordType(), Line: p.line(), Column: p.column()}
+	p.advance()
+
+	var err error
+	if sub.ReturnType, err = p.expectType(true); err != nil {
+		return nil, err
+	}
+	if sub.Name, err = p.expectIdentifier("subroutine name"); err != nil {
+		return nil, err
+	}
+
+	// Parameter list
+	if err := p.expectSymbol('('); err != nil {
+		return nil, err
+	}
+	for !p.isSymbol(')') {
+		param := &ast.Param{}
+		if param.Type, err = p.expectType(false); err != nil {
+			return nil, err
+		}
+		if param.Name, err = p.expectIdentifier("parameter name"); err != nil {
+			return nil, err
+		}
+		sub.Params = append(sub.Params, param)
+
+		if !p.isSymbol(',') {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectSymbol(')'); err != nil {
+		return nil, err
+	}
+
+	// Body
+	if err := p.expectSymbol('{'); err != nil {
+		return nil, err
+	}
+	for p.isKeyword(Var) {
+		dec := &ast.VarDec{Line: p.line()}
+		p.advance()
+		if dec.Type, err = p.expectType(false); err != nil {
+			return nil, err
+		}
+		if dec.Names, err = p.parseNames(); err != nil {
+			return nil, err
+		}
+		sub.Locals = append(sub.Locals, dec)
+	}
+	if sub.Body, err = p.parseStatements(); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol('}'); err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// parseStatements parses statements until something that can't start a statement is found
+func (p *parser) parseStatements() ([]ast.Statement, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	statements := make([]ast.Statement, 0)
+	for {
+		var statement ast.Statement
+		var err error
+
+		switch {
+		case p.isKeyword(Let):
+			statement, err = p.parseLet()
+		case p.isKeyword(If):
+			statement, err = p.parseIf()
+		case p.isKeyword(While):
+			statement, err = p.parseWhile()
+		case p.isKeyword(Do):
+			statement, err = p.parseDo()
+		case p.isKeyword(Return):
+			statement, err = p.parseReturn()
+		default:
+			// Whatever comes next has to be the closing brace of the block
+			if !p.isSymbol('}') {
+				return nil, p.expected("statement or '}'")
+			}
+			return statements, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+	}
+}
+
+// parseBlock parses '{' statements '}'
+func (p *parser) parseBlock() ([]ast.Statement, error) {
+	if err := p.expectSymbol('{'); err != nil {
+		return nil, err
+	}
+	statements, err := p.parseStatements()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol('}'); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// parseCondition parses '(' expression ')'
+func (p *parser) parseCondition() (ast.Expression, error) {
+	if err := p.expectSymbol('('); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(')'); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+// parseLet parses 'let' varName ('[' expression ']')? '=' expression ';'
+func (p *parser) parseLet() (*ast.LetStatement, error) {
+	statement := &ast.LetStatement{Line: p.line(), Column: p.column()}
+	p.advance()
+
+	var err error
+	if statement.Name, err = p.expectIdentifier("variable name"); err != nil {
+		return nil, err
+	}
+
+	if p.isSymbol('[') {
+		p.advance()
+		if statement.Index, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(']'); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectSymbol('='); err != nil {
+		return nil, err
+	}
+	if statement.Value, err = p.parseExpression(); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(';'); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseIf parses 'if' '(' expression ')' '{' statements '}' ('else' '{' statements '}')?
+func (p *parser) parseIf() (*ast.IfStatement, error) {
+	statement := &ast.IfStatement{Line: p.line(), Column: p.column()}
+	p.advance()
+
+	var err error
+	if statement.Cond, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if statement.Then, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	if p.isKeyword(Else) {
+		p.advance()
+		if statement.Else, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	return statement, nil
+}
+
+// parseWhile parses 'while' '(' expression ')' '{' statements '}'
+func (p *parser) parseWhile() (*ast.WhileStatement, error) {
+	statement := &ast.WhileStatement{Line: p.line(), Column: p.column()}
+	p.advance()
+
+	var err error
+	if statement.Cond, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if statement.Body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseDo parses 'do' subroutineCall ';'
+func (p *parser) parseDo() (*ast.DoStatement, error) {
+	statement := &ast.DoStatement{Line: p.line(), Column: p.column()}
+	p.advance()
+
+	name, err := p.expectIdentifier("subroutine name")
+	if err != nil {
+		return nil, err
+	}
+	if statement.Call, err = p.parseCall(name); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(';'); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseReturn parses 'return' expression? ';'
+func (p *parser) parseReturn() (*ast.ReturnStatement, error) {
+	statement := &ast.ReturnStatement{Line: p.line(), Column: p.column()}
+	p.advance()
+
+	if !p.isSymbol(';') {
+		var err error
+		if statement.Value, err = p.parseExpression(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectSymbol(';'); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// parseCall parses the rest of a subroutine call once its first identifier has been eaten
+func (p *parser) parseCall(first string) (*ast.CallExpr, error) {
+	call := &ast.CallExpr{Name: first}
+
+	if p.isSymbol('.') {
+		p.advance()
+		call.Receiver = first
+
+		var err error
+		if call.Name, err = p.expectIdentifier("subroutine name"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectSymbol('('); err != nil {
+		return nil, err
+	}
+	call.Args = make([]ast.Expression, 0)
+	// Once there is a comma another argument has to follow it
+	for len(call.Args) > 0 || !p.isSymbol(')') {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		if !p.isSymbol(',') {
+			break
+		}
+		p.advance()
+	}
+	if err := p.expectSymbol(')'); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// parseExpression parses term (op term)*
+func (p *parser) parseExpression() (ast.Expression, error) {
+	expr, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.token != nil && p.token.IsOperator() {
+		op := p.token.Symbol()
+		p.advance()
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		expr = &ast.BinaryExpr{Op: op, Left: expr, Right: right}
+	}
+	return expr, nil
+}
+
+// parseTerm parses a single term of an expression
+func (p *parser) parseTerm() (ast.Expression, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if p.token == nil {
+		return nil, p.expected("term")
+	}
+
+	switch p.token.TokenType() {
+	case IntegerConstant:
+		value := p.token.IntVal()
+		if value > 32767 {
+			return nil, p.errorf("integer constant %d is too large", value)
+		}
+		p.advance()
+		return &ast.IntegerConstant{Value: value}, nil
+	case StringConstant:
+		value := p.token.StringVal()
+		p.advance()
+		return &ast.StringConstant{Value: value}, nil
+	case Keyword:
+		if !p.isKeyword(True, False, Null, This) {
+			return nil, p.expected("term")
+		}
+		keyword := p.token.KeywordType()
+		p.advance()
+		return &ast.KeywordConstant{Keyword: keyword}, nil
+	case Identifier:
+		name := p.token.Identifier()
+		p.advance()
+
+		if p.isSymbol('[') {
+			p.advance()
+			index, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(']'); err != nil {
+				return nil, err
+			}
+			return &ast.IndexExpr{Name: name, Index: index}, nil
+		}
+		if p.isSymbol('(') || p.isSymbol('.') {
+			return p.parseCall(name)
+		}
+		return &ast.VarRef{Name: name}, nil
+	}
+
+	// Otherwise we need a symbol that starts a term
+	switch {
+	case p.isSymbol('('):
+		p.advance()
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(')'); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	case p.isSymbol('-'), p.isSymbol('~'):
+		op := p.token.Symbol()
+		p.advance()
+		operand, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.UnaryExpr{Op: op, Operand: operand}, nil
+	}
+
+	return nil, p.expected("term")
+}
@@ -0,0 +1,196 @@
+package compiler
+
+import (
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/jackos"
+	"jackcompiler/pkg/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Options controls the code the compiler generates
+type Options struct {
+	// Optimize is the optimization level, 0 generates the same code as the reference compiler
+	// and 1 simplifies expressions and then runs the peephole optimizer over the VM code
+	Optimize int
+	// Stats collects what the peephole optimizer did to every class compiled with these options, if it isn't nil
+	Stats *vm.OptStats
+	// Symbols collects the variables of every class compiled with these options, if it isn't nil
+	Symbols *Symbols
+}
+
+// CompileFile parses and compiles a single .jack file
+func CompileFile(path string) (*vm.File, error) {
+	return CompileFileWith(path, Options{})
+}
+
+// CompileFileWith parses and compiles a single .jack file with the given options
+func CompileFileWith(path string, opts Options) (*vm.File, error) {
+	class, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return compileClass(filepath.Base(path), class, opts)
+}
+
+// Compile parses and compiles the contents of a .jack file
+// file is the name of the file, which must match the class it declares
+func Compile(file string, contents string) (*vm.File, error) {
+	return CompileWith(file, contents, Options{})
+}
+
+// CompileWith parses and compiles the contents of a .jack file with the given options
+func CompileWith(file string, contents string, opts Options) (*vm.File, error) {
+	class, err := Parse(file, contents)
+	if err != nil {
+		return nil, err
+	}
+	return compileClass(file, class, opts)
+}
+
+// compileClass generates the VM file for a parsed class, checking that the class matches its file name
+func compileClass(file string, class *ast.Class, opts Options) (*vm.File, error) {
+	if name := strings.TrimSuffix(file, ".jack"); name != class.Name {
+		return nil, &Error{File: file, Line: class.Line, Msg: "class " + class.Name + " must be declared in " + class.Name + ".jack"}
+	}
+	commands, err := GenerateWith(class, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Optimize >= 1 {
+		commands = vm.Optimize(commands, opts.Stats)
+	}
+	return &vm.File{Name: class.Name, Commands: commands}, nil
+}
+
+// CompileProgram compiles the .jack file or directory of .jack files at inputPath,
+// then links in every OS class that the program doesn't define itself
+func CompileProgram(inputPath string) ([]*vm.File, error) {
+	return CompileProgramWith(inputPath, Options{})
+}
+
+// CompileProgramWith compiles a program and the OS classes it uses with the given options
+func CompileProgramWith(inputPath string, opts Options) ([]*vm.File, error) {
+	jackFiles, err := programFiles(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*vm.File, 0, len(jackFiles))
+	for _, jackFile := range jackFiles {
+		file, err := CompileFileWith(jackFile, opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return LinkOSWith(files, opts)
+}
+
+// programFiles lists the .jack files of the program at inputPath in order
+func programFiles(inputPath string) ([]string, error) {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	jackFiles := make([]string, 0)
+	if info.IsDir() {
+		entries, err := os.ReadDir(inputPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jack") {
+				jackFiles = append(jackFiles, filepath.Join(inputPath, entry.Name()))
+			}
+		}
+	} else {
+		jackFiles = append(jackFiles, inputPath)
+	}
+	sort.Strings(jackFiles)
+	return jackFiles, nil
+}
+
+// CompileProgramAsm compiles the program at inputPath along with the OS classes it uses straight to Hack assembly,
+// returning the lines of assembly along with where in the source each one came from
+func CompileProgramAsm(inputPath string, opts Options) ([]string, []*vm.Position, error) {
+	jackFiles, err := programFiles(inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	classes := make([]*ast.Class, 0, len(jackFiles)+len(jackos.Classes))
+	defined := make(map[string]bool)
+	for _, jackFile := range jackFiles {
+		class, err := ParseFile(jackFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		classes = append(classes, class)
+		defined[class.Name] = true
+	}
+	for _, name := range jackos.Classes {
+		if defined[name] {
+			continue
+		}
+		contents, err := jackos.FS.ReadFile(name + ".jack")
+		if err != nil {
+			return nil, nil, err
+		}
+		class, err := Parse(name+".jack", string(contents))
+		if err != nil {
+			return nil, nil, err
+		}
+		classes = append(classes, class)
+	}
+
+	// The VM code generator does all the checking, so the native one doesn't have to
+	for i, class := range classes {
+		file := class.Name + ".jack"
+		if i < len(jackFiles) {
+			file = filepath.Base(jackFiles[i])
+		}
+		if _, err := compileClass(file, class, Options{}); err != nil {
+			return nil, nil, err
+		}
+	}
+	lines, positions := GenerateAsm(classes, opts)
+	return lines, positions, nil
+}
+
+// LinkOS appends the compiled OS classes that aren't already part of the program
+func LinkOS(files []*vm.File) ([]*vm.File, error) {
+	return LinkOSWith(files, Options{})
+}
+
+// LinkOSWith appends the OS classes that aren't already part of the program, compiled with the given options
+func LinkOSWith(files []*vm.File, opts Options) ([]*vm.File, error) {
+	defined := make(map[string]bool)
+	for _, file := range files {
+		defined[file.Name] = true
+	}
+
+	for _, name := range jackos.Classes {
+		if defined[name] {
+			continue
+		}
+		contents, err := jackos.FS.ReadFile(name + ".jack")
+		if err != nil {
+			return nil, err
+		}
+		class, err := Parse(name+".jack", string(contents))
+		if err != nil {
+			return nil, err
+		}
+		file, err := compileClass(name+".jack", class, opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,77 @@
+package compiler
+
+import (
+	"jackcompiler/pkg/ast"
+)
+
+// References returns the names a class might refer to another class by, which are the types it declares
+// variables and subroutines with and the receivers of the calls it makes
+// Receivers that are variables are included as well, so the names have to be checked against the classes of
+// the program
+func References(class *ast.Class) map[string]bool {
+	refs := make(map[string]bool)
+	for _, dec := range class.Vars {
+		refs[dec.Type] = true
+	}
+	for _, sub := range class.Subroutines {
+		refs[sub.ReturnType] = true
+		for _, param := range sub.Params {
+			refs[param.Type] = true
+		}
+		for _, dec := range sub.Locals {
+			refs[dec.Type] = true
+		}
+		referencedBy(sub.Body, refs)
+	}
+	delete(refs, class.Name)
+	return refs
+}
+
+// referencedBy adds the receivers of the calls made by statements to refs
+func referencedBy(statements []ast.Statement, refs map[string]bool) {
+	var expression func(expr ast.Expression)
+	call := func(e *ast.CallExpr) {
+		if e.Receiver != "" {
+			refs[e.Receiver] = true
+		}
+		for _, arg := range e.Args {
+			expression(arg)
+		}
+	}
+	expression = func(expr ast.Expression) {
+		switch e := expr.(type) {
+		case *ast.BinaryExpr:
+			expression(e.Left)
+			expression(e.Right)
+		case *ast.UnaryExpr:
+			expression(e.Operand)
+		case *ast.IndexExpr:
+			expression(e.Index)
+		case *ast.CallExpr:
+			call(e)
+		}
+	}
+
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			if s.Index != nil {
+				expression(s.Index)
+			}
+			expression(s.Value)
+		case *ast.IfStatement:
+			expression(s.Cond)
+			referencedBy(s.Then, refs)
+			referencedBy(s.Else, refs)
+		case *ast.WhileStatement:
+			expression(s.Cond)
+			referencedBy(s.Body, refs)
+		case *ast.DoStatement:
+			call(s.Call)
+		case *ast.ReturnStatement:
+			if s.Value != nil {
+				expression(s.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestReferences checks that types and call receivers are found anywhere in a class, leaving out the class itself
+func TestReferences(t *testing.T) {
+	class, err := Parse("Board.jack", `class Board {
+    field Array cells;
+    static Board current;
+
+    method Block at(Point p, int i) {
+        var Square s;
+        if (i < 0) {
+            do Output.printInt(Math.abs(i));
+        } else {
+            while (~(s = null)) {
+                let cells[Utils.index(p)] = -Memory.peek(i);
+            }
+        }
+        return Block.new(s.size());
+    }
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"Array": true, "Block": true, "Point": true, "int": true, "Square": true,
+		"Output": true, "Math": true, "Utils": true, "Memory": true,
+		// s is a variable, but it can't tell
+		"s": true,
+	}
+	if got := References(class); !reflect.DeepEqual(got, want) {
+		t.Errorf("references %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package compiler
+
+import (
+	. "jackcompiler/pkg/common"
+	"jackcompiler/pkg/vm"
+	"sort"
+)
+
+// VarKind is an enum for where a variable lives
+type VarKind int
+
+const (
+	StaticVar VarKind = iota
+	FieldVar
+	ArgVar
+	LocalVar
+)
+
+// segments maps each kind of variable to the VM segment that holds it
+var segments = map[VarKind]vm.Segment{
+	StaticVar: vm.Static,
+	FieldVar:  vm.This,
+	ArgVar:    vm.Argument,
+	LocalVar:  vm.Local,
+}
+
+// Variable is a variable that is in scope along with where it lives
+type Variable struct {
+	Name  string
+	Type  string
+	Kind  VarKind
+	Index int
+}
+
+// SymbolTable tracks the variables of a class and of the subroutine currently being compiled
+type SymbolTable struct {
+	class      map[string]*Variable
+	subroutine map[string]*Variable
+	counts     map[VarKind]int
+}
+
+// NewSymbolTable constructs an empty symbol table
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		class:      make(map[string]*Variable),
+		subroutine: make(map[string]*Variable),
+		counts:     make(map[VarKind]int),
+	}
+}
+
+// StartSubroutine throws away the previous subroutine's arguments and locals
+func (s *SymbolTable) StartSubroutine() {
+	s.subroutine = make(map[string]*Variable)
+	s.counts[ArgVar] = 0
+	s.counts[LocalVar] = 0
+}
+
+// Define adds a variable to the table, returning false if the name is already taken in the same scope
+func (s *SymbolTable) Define(name string, typ string, kind VarKind) bool {
+	scope := s.subroutine
+	if kind == StaticVar || kind == FieldVar {
+		scope = s.class
+	}
+	if _, ok := scope[name]; ok {
+		return false
+	}
+
+	scope[name] = &Variable{Name: name, Type: typ, Kind: kind, Index: s.counts[kind]}
+	s.counts[kind]++
+	return true
+}
+
+// Count returns the number of variables of the given kind that have been defined
+func (s *SymbolTable) Count(kind VarKind) int {
+	return s.counts[kind]
+}
+
+// Lookup finds a variable, checking the subroutine's scope before the class's
+func (s *SymbolTable) Lookup(name string) (*Variable, bool) {
+	if symbol, ok := s.subroutine[name]; ok {
+		return symbol, true
+	}
+	symbol, ok := s.class[name]
+	return symbol, ok
+}
+
+// variables returns the variables in a scope ordered by kind and then index
+func variables(scope map[string]*Variable) []*Variable {
+	vars := make([]*Variable, 0, len(scope))
+	for _, symbol := range scope {
+		vars = append(vars, symbol)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		if vars[i].Kind != vars[j].Kind {
+			return vars[i].Kind < vars[j].Kind
+		}
+		return vars[i].Index < vars[j].Index
+	})
+	return vars
+}
+
+// Symbols collects the variables of every class and subroutine compiled with the options holding it,
+// so tools such as the debugger can find variables by name
+type Symbols struct {
+	// Classes maps class names to their static and field variables
+	Classes map[string][]*Variable
+	// Subroutines maps full subroutine names, such as Board.draw, to their arguments and locals
+	Subroutines map[string]*SubroutineSymbols
+}
+
+// SubroutineSymbols is what a subroutine is along with its arguments and locals, this included for methods
+type SubroutineSymbols struct {
+	Kind      KeywordType
+	Variables []*Variable
+}
+
+// addClass records the class variables in table
+func (s *Symbols) addClass(name string, table *SymbolTable) {
+	if s == nil {
+		return
+	}
+	if s.Classes == nil {
+		s.Classes = make(map[string][]*Variable)
+	}
+	s.Classes[name] = variables(table.class)
+}
+
+// addSubroutine records the arguments and locals in table
+func (s *Symbols) addSubroutine(name string, kind KeywordType, table *SymbolTable) {
+	if s == nil {
+		return
+	}
+	if s.Subroutines == nil {
+		s.Subroutines = make(map[string]*SubroutineSymbols)
+	}
+	s.Subroutines[name] = &SubroutineSymbols{Kind: kind, Variables: variables(table.subroutine)}
+}
@@ -0,0 +1,240 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"jackcompiler/pkg/vm"
+	"strconv"
+	"strings"
+)
+
+// consoleHelp lists the commands Console understands
+const consoleHelp = `break, b <where>    stop at a line (Board.jack:57, or 57 for the current file) or subroutine (Board.draw)
+delete, d <n>       remove breakpoint n
+breakpoints         list the breakpoints
+continue, c         run until a breakpoint or the end of the program
+step, s             run to the next statement, going into calls
+next, n             run to the next statement of this subroutine, running through calls
+finish, f           run until this subroutine returns
+backtrace, bt       show the call stack
+frame <n>           look at the variables of frame n of the call stack
+print, p <name>     show a variable, which can also be this, Class.static, or an array element such as a[i]
+locals              show the arguments and locals
+fields              show the fields of this
+statics [Class]     show the static variables of a class, this frame's class by default
+list, l             show the source around the current line
+help, h             show this list
+quit, q             stop debugging
+An empty line repeats the last command
+`
+
+// console holds the state of a debugging session
+type console struct {
+	d       *Debugger
+	sources map[string][]string
+	out     io.Writer
+	// frame is the index of the frame variables are looked up in, innermost first
+	frame int
+}
+
+// Console reads commands from in and carries them out until quit is entered or in runs out
+// sources maps file names, such as Board.jack, to their lines, and is used to show where the program is
+func Console(d *Debugger, sources map[string][]string, in io.Reader, out io.Writer) error {
+	c := &console{d: d, sources: sources, out: out}
+	c.printf("Stopped before Sys.init, type help for a list of commands\n")
+
+	scanner := bufio.NewScanner(in)
+	last := ""
+	for {
+		c.printf("(jdb) ")
+		if !scanner.Scan() {
+			c.printf("\n")
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "q" {
+			return nil
+		}
+		if err := c.command(fields[0], fields[1:]); err != nil {
+			c.printf("%v\n", err)
+		}
+	}
+}
+
+// printf writes to the console's output
+func (c *console) printf(format string, args ...any) {
+	fmt.Fprintf(c.out, format, args...)
+}
+
+// command carries out a single command
+func (c *console) command(name string, args []string) error {
+	arg := strings.Join(args, " ")
+	switch name {
+	case "break", "b":
+		return c.setBreakpoint(arg)
+	case "delete", "d":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("usage: delete <n>")
+		}
+		return c.d.Delete(n - 1)
+	case "breakpoints":
+		if len(c.d.Breakpoints()) == 0 {
+			c.printf("No breakpoints\n")
+		}
+		for i, b := range c.d.Breakpoints() {
+			c.printf("%d: %s, hit %d times\n", i+1, b.Where, b.Hits)
+		}
+	case "continue", "c":
+		c.resume(c.d.Continue())
+	case "step", "s":
+		c.resume(c.d.Step())
+	case "next", "n":
+		c.resume(c.d.Next())
+	case "finish", "f":
+		c.resume(c.d.Finish())
+	case "backtrace", "bt":
+		for i, frame := range c.d.Frames() {
+			c.printf("#%d %s\n", i, describe(frame))
+		}
+	case "frame":
+		n, err := strconv.Atoi(arg)
+		frames := c.d.Frames()
+		if err != nil || n < 0 || n >= len(frames) {
+			return fmt.Errorf("usage: frame <n>, where n is between 0 and %d", len(frames)-1)
+		}
+		c.frame = n
+		c.printf("#%d %s\n", n, describe(frames[n]))
+	case "print", "p":
+		if arg == "" {
+			return fmt.Errorf("usage: print <name>")
+		}
+		v, err := c.d.Lookup(c.current(), arg)
+		if err != nil {
+			return err
+		}
+		c.printf("%s = %s\n", v.Name, c.d.Format(v))
+	case "locals":
+		c.show(c.d.Locals(c.current()), "No arguments or locals")
+	case "fields":
+		c.show(c.d.Fields(c.current()), "No fields")
+	case "statics":
+		class := arg
+		if class == "" {
+			class = className(c.current().Subroutine)
+		}
+		c.show(c.d.Statics(class), "No static variables in "+class)
+	case "list", "l":
+		c.list(c.current().Pos, 5)
+	case "help", "h":
+		c.printf("%s", consoleHelp)
+	default:
+		return fmt.Errorf("unknown command %q, type help for a list of commands", name)
+	}
+	return nil
+}
+
+// current returns the frame variables are looked up in
+func (c *console) current() Frame {
+	frames := c.d.Frames()
+	if c.frame >= len(frames) {
+		c.frame = 0
+	}
+	return frames[c.frame]
+}
+
+// setBreakpoint sets a breakpoint, a bare line number is taken to be in the file the program is stopped in
+func (c *console) setBreakpoint(where string) error {
+	if where == "" {
+		return fmt.Errorf("usage: break <where>")
+	}
+	if _, err := strconv.Atoi(where); err == nil {
+		pos := c.d.Position()
+		if pos == nil {
+			return fmt.Errorf("not stopped in a file, use File.jack:%s", where)
+		}
+		where = pos.File + ":" + where
+	}
+	b, err := c.d.Break(where)
+	if err != nil {
+		return err
+	}
+	c.printf("Breakpoint %d at %s\n", len(c.d.Breakpoints()), b.Where)
+	return nil
+}
+
+// resume reports why the program stopped after running
+func (c *console) resume(status Status, err error) {
+	c.frame = 0
+	if err != nil {
+		c.printf("%v\n", err)
+	}
+	switch status {
+	case Halted:
+		c.printf("The program halted after %d steps\n", c.d.Machine.Steps())
+		return
+	case AtBreakpoint:
+		for i, b := range c.d.Breakpoints() {
+			for _, pc := range b.pcs {
+				if pc == c.d.Machine.PC() {
+					c.printf("Breakpoint %d, ", i+1)
+				}
+			}
+		}
+	case Interrupted:
+		c.printf("Interrupted, ")
+	}
+	frame := c.d.Frames()[0]
+	c.printf("%s\n", describe(frame))
+	c.list(frame.Pos, 0)
+}
+
+// describe says which subroutine a frame is in and where
+func describe(frame Frame) string {
+	if frame.Pos == nil {
+		return frame.Subroutine
+	}
+	return frame.Subroutine + " at " + frame.Pos.String()
+}
+
+// list shows the source lines around pos, with context lines either side
+func (c *console) list(pos *vm.Position, context int) {
+	if pos == nil {
+		c.printf("No source for this code\n")
+		return
+	}
+	lines, ok := c.sources[pos.File]
+	if !ok {
+		c.printf("No source for %s\n", pos.File)
+		return
+	}
+	for n := pos.Line - context; n <= pos.Line+context; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		marker := " "
+		if n == pos.Line {
+			marker = ">"
+		}
+		c.printf("%s%5d  %s\n", marker, n, lines[n-1])
+	}
+}
+
+// show lists variables along with their values, or none if there aren't any
+func (c *console) show(vars []Variable, none string) {
+	if len(vars) == 0 {
+		c.printf("%s\n", none)
+	}
+	for _, v := range vars {
+		c.printf("%s %s = %s\n", v.Type, v.Name, c.d.Format(v))
+	}
+}
@@ -0,0 +1,454 @@
+package debugger
+
+import (
+	"fmt"
+	"jackcompiler/pkg/common"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/vm"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Status is an enum for why the program stopped running
+type Status int
+
+const (
+	// Paused means a step, next, or finish got where it was going
+	Paused Status = iota
+	// AtBreakpoint means the program got to the start of a line or subroutine with a breakpoint on it
+	AtBreakpoint
+	// Halted means the program is over, it can't be run any further
+	Halted
+	// Interrupted means Interrupt was called while the program was running
+	Interrupted
+)
+
+// Debugger runs a compiled program on a VM one Jack statement at a time
+// The program has to have been compiled from Jack, commands without a position are run through as if
+// they were part of the statement before them
+type Debugger struct {
+	Machine  *vm.Machine
+	symbols  *compiler.Symbols
+	commands []vm.Command
+	// prologue marks the commands that set up a subroutine's frame before its first statement, which come
+	// from the subroutine's declaration
+	prologue []bool
+
+	breakpoints []*Breakpoint
+	// stops counts the breakpoints on each command
+	stops []int
+	// statements holds the statement each frame of the call stack is on, outermost first
+	statements []*vm.Position
+
+	interrupted atomic.Bool
+}
+
+// Breakpoint stops the program whenever it gets to a line or the first statement of a subroutine
+type Breakpoint struct {
+	// Where is the line, such as Board.jack:57, or subroutine, such as Board.draw, the breakpoint is on
+	Where string
+	Hits  int
+	pcs   []int
+}
+
+// New links files into a program and boots it, stopping before Sys.init runs
+// symbols must hold the variables of every class in files
+func New(files []*vm.File, symbols *compiler.Symbols) (*Debugger, error) {
+	machine, err := vm.NewMachine(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := machine.Boot(); err != nil {
+		return nil, err
+	}
+	d := &Debugger{Machine: machine, symbols: symbols, commands: machine.Commands()}
+	d.stops = make([]int, len(d.commands))
+	d.prologue = make([]bool, len(d.commands))
+	var declaration *vm.Position
+	for pc, command := range d.commands {
+		if command.Op == vm.Function {
+			declaration = command.Pos
+		}
+		d.prologue[pc] = command.Pos != nil && command.Pos == declaration
+	}
+	d.enter()
+	return d, nil
+}
+
+// Interrupt stops the program if it is running, it is safe to call from another goroutine
+func (d *Debugger) Interrupt() {
+	d.interrupted.Store(true)
+}
+
+// Position returns the line the program is stopped on, or nil if it isn't on one
+func (d *Debugger) Position() *vm.Position {
+	pc := d.Machine.PC()
+	if pc < 0 || pc >= len(d.commands) {
+		return nil
+	}
+	return d.commands[pc].Pos
+}
+
+// enter records the statement of the command about to run as the one its frame is on,
+// returning true if the frame has just got to that statement
+// Every command the compiler generates for a statement shares its position, so positions are compared as
+// pointers, which also tells apart statements on the same line
+func (d *Debugger) enter() bool {
+	depth := len(d.Machine.Frames())
+	for len(d.statements) < depth+1 {
+		d.statements = append(d.statements, nil)
+	}
+	d.statements = d.statements[:depth+1]
+
+	pos := d.Position()
+	if pos == nil {
+		return false
+	}
+	last := d.statements[depth]
+	d.statements[depth] = pos
+	// Nothing is worth stopping for until the frame has been set up
+	return last != pos && !d.prologue[d.Machine.PC()]
+}
+
+// run executes commands until done says to stop, a breakpoint is reached at the start of a statement,
+// the program halts, or it is interrupted
+// done is given whether the command about to run starts a statement, and how deep the call stack is
+func (d *Debugger) run(done func(entered bool, depth int) bool) (Status, error) {
+	d.interrupted.Store(false)
+	for {
+		if d.Machine.Halted() {
+			return Halted, nil
+		}
+		if d.interrupted.Load() {
+			return Interrupted, nil
+		}
+		if err := d.Machine.Step(); err != nil {
+			return Paused, err
+		}
+		if d.Machine.Halted() {
+			return Halted, nil
+		}
+
+		entered := d.enter()
+		if pc := d.Machine.PC(); entered && pc >= 0 && pc < len(d.stops) && d.stops[pc] > 0 {
+			for _, b := range d.breakpoints {
+				for _, at := range b.pcs {
+					if at == pc {
+						b.Hits++
+					}
+				}
+			}
+			return AtBreakpoint, nil
+		}
+		if done(entered, len(d.Machine.Frames())) {
+			return Paused, nil
+		}
+	}
+}
+
+// Continue runs the program until it reaches a breakpoint or halts
+func (d *Debugger) Continue() (Status, error) {
+	return d.run(func(bool, int) bool { return false })
+}
+
+// Step runs the program until it gets to another statement, going into the subroutines it calls
+func (d *Debugger) Step() (Status, error) {
+	return d.run(func(entered bool, _ int) bool { return entered })
+}
+
+// Next runs the program until it gets to another statement of the same subroutine, or the subroutine returns,
+// running through the subroutines it calls
+func (d *Debugger) Next() (Status, error) {
+	start := len(d.Machine.Frames())
+	return d.run(func(entered bool, depth int) bool { return depth < start || entered && depth == start })
+}
+
+// Finish runs the program until the current subroutine returns
+func (d *Debugger) Finish() (Status, error) {
+	start := len(d.Machine.Frames())
+	return d.run(func(_ bool, depth int) bool { return depth < start })
+}
+
+// Break sets a breakpoint, where is either a line, such as Board.jack:57, or a subroutine, such as Board.draw
+// A line without a statement on it gets the breakpoint on the next line of the same file that has one
+func (d *Debugger) Break(where string) (*Breakpoint, error) {
+	b := &Breakpoint{Where: where}
+	if file, lineStr, ok := strings.Cut(where, ":"); ok {
+		line, err := strconv.Atoi(lineStr)
+		if err != nil || line < 1 {
+			return nil, fmt.Errorf("invalid line %q", lineStr)
+		}
+		if !strings.HasSuffix(file, ".jack") {
+			file += ".jack"
+		}
+		// Find the first line from the one asked for that has a statement on it
+		best := 0
+		for pc, command := range d.commands {
+			if pos := command.Pos; pos != nil && !d.prologue[pc] && pos.File == file && pos.Line >= line && (best == 0 || pos.Line < best) {
+				best = pos.Line
+			}
+		}
+		if best == 0 {
+			return nil, fmt.Errorf("no code at or after %s:%d", file, line)
+		}
+		b.Where = file + ":" + strconv.Itoa(best)
+		for pc, command := range d.commands {
+			if pos := command.Pos; pos != nil && !d.prologue[pc] && pos.File == file && pos.Line == best {
+				b.pcs = append(b.pcs, pc)
+			}
+		}
+	} else {
+		start, ok := d.Machine.FunctionStart(where)
+		if !ok {
+			return nil, fmt.Errorf("no subroutine %s", where)
+		}
+		// Stop once the frame is set up, so this and the fields can be looked at
+		pc := start + 1
+		for pc < len(d.commands) && d.commands[pc].Op != vm.Function && (d.commands[pc].Pos == nil || d.prologue[pc]) {
+			pc++
+		}
+		if pc == len(d.commands) || d.commands[pc].Op == vm.Function {
+			pc = start
+		}
+		b.pcs = []int{pc}
+	}
+
+	for _, pc := range b.pcs {
+		d.stops[pc]++
+	}
+	d.breakpoints = append(d.breakpoints, b)
+	return b, nil
+}
+
+// Breakpoints returns the breakpoints in the order they were set
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+// Delete removes the breakpoint at index i of Breakpoints
+func (d *Debugger) Delete(i int) error {
+	if i < 0 || i >= len(d.breakpoints) {
+		return fmt.Errorf("no breakpoint %d", i+1)
+	}
+	for _, pc := range d.breakpoints[i].pcs {
+		d.stops[pc]--
+	}
+	d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+	return nil
+}
+
+// Frame is a subroutine call on the Jack call stack
+type Frame struct {
+	Subroutine string
+	// Pos is the line the subroutine is on, or nil if it isn't known
+	Pos *vm.Position
+	// args, locals, and this are the addresses of the frame's arguments and locals, and the object it works on
+	args   int
+	locals int
+	this   int
+}
+
+// Frames returns the call stack, innermost call first
+func (d *Debugger) Frames() []Frame {
+	m := d.Machine
+	calls := m.Frames()
+	if len(calls) == 0 {
+		// The machine was started without a call, so there is only what the registers say
+		return []Frame{{Subroutine: m.FunctionAt(m.PC()), Pos: d.Position(),
+			args: int(m.RAM[vm.ARG]), locals: int(m.RAM[vm.LCL]), this: int(m.RAM[vm.THIS])}}
+	}
+
+	frames := make([]Frame, 0, len(calls))
+	for k := len(calls) - 1; k >= 0; k-- {
+		frame := Frame{Subroutine: calls[k].Function, args: calls[k].Args, locals: calls[k].Locals}
+		if k == len(calls)-1 {
+			frame.Pos = d.Position()
+			frame.this = int(m.RAM[vm.THIS])
+		} else {
+			// Frames that called something are on the call, and the callee's frame holds their THIS
+			if pc := calls[k+1].ReturnPC - 1; pc >= 0 && pc < len(d.commands) {
+				frame.Pos = d.commands[pc].Pos
+			}
+			frame.this = int(d.read(calls[k+1].Locals - 2))
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// read reads a word of RAM, treating addresses outside of it as 0
+func (d *Debugger) read(addr int) int16 {
+	if addr < 0 || addr >= vm.MemorySize {
+		return 0
+	}
+	return d.Machine.RAM[addr]
+}
+
+// Variable is a variable of the program along with its value
+type Variable struct {
+	Name    string
+	Type    string
+	Address int
+	Value   int16
+}
+
+// variable reads the variable at addr
+func (d *Debugger) variable(symbol *compiler.Variable, addr int) Variable {
+	return Variable{Name: symbol.Name, Type: symbol.Type, Address: addr, Value: d.read(addr)}
+}
+
+// className returns the class a subroutine belongs to
+func className(subroutine string) string {
+	class, _, _ := strings.Cut(subroutine, ".")
+	return class
+}
+
+// Locals returns the arguments and locals of a frame, this included for methods
+func (d *Debugger) Locals(frame Frame) []Variable {
+	sub, ok := d.symbols.Subroutines[frame.Subroutine]
+	if !ok {
+		return nil
+	}
+	vars := make([]Variable, 0, len(sub.Variables))
+	for _, symbol := range sub.Variables {
+		base := frame.locals
+		if symbol.Kind == compiler.ArgVar {
+			base = frame.args
+		}
+		vars = append(vars, d.variable(symbol, base+symbol.Index))
+	}
+	return vars
+}
+
+// Fields returns the fields of the object a frame works on, which only methods and constructors have
+func (d *Debugger) Fields(frame Frame) []Variable {
+	if sub, ok := d.symbols.Subroutines[frame.Subroutine]; !ok || sub.Kind == common.Function {
+		return nil
+	}
+	var vars []Variable
+	for _, symbol := range d.symbols.Classes[className(frame.Subroutine)] {
+		if symbol.Kind == compiler.FieldVar {
+			vars = append(vars, d.variable(symbol, frame.this+symbol.Index))
+		}
+	}
+	return vars
+}
+
+// Statics returns the static variables of a class
+// Statics the class never uses have no address, and are left out
+func (d *Debugger) Statics(class string) []Variable {
+	var vars []Variable
+	for _, symbol := range d.symbols.Classes[class] {
+		if symbol.Kind != compiler.StaticVar {
+			continue
+		}
+		if addr, ok := d.Machine.StaticAddress(class, symbol.Index); ok {
+			vars = append(vars, d.variable(symbol, addr))
+		}
+	}
+	return vars
+}
+
+// Lookup finds a variable by name as seen from a frame, which can be one of its arguments or locals,
+// a field of this, a static of its class, or a static of another class, such as Board.size
+// An array element, such as a[i] or a[3], can be looked up too
+func (d *Debugger) Lookup(frame Frame, name string) (Variable, error) {
+	if base, index, ok := strings.Cut(name, "["); ok && strings.HasSuffix(index, "]") {
+		array, err := d.Lookup(frame, strings.TrimSpace(base))
+		if err != nil {
+			return Variable{}, err
+		}
+		index = strings.TrimSpace(strings.TrimSuffix(index, "]"))
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			element, err := d.Lookup(frame, index)
+			if err != nil {
+				return Variable{}, err
+			}
+			i = int(element.Value)
+		}
+		addr := int(array.Value) + i
+		return Variable{Name: name, Type: "int", Address: addr, Value: d.read(addr)}, nil
+	}
+
+	if name == "this" {
+		if sub, ok := d.symbols.Subroutines[frame.Subroutine]; ok && sub.Kind != common.Function {
+			return Variable{Name: name, Type: className(frame.Subroutine), Address: vm.THIS, Value: int16(frame.this)}, nil
+		}
+		return Variable{}, fmt.Errorf("%s is a function, it has no this", frame.Subroutine)
+	}
+
+	var scopes [][]Variable
+	if class, static, ok := strings.Cut(name, "."); ok {
+		name = static
+		scopes = append(scopes, d.Statics(class))
+	} else {
+		scopes = append(scopes, d.Locals(frame), d.Fields(frame), d.Statics(className(frame.Subroutine)))
+	}
+	for _, scope := range scopes {
+		for _, v := range scope {
+			if v.Name == name {
+				return v, nil
+			}
+		}
+	}
+	return Variable{}, fmt.Errorf("no variable %s in %s", name, frame.Subroutine)
+}
+
+// Format shows a variable's value the way its type suggests
+// Strings are shown with their characters, using the fields of the OS String class
+func (d *Debugger) Format(v Variable) string {
+	switch v.Type {
+	case "int":
+		return strconv.Itoa(int(v.Value))
+	case "boolean":
+		switch v.Value {
+		case 0:
+			return "false"
+		case -1:
+			return "true"
+		}
+		return strconv.Itoa(int(v.Value)) + " (not a boolean)"
+	case "char":
+		if v.Value >= 32 && v.Value < 127 {
+			return strconv.Itoa(int(v.Value)) + " " + strconv.QuoteRune(rune(v.Value))
+		}
+		return strconv.Itoa(int(v.Value))
+	}
+	if v.Value == 0 {
+		return "null"
+	}
+	object := v.Type + "@" + strconv.Itoa(int(uint16(v.Value)))
+	if v.Type == "String" {
+		if s, ok := d.stringValue(int(uint16(v.Value))); ok {
+			return object + " " + strconv.Quote(s)
+		}
+	}
+	return object
+}
+
+// stringValue reads the characters of the String object at addr
+func (d *Debugger) stringValue(addr int) (string, bool) {
+	fields := make(map[string]int)
+	for _, symbol := range d.symbols.Classes["String"] {
+		if symbol.Kind == compiler.FieldVar {
+			fields[symbol.Name] = symbol.Index
+		}
+	}
+	chars, ok := fields["chars"]
+	length, ok2 := fields["length"]
+	if !ok || !ok2 {
+		return "", false
+	}
+	n := int(d.read(addr + length))
+	if n < 0 || n > 1000 {
+		return "", false
+	}
+	var s strings.Builder
+	array := int(uint16(d.read(addr + chars)))
+	for i := 0; i < n; i++ {
+		s.WriteRune(rune(d.read(array + i)))
+	}
+	return s.String(), true
+}
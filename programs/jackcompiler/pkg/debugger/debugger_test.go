@@ -0,0 +1,228 @@
+package debugger
+
+import (
+	"bytes"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/vm"
+	"strings"
+	"testing"
+)
+
+const mainSource = `class Main {
+    static String name;
+
+    function void main() {
+        var Counter c;
+        var int i;
+        var Array a;
+        let name = "jack";
+        let c = Counter.new(5);
+        let a = Array.new(3);
+        let i = 0;
+        while (i < 3) {
+            let a[i] = i + i;
+            do c.add(i);
+            let i = i + 1;
+        }
+        do Main.done(c.get());
+        return;
+    }
+
+    function void done(int total) {
+        return;
+    }
+}
+`
+
+const counterSource = `class Counter {
+    field int count;
+
+    constructor Counter new(int start) {
+        let count = start;
+        return this;
+    }
+
+    method void add(int n) {
+        let count = count + n;
+        return;
+    }
+
+    method int get() { return count; }
+}
+`
+
+// newDebugger compiles the test program along with the OS and stops it before Sys.init
+func newDebugger(t *testing.T) *Debugger {
+	t.Helper()
+	symbols := &compiler.Symbols{}
+	opts := compiler.Options{Symbols: symbols}
+	var files []*vm.File
+	for _, source := range []struct{ name, contents string }{{"Main.jack", mainSource}, {"Counter.jack", counterSource}} {
+		file, err := compiler.CompileWith(source.name, source.contents, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	files, err := compiler.LinkOSWith(files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(files, symbols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// expectStop runs the debugger and checks why and where it stopped
+func expectStop(t *testing.T, d *Debugger, run func() (Status, error), status Status, subroutine string, where string) {
+	t.Helper()
+	got, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != status {
+		t.Fatalf("stopped with status %d, want %d", got, status)
+	}
+	if status == Halted {
+		return
+	}
+	frame := d.Frames()[0]
+	if frame.Subroutine != subroutine || frame.Pos == nil || frame.Pos.String() != where {
+		t.Fatalf("stopped in %s, want %s at %s", describe(frame), subroutine, where)
+	}
+}
+
+// expectValue checks how a variable seen from a frame is shown
+func expectValue(t *testing.T, d *Debugger, frame Frame, name string, want string) {
+	t.Helper()
+	v, err := d.Lookup(frame, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Format(v); got != want {
+		t.Errorf("%s = %s, want %s", name, got, want)
+	}
+}
+
+// TestDebugger runs the program through breakpoints and steps, looking at its variables along the way
+func TestDebugger(t *testing.T) {
+	d := newDebugger(t)
+	if _, err := d.Break("Counter.add"); err != nil {
+		t.Fatal(err)
+	}
+	// Declarations have no statements, so the breakpoint goes on the first line of the body
+	b, err := d.Break("Counter:4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Where != "Counter.jack:5" {
+		t.Errorf("breakpoint at %s, want Counter.jack:5", b.Where)
+	}
+	if _, err := d.Break("Counter.jack:100"); err == nil {
+		t.Error("breakpoint past the end of the file was set")
+	}
+	if _, err := d.Break("Counter.missing"); err == nil {
+		t.Error("breakpoint on a missing subroutine was set")
+	}
+
+	expectStop(t, d, d.Continue, AtBreakpoint, "Counter.new", "Counter.jack:5")
+	expectValue(t, d, d.Frames()[0], "start", "5")
+	if name := mustFormat(t, d, d.Frames()[0], "Main.name"); !strings.HasPrefix(name, "String@") || !strings.HasSuffix(name, ` "jack"`) {
+		t.Errorf("Main.name = %s, want the string jack", name)
+	}
+	if err := d.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStop(t, d, d.Continue, AtBreakpoint, "Counter.add", "Counter.jack:10")
+	frames := d.Frames()
+	var stack []string
+	for _, frame := range frames {
+		stack = append(stack, describe(frame))
+	}
+	want := []string{"Counter.add at Counter.jack:10", "Main.main at Main.jack:14", "Sys.init at Sys.jack:14"}
+	if strings.Join(stack, ", ") != strings.Join(want, ", ") {
+		t.Errorf("backtrace %v, want %v", stack, want)
+	}
+	expectValue(t, d, frames[0], "n", "0")
+	expectValue(t, d, frames[0], "count", "5")
+	expectValue(t, d, frames[0], "this", mustFormat(t, d, frames[1], "c"))
+	expectValue(t, d, frames[1], "i", "0")
+	expectValue(t, d, frames[1], "a[i]", "0")
+	expectValue(t, d, frames[1], "name", mustFormat(t, d, frames[0], "Main.name"))
+	if _, err := d.Lookup(frames[1], "this"); err == nil {
+		t.Error("found this in a function")
+	}
+	if _, err := d.Lookup(frames[1], "missing"); err == nil {
+		t.Error("found a variable that doesn't exist")
+	}
+
+	expectStop(t, d, d.Finish, Paused, "Main.main", "Main.jack:14")
+	expectStop(t, d, d.Next, Paused, "Main.main", "Main.jack:15")
+	expectStop(t, d, d.Next, Paused, "Main.main", "Main.jack:12")
+	expectStop(t, d, d.Next, Paused, "Main.main", "Main.jack:13")
+	expectStop(t, d, d.Next, Paused, "Main.main", "Main.jack:14")
+	// Running through a call still stops at the breakpoints in it
+	expectStop(t, d, d.Next, AtBreakpoint, "Counter.add", "Counter.jack:10")
+	expectValue(t, d, d.Frames()[0], "n", "1")
+	expectValue(t, d, d.Frames()[1], "a[1]", "2")
+	if hits := d.Breakpoints()[0].Hits; hits != 2 {
+		t.Errorf("breakpoint hit %d times, want 2", hits)
+	}
+
+	if err := d.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+	// The end of the loop has no statement of its own
+	if _, err := d.Break("Main.jack:16"); err != nil {
+		t.Fatal(err)
+	}
+	expectStop(t, d, d.Continue, AtBreakpoint, "Main.main", "Main.jack:17")
+	// get is declared and returns on the same line
+	expectStop(t, d, d.Step, Paused, "Counter.get", "Counter.jack:14")
+	expectValue(t, d, d.Frames()[0], "count", "8")
+	expectStop(t, d, d.Step, Paused, "Main.done", "Main.jack:22")
+	expectValue(t, d, d.Frames()[0], "total", "8")
+	expectStop(t, d, d.Continue, Halted, "", "")
+}
+
+// mustFormat shows a variable as seen from a frame
+func mustFormat(t *testing.T, d *Debugger, frame Frame, name string) string {
+	t.Helper()
+	v, err := d.Lookup(frame, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.Format(v)
+}
+
+// TestConsole runs a session through the console
+func TestConsole(t *testing.T) {
+	d := newDebugger(t)
+	sources := map[string][]string{
+		"Main.jack":    strings.Split(mainSource, "\n"),
+		"Counter.jack": strings.Split(counterSource, "\n"),
+	}
+	in := strings.NewReader("b Counter.add\nc\n\nbt\nlocals\nfields\nframe 1\np a[1]\nstatics\nbogus\nq\n")
+	var out bytes.Buffer
+	if err := Console(d, sources, in, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Breakpoint 1 at Counter.add\n",
+		"Breakpoint 1, Counter.add at Counter.jack:10\n>   10          let count = count + n;\n",
+		// The empty line continues again
+		"#1 Main.main at Main.jack:14\n",
+		"int n = 1\n",
+		"int count = 5\n",
+		"a[1] = 2\n",
+		"String name = String@",
+		`unknown command "bogus"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+}
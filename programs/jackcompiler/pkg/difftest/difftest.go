@@ -0,0 +1,207 @@
+// Package difftest runs the same Jack program compiled by two compilers and looks for differences in what it does
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/reduce"
+	"jackcompiler/pkg/vm"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Source is the contents of a single .jack file
+type Source struct {
+	// Name is the file name, e.g. Main.jack
+	Name string
+	Code string
+}
+
+// Sources formats classes as Jack source, one file per class
+func Sources(classes []*ast.Class) ([]Source, error) {
+	sources := make([]Source, len(classes))
+	for i, class := range classes {
+		var buf bytes.Buffer
+		if err := ast.Format(&buf, class); err != nil {
+			return nil, err
+		}
+		sources[i] = Source{Name: class.Name + ".jack", Code: buf.String()}
+	}
+	return sources, nil
+}
+
+// WriteSources writes sources into dir
+func WriteSources(dir string, sources []Source) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if err := os.WriteFile(filepath.Join(dir, source.Name), []byte(source.Code), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compiler turns the sources of a program into VM code, without the OS
+type Compiler interface {
+	Compile(sources []Source) ([]*vm.File, error)
+}
+
+// CompilerFunc lets an ordinary function be used as a Compiler
+type CompilerFunc func(sources []Source) ([]*vm.File, error)
+
+func (f CompilerFunc) Compile(sources []Source) ([]*vm.File, error) {
+	return f(sources)
+}
+
+// Jack is this repository's compiler
+var Jack = JackWith(compiler.Options{})
+
+// JackWith is this repository's compiler with the given options
+func JackWith(opts compiler.Options) Compiler {
+	return CompilerFunc(func(sources []Source) ([]*vm.File, error) {
+		files := make([]*vm.File, 0, len(sources))
+		for _, source := range sources {
+			file, err := compiler.CompileWith(source.Name, source.Code, opts)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		return files, nil
+	})
+}
+
+// Command is an external compiler, such as the course's JackCompiler.sh
+// It is run with a directory holding the sources as its last argument, and must write a .vm file next to each one
+type Command []string
+
+func (c Command) Compile(sources []Source) ([]*vm.File, error) {
+	dir, err := os.MkdirTemp("", "difftest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := WriteSources(dir, sources); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(c[0], append(c[1:], dir)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v\n%s", strings.Join(c, " "), err, output)
+	}
+
+	files := make([]*vm.File, 0, len(sources))
+	for _, source := range sources {
+		name := strings.TrimSuffix(source.Name, ".jack")
+		file, err := readVM(filepath.Join(dir, name+".vm"), name)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readVM parses a .vm file
+func readVM(path string, name string) (*vm.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return vm.Parse(name, f)
+}
+
+// Fixture is a program along with the VM code a reference compiler produced for it
+type Fixture struct {
+	Dir     string
+	Sources []Source
+	VM      []*vm.File
+}
+
+// LoadFixture reads every .jack file in dir along with the .vm file of the same name next to it
+func LoadFixture(dir string) (*Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jack"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no .jack files", dir)
+	}
+	sort.Strings(paths)
+
+	fixture := &Fixture{Dir: dir}
+	for _, path := range paths {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fixture.Sources = append(fixture.Sources, Source{Name: filepath.Base(path), Code: string(code)})
+
+		name := strings.TrimSuffix(filepath.Base(path), ".jack")
+		file, err := readVM(strings.TrimSuffix(path, ".jack")+".vm", name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: reference output: %w", dir, err)
+		}
+		fixture.VM = append(fixture.VM, file)
+	}
+	return fixture, nil
+}
+
+// Compile returns the reference output, no matter which sources it is given
+// That means fixtures can't be minimized, since the reference compiler isn't there to compile smaller programs
+func (f *Fixture) Compile([]Source) ([]*vm.File, error) {
+	return f.VM, nil
+}
+
+// Difference is a program that behaves differently depending on which compiler built it
+type Difference struct {
+	Sources   []Source
+	Got, Want *Outcome
+	Msg       string
+}
+
+// Check compiles sources with both compilers, runs both for up to steps commands, and compares what they did
+// A nil Difference means the two agree
+func Check(sources []Source, got Compiler, want Compiler, steps uint64) *Difference {
+	gotOutcome := Execute(got, sources, steps)
+	wantOutcome := Execute(want, sources, steps)
+	if msg := Compare(gotOutcome, wantOutcome); msg != "" {
+		return &Difference{Sources: sources, Got: gotOutcome, Want: wantOutcome, Msg: msg}
+	}
+	return nil
+}
+
+// Minimize shrinks the program classes were generated from while it still shows a difference of the same kind
+// Unless the difference is that got rejects the program, candidates that got rejects are never kept,
+// so the reproducer is always a program the compiler accepts
+func Minimize(classes []*ast.Class, diff *Difference, got Compiler, want Compiler, steps uint64) *Difference {
+	kind := kindOf(diff.Msg)
+	smallest := diff
+	reduce.Reduce(classes, func(candidate []*ast.Class) bool {
+		sources, err := Sources(candidate)
+		if err != nil {
+			return false
+		}
+		d := Check(sources, got, want, steps)
+		if d == nil || kindOf(d.Msg) != kind || d.Got.State == Rejected && diff.Got.State != Rejected {
+			return false
+		}
+		smallest = d
+		return true
+	})
+	return smallest
+}
+
+// kindOf returns the part of a difference message that says what differed, e.g. "output"
+func kindOf(msg string) string {
+	kind, _, _ := strings.Cut(msg, ":")
+	return kind
+}
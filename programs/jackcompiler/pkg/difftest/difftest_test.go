@@ -0,0 +1,238 @@
+package difftest_test
+
+import (
+	"bytes"
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/difftest"
+	"jackcompiler/pkg/hack"
+	"jackcompiler/pkg/jackgen"
+	"jackcompiler/pkg/screen"
+	"jackcompiler/pkg/vm"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// steps is plenty for every generated program to halt
+const steps = 50000000
+
+// TestGeneratedPrograms checks that generated programs format back into the same source and run to the end
+func TestGeneratedPrograms(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		sources, err := difftest.Sources(jackgen.New(seed).Program())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, source := range sources {
+			class, err := compiler.Parse(source.Name, source.Code)
+			if err != nil {
+				t.Fatalf("seed %d: %v\n%s", seed, err, source.Code)
+			}
+			var buf bytes.Buffer
+			if err := ast.Format(&buf, class); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != source.Code {
+				t.Fatalf("seed %d: %s formats differently once parsed:\n%s", seed, source.Name, buf.String())
+			}
+		}
+
+		outcome := difftest.Execute(difftest.Jack, sources, steps)
+		if outcome.State != difftest.Halted || strings.Contains(outcome.Output, "ERR") {
+			t.Errorf("seed %d: %s with output %q", seed, outcome, outcome.Output)
+		}
+	}
+}
+
+// TestFixture checks a program against reference output stored next to it
+func TestFixture(t *testing.T) {
+	dir := t.TempDir()
+	sources, err := difftest.Sources(jackgen.New(1).Program())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := difftest.WriteSources(dir, sources); err != nil {
+		t.Fatal(err)
+	}
+	files, err := difftest.Jack.Compile(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		var buf bytes.Buffer
+		if err := vm.Write(&buf, file.Commands); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.Name+".vm"), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fixture, err := difftest.LoadFixture(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := difftest.Check(fixture.Sources, difftest.Jack, fixture, steps); diff != nil {
+		t.Fatalf("compiler disagrees with its own output: %s", diff.Msg)
+	}
+
+	// Breaking the reference output has to be noticed
+	for i, command := range fixture.VM[0].Commands {
+		if command.Op == vm.Push && command.Segment == vm.Constant {
+			fixture.VM[0].Commands[i].Index++
+		}
+	}
+	if diff := difftest.Check(fixture.Sources, difftest.Jack, fixture, steps); diff == nil {
+		t.Fatal("changed reference output was not noticed")
+	}
+}
+
+// swapSub is a broken compiler that subtracts the wrong way around
+var swapSub = difftest.CompilerFunc(func(sources []difftest.Source) ([]*vm.File, error) {
+	files, err := difftest.Jack.Compile(sources)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		for i, command := range file.Commands {
+			if command.Op == vm.Sub {
+				file.Commands[i].Op = vm.Add
+			}
+		}
+	}
+	return files, nil
+})
+
+// TestMinimize checks that a miscompiled program is found and shrunk down to a small reproducer
+func TestMinimize(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		classes := jackgen.New(seed).Program()
+		sources, err := difftest.Sources(classes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff := difftest.Check(sources, swapSub, difftest.Jack, steps)
+		if diff == nil {
+			continue
+		}
+
+		smallest := difftest.Minimize(classes, diff, swapSub, difftest.Jack, steps)
+		if difftest.Check(smallest.Sources, swapSub, difftest.Jack, steps) == nil {
+			t.Fatalf("seed %d: the minimized program doesn't reproduce the difference", seed)
+		}
+		size, smallestSize := 0, 0
+		for _, source := range sources {
+			size += len(source.Code)
+		}
+		for _, source := range smallest.Sources {
+			smallestSize += len(source.Code)
+			if strings.Contains(source.Code, "while") {
+				t.Errorf("seed %d: %s still has a loop:\n%s", seed, source.Name, source.Code)
+			}
+		}
+		if smallestSize*4 > size {
+			t.Errorf("seed %d: only minimized from %d to %d bytes", seed, size, smallestSize)
+		}
+		for _, source := range smallest.Sources {
+			t.Logf("seed %d: %s\n%s", seed, smallest.Msg, source.Code)
+		}
+		return
+	}
+	t.Fatal("no generated program noticed the broken compiler")
+}
+
+// TestAllOptions checks that generated programs behave the same when they and the OS are compiled at -O1,
+// have small subroutines inlined, and are stripped of the subroutines they never call
+func TestAllOptions(t *testing.T) {
+	opts := compiler.Options{Optimize: 1}
+	optimized := difftest.CompilerFunc(func(sources []difftest.Source) ([]*vm.File, error) {
+		files, err := difftest.JackWith(opts).Compile(sources)
+		if err != nil {
+			return nil, err
+		}
+		if files, err = compiler.LinkOSWith(files, opts); err != nil {
+			return nil, err
+		}
+		files, _ = vm.Inline(files, 30)
+		files, _ = vm.RemoveUnreachable(files, "Sys.init")
+		return files, nil
+	})
+	for seed := int64(0); seed < 100; seed++ {
+		sources, err := difftest.Sources(jackgen.New(seed).Program())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := difftest.Check(sources, optimized, difftest.Jack, steps); diff != nil {
+			t.Errorf("seed %d: %s\n  optimized: %s\n  plain:     %s", seed, diff.Msg, diff.Got, diff.Want)
+		}
+	}
+}
+
+// runHack assembles a program and runs it until it ends up in the loop programs halt in, returning the screen
+func runHack(t *testing.T, asm []string) ([]int16, int) {
+	program, err := hack.Assemble("Program.asm", strings.NewReader(strings.Join(asm, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := hack.NewCPU(program)
+	for !cpu.Looping() && cpu.Steps() < 20*steps {
+		cpu.Step()
+	}
+	if !cpu.Looping() {
+		t.Fatalf("still running after %d instructions", cpu.Steps())
+	}
+	return append([]int16{}, cpu.RAM[screen.Base:screen.Base+screen.Words]...), len(program)
+}
+
+// TestNative checks that generated programs draw the same screen whether they are compiled straight to
+// assembly or translated from VM code, and that the native code is the smaller of the two
+func TestNative(t *testing.T) {
+	for seed := int64(0); seed < 30; seed++ {
+		sources, err := difftest.Sources(jackgen.New(seed).Program())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := difftest.Execute(difftest.Jack, sources, steps)
+		if want.State != difftest.Halted {
+			continue
+		}
+		dir := t.TempDir()
+		if err := difftest.WriteSources(dir, sources); err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := compiler.CompileProgram(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, _ = vm.RemoveUnreachable(files, "Sys.init")
+		vmAsm, _ := vm.Translate(files)
+		translated, vmSize := runHack(t, vmAsm)
+
+		for _, level := range []int{0, 1} {
+			asm, _, err := compiler.CompileProgramAsm(dir, compiler.Options{Optimize: level})
+			if err != nil {
+				t.Fatal(err)
+			}
+			native, size := runHack(t, asm)
+			if size >= vmSize {
+				t.Errorf("seed %d -O%d: native code is %d instructions, translated VM code only %d", seed, level, size, vmSize)
+			}
+			for i := range want.Screen {
+				if native[i] != want.Screen[i] {
+					t.Errorf("seed %d -O%d: native screen differs at word %d", seed, level, i)
+					break
+				}
+			}
+		}
+		for i := range want.Screen {
+			if translated[i] != want.Screen[i] {
+				t.Errorf("seed %d: translated screen differs at word %d", seed, i)
+				break
+			}
+		}
+	}
+}
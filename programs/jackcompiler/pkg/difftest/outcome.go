@@ -0,0 +1,173 @@
+package difftest
+
+import (
+	"fmt"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/screen"
+	"jackcompiler/pkg/vm"
+	"strings"
+)
+
+// State is an enum for how a run ended
+type State int
+
+const (
+	Halted State = iota
+	// Failed means the VM hit a runtime error
+	Failed
+	// Rejected means the program didn't compile or link
+	Rejected
+	// Running means the program was still going when it ran out of steps
+	Running
+)
+
+// StateStrMap will map states by type to their respective string
+var StateStrMap = map[State]string{
+	Halted:   "halted",
+	Failed:   "failed",
+	Rejected: "rejected",
+	Running:  "still running",
+}
+
+// Outcome is what a program did when it was run
+type Outcome struct {
+	State State
+	// Err is the compile or runtime error, if there was one
+	Err string
+	// Output is the text printed through the Output class, with newlines for Output.println
+	Output string
+	Screen []int16
+	Steps  uint64
+}
+
+// String describes how the run ended
+func (o *Outcome) String() string {
+	if o.State == Failed || o.State == Rejected {
+		return StateStrMap[o.State] + ": " + o.Err
+	}
+	return fmt.Sprintf("%s after %d steps", StateStrMap[o.State], o.Steps)
+}
+
+// Execute compiles sources, links them with the OS, and runs the program from Sys.init for up to steps commands
+func Execute(c Compiler, sources []Source, steps uint64) *Outcome {
+	files, err := c.Compile(sources)
+	if err == nil {
+		// LinkOS appends to the slice it is given, which may belong to the compiler
+		files, err = compiler.LinkOS(append([]*vm.File{}, files...))
+	}
+	var machine *vm.Machine
+	if err == nil {
+		machine, err = vm.NewMachine(files)
+	}
+	if err == nil {
+		err = machine.Boot()
+	}
+	if err != nil {
+		return &Outcome{State: Rejected, Err: err.Error()}
+	}
+
+	// Printing is watched at the calls to Output, so the text doesn't have to be read back off the screen
+	var output strings.Builder
+	outcome := &Outcome{State: Running}
+	commands := machine.Commands()
+	for !machine.Halted() && machine.Steps() < steps {
+		if pc := machine.PC(); pc >= 0 && pc < len(commands) && commands[pc].Op == vm.Call {
+			record(machine, commands[pc].Name, &output)
+		}
+		if err := machine.Step(); err != nil {
+			outcome.State = Failed
+			outcome.Err = err.Error()
+			break
+		}
+	}
+	if machine.Halted() {
+		outcome.State = Halted
+	}
+
+	outcome.Output = output.String()
+	outcome.Screen = append([]int16{}, machine.RAM[screen.Base:screen.Base+screen.Words]...)
+	outcome.Steps = machine.Steps()
+	return outcome
+}
+
+// record adds to the output when the machine is about to call one of the functions that print
+func record(machine *vm.Machine, function string, output *strings.Builder) {
+	switch function {
+	case "Output.printChar":
+		sp := int(machine.RAM[vm.SP]) - 1
+		if sp < 0 {
+			return
+		}
+		switch c := machine.RAM[sp]; c {
+		case 128:
+			output.WriteByte('\n')
+		case 129:
+			output.WriteByte('\b')
+		default:
+			output.WriteRune(rune(c))
+		}
+	case "Output.println":
+		// printChar moves to the next line itself when a line fills up, which isn't part of the text
+		if machine.FunctionAt(machine.PC()) != "Output.printChar" {
+			output.WriteByte('\n')
+		}
+	}
+}
+
+// Compare returns a message describing the first way got differs from want, or "" if they agree
+// Programs that both compilers reject agree, and for programs that are both still running
+// only the output printed so far is compared, and only up to the shorter of the two
+func Compare(got *Outcome, want *Outcome) string {
+	if got.State != want.State {
+		return fmt.Sprintf("state: got %s, want %s", got, want)
+	}
+	if got.State == Rejected {
+		return ""
+	}
+
+	gotOutput, wantOutput := got.Output, want.Output
+	if got.State == Running {
+		n := len(gotOutput)
+		if len(wantOutput) < n {
+			n = len(wantOutput)
+		}
+		gotOutput, wantOutput = gotOutput[:n], wantOutput[:n]
+	}
+	if gotOutput != wantOutput {
+		i := 0
+		for i < len(gotOutput) && i < len(wantOutput) && gotOutput[i] == wantOutput[i] {
+			i++
+		}
+		return fmt.Sprintf("output: differs at byte %d: got %q, want %q", i, excerpt(gotOutput, i), excerpt(wantOutput, i))
+	}
+	if got.State == Running {
+		return ""
+	}
+
+	differ, first := 0, -1
+	for i := range got.Screen {
+		if got.Screen[i] != want.Screen[i] {
+			if first == -1 {
+				first = i
+			}
+			differ++
+		}
+	}
+	if differ > 0 {
+		return fmt.Sprintf("screen: %d words differ, the first at row %d column %d",
+			differ, first/screen.WordsPerRow, first%screen.WordsPerRow*16)
+	}
+	return ""
+}
+
+// excerpt returns the text around index i
+func excerpt(s string, i int) string {
+	start, end := i-20, i+20
+	if start < 0 {
+		start = 0
+	}
+	if end > len(s) {
+		end = len(s)
+	}
+	return s[start:end]
+}
@@ -0,0 +1,249 @@
+package hack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Predefined maps the symbols every Hack program can use to their addresses
+var Predefined = map[string]int{
+	"SP":     0,
+	"LCL":    1,
+	"ARG":    2,
+	"THIS":   3,
+	"THAT":   4,
+	"SCREEN": 16384,
+	"KBD":    24576,
+}
+
+func init() {
+	for i := 0; i < 16; i++ {
+		Predefined["R"+strconv.Itoa(i)] = i
+	}
+}
+
+// CompMap maps the comp part of a C instruction to its a and c bits
+var CompMap = map[string]uint16{
+	"0":   0b0101010,
+	"1":   0b0111111,
+	"-1":  0b0111010,
+	"D":   0b0001100,
+	"A":   0b0110000,
+	"!D":  0b0001101,
+	"!A":  0b0110001,
+	"-D":  0b0001111,
+	"-A":  0b0110011,
+	"D+1": 0b0011111,
+	"A+1": 0b0110111,
+	"D-1": 0b0001110,
+	"A-1": 0b0110010,
+	"D+A": 0b0000010,
+	"D-A": 0b0010011,
+	"A-D": 0b0000111,
+	"D&A": 0b0000000,
+	"D|A": 0b0010101,
+	"M":   0b1110000,
+	"!M":  0b1110001,
+	"-M":  0b1110011,
+	"M+1": 0b1110111,
+	"M-1": 0b1110010,
+	"D+M": 0b1000010,
+	"D-M": 0b1010011,
+	"M-D": 0b1000111,
+	"D&M": 0b1000000,
+	"D|M": 0b1010101,
+}
+
+// JumpMap maps the jump part of a C instruction to its j bits
+var JumpMap = map[string]uint16{
+	"":    0,
+	"JGT": 1,
+	"JEQ": 2,
+	"JGE": 3,
+	"JLT": 4,
+	"JNE": 5,
+	"JLE": 6,
+	"JMP": 7,
+}
+
+// Assemble translates a Hack assembly program into machine code
+// name is only used for error messages
+func Assemble(name string, r io.Reader) ([]uint16, error) {
+	// First pass: strip out whitespace and comments, and find where every label points
+	type line struct {
+		text string
+		num  int
+	}
+	lines := make([]line, 0)
+	symbols := make(map[string]int)
+	for key, value := range Predefined {
+		symbols[key] = value
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		text := scanner.Text()
+		if idx := strings.Index(text, "//"); idx != -1 {
+			text = text[:idx]
+		}
+		text = strings.Join(strings.Fields(text), "")
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "(") {
+			label := strings.TrimSuffix(strings.TrimPrefix(text, "("), ")")
+			if !strings.HasSuffix(text, ")") || !validSymbol(label) {
+				return nil, fmt.Errorf("%s:%d: invalid label %q", name, lineNum, text)
+			}
+			if _, ok := symbols[label]; ok {
+				return nil, fmt.Errorf("%s:%d: symbol %s is already defined", name, lineNum, label)
+			}
+			symbols[label] = len(lines)
+			continue
+		}
+		lines = append(lines, line{text: text, num: lineNum})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Second pass: translate every instruction, giving variables addresses as they are found
+	code := make([]uint16, 0, len(lines))
+	nextVar := 16
+	for _, l := range lines {
+		var word uint16
+		var err error
+		if strings.HasPrefix(l.text, "@") {
+			word, err = aInstruction(l.text[1:], symbols, &nextVar)
+		} else {
+			word, err = cInstruction(l.text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, l.num, err)
+		}
+		code = append(code, word)
+	}
+
+	return code, nil
+}
+
+// aInstruction translates the value of an A instruction
+func aInstruction(value string, symbols map[string]int, nextVar *int) (uint16, error) {
+	if value != "" && value[0] >= '0' && value[0] <= '9' {
+		num, err := strconv.Atoi(value)
+		if err != nil || num > 32767 {
+			return 0, fmt.Errorf("invalid constant %q", value)
+		}
+		return uint16(num), nil
+	}
+
+	if !validSymbol(value) {
+		return 0, fmt.Errorf("invalid symbol %q", value)
+	}
+	addr, ok := symbols[value]
+	if !ok {
+		addr = *nextVar
+		symbols[value] = addr
+		*nextVar++
+	}
+	return uint16(addr), nil
+}
+
+// cInstruction translates a dest=comp;jump instruction
+func cInstruction(text string) (uint16, error) {
+	dest, rest, found := strings.Cut(text, "=")
+	if !found {
+		dest, rest = "", text
+	}
+	comp, jump, _ := strings.Cut(rest, ";")
+
+	bits, ok := CompMap[comp]
+	if !ok {
+		// The operands of the commutative operations may be written either way around
+		if len(comp) == 3 && strings.ContainsAny(comp[1:2], "+&|") {
+			bits, ok = CompMap[comp[2:]+comp[1:2]+comp[:1]]
+		}
+		if !ok {
+			return 0, fmt.Errorf("invalid computation %q", comp)
+		}
+	}
+
+	var destBits uint16
+	for _, c := range dest {
+		var bit uint16
+		switch c {
+		case 'A':
+			bit = 4
+		case 'D':
+			bit = 2
+		case 'M':
+			bit = 1
+		default:
+			return 0, fmt.Errorf("invalid destination %q", dest)
+		}
+		if destBits&bit != 0 {
+			return 0, fmt.Errorf("invalid destination %q", dest)
+		}
+		destBits |= bit
+	}
+
+	jumpBits, ok := JumpMap[jump]
+	if !ok {
+		return 0, fmt.Errorf("invalid jump %q", jump)
+	}
+
+	return 0b111<<13 | bits<<6 | destBits<<3 | jumpBits, nil
+}
+
+// validSymbol checks that a symbol only uses the allowed characters and doesn't start with a digit
+func validSymbol(symbol string) bool {
+	if symbol == "" || (symbol[0] >= '0' && symbol[0] <= '9') {
+		return false
+	}
+	for _, c := range symbol {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_.$:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadBinary reads a .hack file, which has one 16 character binary instruction per line
+func ReadBinary(name string, r io.Reader) ([]uint16, error) {
+	code := make([]uint16, 0)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		word, err := strconv.ParseUint(text, 2, 16)
+		if err != nil || len(text) != 16 {
+			return nil, fmt.Errorf("%s:%d: invalid instruction %q", name, lineNum, text)
+		}
+		code = append(code, uint16(word))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// WriteBinary writes machine code in the .hack format
+func WriteBinary(w io.Writer, code []uint16) error {
+	bw := bufio.NewWriter(w)
+	for _, word := range code {
+		if _, err := fmt.Fprintf(bw, "%016b\n", word); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,103 @@
+package hack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestAssemble checks that labels point past themselves, variables are given addresses from 16 in the order
+// they are first used, and predefined symbols are left alone
+func TestAssemble(t *testing.T) {
+	source := `// Counts down from R0
+(LOOP)
+    @R0
+    D=M
+    @END
+    D;JLE       // done once it reaches 0
+    @count
+    M=M+1
+    @R0
+    M=M-1
+    @LOOP
+    0;JMP
+(END)
+    @total
+    M=D
+    @count
+    D=M
+    @SCREEN
+    @END
+    0;JMP
+`
+	want := []string{
+		"0000000000000000", // @R0
+		"1111110000010000", // D=M
+		"0000000000001010", // @END
+		"1110001100000110", // D;JLE
+		"0000000000010000", // @count
+		"1111110111001000", // M=M+1
+		"0000000000000000", // @R0
+		"1111110010001000", // M=M-1
+		"0000000000000000", // @LOOP
+		"1110101010000111", // 0;JMP
+		"0000000000010001", // @total
+		"1110001100001000", // M=D
+		"0000000000010000", // @count
+		"1111110000010000", // D=M
+		"0100000000000000", // @SCREEN
+		"0000000000001010", // @END
+		"1110101010000111", // 0;JMP
+	}
+	code, err := Assemble("Count.asm", strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteBinary(&buf, code); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("assembled %d instructions, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("instruction %d is %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	// Reading the binary back gives the same program
+	read, err := ReadBinary("Count.hack", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range code {
+		if read[i] != code[i] {
+			t.Errorf("instruction %d read back as %016b, want %016b", i, read[i], code[i])
+		}
+	}
+}
+
+// TestAssembleErrors checks that mistakes are reported with the line they are on
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"@1\n(LOOP)\n(LOOP)\n", "Bad.asm:3: symbol LOOP is already defined"},
+		{"(R0)\n", "Bad.asm:1: symbol R0 is already defined"},
+		{"@32768\n", `Bad.asm:1: invalid constant "32768"`},
+		{"\n@2x\n", `Bad.asm:2: invalid constant "2x"`},
+		{"D=D*A\n", `Bad.asm:1: invalid computation "D*A"`},
+		{"MM=1\n", `Bad.asm:1: invalid destination "MM"`},
+		{"0;JUMP\n", `Bad.asm:1: invalid jump "JUMP"`},
+		{"(END\n", `Bad.asm:1: invalid label "(END"`},
+	}
+	for _, test := range tests {
+		_, err := Assemble("Bad.asm", strings.NewReader(test.source))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %s", test.source, err, test.err)
+		}
+	}
+}
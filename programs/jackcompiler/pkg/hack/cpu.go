@@ -0,0 +1,109 @@
+package hack
+
+// Sizes of the Hack computer's memories
+const (
+	RAMSize      = 32768
+	ROMSize      = 32768
+	ScreenBase   = 16384
+	KeyboardAddr = 24576
+)
+
+// CPU emulates the Hack computer, executing one instruction per Step
+type CPU struct {
+	ROM [ROMSize]uint16
+	RAM [RAMSize]int16
+	A   int16
+	D   int16
+	PC  uint16
+
+	steps uint64
+}
+
+// NewCPU constructs a computer with the given program loaded into ROM
+func NewCPU(program []uint16) *CPU {
+	c := &CPU{}
+	copy(c.ROM[:], program)
+	return c
+}
+
+// Steps returns the number of instructions executed so far
+func (c *CPU) Steps() uint64 {
+	return c.steps
+}
+
+// Looping checks whether the CPU is stuck in a loop that jumps to itself, the way programs end
+func (c *CPU) Looping() bool {
+	return c.ROM[c.PC%ROMSize] == c.PC && c.ROM[(c.PC+1)%ROMSize] == 0xEA87
+}
+
+// Reset jumps back to the start of the program
+func (c *CPU) Reset() {
+	c.PC = 0
+}
+
+// Step executes a single instruction
+func (c *CPU) Step() {
+	ins := c.ROM[c.PC%ROMSize]
+	c.steps++
+
+	// A instruction
+	if ins&0x8000 == 0 {
+		c.A = int16(ins)
+		c.PC++
+		return
+	}
+
+	// The address only has 15 bits, the same as the real memory
+	a := c.A
+	addr := uint16(a) % RAMSize
+	y := a
+	if ins&0x1000 != 0 {
+		y = c.RAM[addr]
+	}
+	out := ALU(c.D, y, ins>>6)
+
+	if ins&0x08 != 0 {
+		c.RAM[addr] = out
+	}
+	if ins&0x20 != 0 {
+		c.A = out
+	}
+	if ins&0x10 != 0 {
+		c.D = out
+	}
+
+	jump := ins & 0x07
+	if (jump&4 != 0 && out < 0) || (jump&2 != 0 && out == 0) || (jump&1 != 0 && out > 0) {
+		// The jump target is the value of A before this instruction
+		c.PC = uint16(a)
+		return
+	}
+	c.PC++
+}
+
+// ALU computes the Hack ALU's output, where the low 6 bits of control are zx, nx, zy, ny, f, no
+func ALU(x int16, y int16, control uint16) int16 {
+	if control&0x20 != 0 {
+		x = 0
+	}
+	if control&0x10 != 0 {
+		x = ^x
+	}
+	if control&0x08 != 0 {
+		y = 0
+	}
+	if control&0x04 != 0 {
+		y = ^y
+	}
+
+	var out int16
+	if control&0x02 != 0 {
+		out = x + y
+	} else {
+		out = x & y
+	}
+	if control&0x01 != 0 {
+		out = ^out
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package hack
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCPU steps through a program that multiplies R0 by R1, checking the registers after the first few
+// instructions and the result once it halts
+func TestCPU(t *testing.T) {
+	source := `    @R2
+    M=0
+(LOOP)
+    @R1
+    D=M
+    @END
+    D;JLE
+    @R0
+    D=M
+    @R2
+    M=D+M
+    @R1
+    M=M-1
+    @LOOP
+    0;JMP
+(END)
+    @END
+    0;JMP
+`
+	program, err := Assemble("Mult.asm", strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU(program)
+	cpu.RAM[0], cpu.RAM[1], cpu.RAM[2] = -7, 6, 99
+
+	steps := []struct {
+		a, d int16
+		pc   uint16
+	}{
+		{2, 0, 1},
+		{2, 0, 2},
+		{1, 0, 3},
+		{1, 6, 4},
+		{14, 6, 5},
+		// R1 is positive, so the jump isn't taken
+		{14, 6, 6},
+		{0, 6, 7},
+		{0, -7, 8},
+	}
+	for i, want := range steps {
+		cpu.Step()
+		if cpu.A != want.a || cpu.D != want.d || cpu.PC != want.pc {
+			t.Fatalf("after step %d A = %d, D = %d, PC = %d, want %d, %d, %d", i+1, cpu.A, cpu.D, cpu.PC, want.a, want.d, want.pc)
+		}
+	}
+	if cpu.RAM[2] != 0 {
+		t.Errorf("RAM[2] = %d after clearing it, want 0", cpu.RAM[2])
+	}
+
+	for !cpu.Looping() && cpu.Steps() < 1000 {
+		cpu.Step()
+	}
+	if !cpu.Looping() {
+		t.Fatalf("still running after %d instructions", cpu.Steps())
+	}
+	if cpu.PC != 14 || cpu.RAM[2] != -42 || cpu.RAM[1] != 0 {
+		t.Errorf("halted at %d with RAM[1] = %d and RAM[2] = %d, want 14, 0 and -42", cpu.PC, cpu.RAM[1], cpu.RAM[2])
+	}
+
+	cpu.Reset()
+	if cpu.PC != 0 || cpu.Looping() {
+		t.Errorf("PC = %d after a reset, want 0", cpu.PC)
+	}
+}
+
+// TestALU checks every computation the assembler knows about against the values it should give
+func TestALU(t *testing.T) {
+	x, y := int16(-21), int16(13)
+	want := map[string]int16{
+		"0": 0, "1": 1, "-1": -1,
+		"D": x, "A": y, "!D": ^x, "!A": ^y, "-D": -x, "-A": -y,
+		"D+1": x + 1, "A+1": y + 1, "D-1": x - 1, "A-1": y - 1,
+		"D+A": x + y, "D-A": x - y, "A-D": y - x, "D&A": x & y, "D|A": x | y,
+	}
+	for comp, value := range want {
+		bits, ok := CompMap[comp]
+		if !ok {
+			t.Errorf("%s is missing from CompMap", comp)
+			continue
+		}
+		if got := ALU(x, y, bits); got != value {
+			t.Errorf("%s = %d, want %d", comp, got, value)
+		}
+		// The M forms use the same ALU bits with a set
+		if strings.Contains(comp, "A") {
+			mComp := strings.ReplaceAll(comp, "A", "M")
+			if CompMap[mComp] != bits|0x40 {
+				t.Errorf("%s is %07b, want %07b", mComp, CompMap[mComp], bits|0x40)
+			}
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Build loads a chip and everything it is made of, and flattens it into a simulation
+func (l *Loader) Build(name string) (*Sim, error) {
+	chip, err := l.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &builder{loader: l, nets: 2, plans: make(map[*Chip]*plan), active: make(map[*Chip]bool)}
+	p, err := b.plan(chip)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sim{Chip: chip, inputs: make(map[string][]int32), outputs: make(map[string][]int32)}
+	in := b.newNets(p.inBits)
+	out := b.newNets(p.outBits)
+	for _, pin := range chip.In {
+		s.inputs[pin.Name] = in[p.inOffset[pin.Name] : p.inOffset[pin.Name]+pin.Width]
+	}
+	for _, pin := range chip.Out {
+		s.outputs[pin.Name] = out[p.outOffset[pin.Name] : p.outOffset[pin.Name]+pin.Width]
+	}
+	b.instantiate(p, in, out)
+
+	s.nets = make([]uint8, b.nets)
+	s.nets[netTrue] = 1
+	s.dffs = b.dffs
+	s.comps = b.comps
+	if s.nodes, err = b.sort(); err != nil {
+		return nil, fmt.Errorf("%s: %v", chip.Name, err)
+	}
+	s.Eval()
+	return s, nil
+}
+
+// BuildFile builds the chip in a .hdl file, searching DefaultPath for its parts
+func BuildFile(path string) (*Sim, error) {
+	loader := NewLoader(DefaultPath(path)...)
+	return loader.Build(strings.TrimSuffix(filepath.Base(path), ".hdl"))
+}
+
+// Kinds of ref
+const (
+	refFalse uint8 = iota
+	refTrue
+	refIn
+	refOut
+	refLocal
+	refUnset
+)
+
+// ref says where a bit is wired within a chip: a constant, a bit of the chip's inputs or outputs, or a local net
+type ref struct {
+	kind  uint8
+	index int32
+}
+
+// plan is a chip with all of its wiring checked and worked out, so it can be instantiated many times cheaply
+// The bits of every input pin are laid out one after another, in the order the pins are declared, and so are the outputs
+type plan struct {
+	chip      *Chip
+	inBits    int
+	outBits   int
+	inOffset  map[string]int
+	outOffset map[string]int
+	locals    int32
+	parts     []partPlan
+}
+
+// partPlan is the wiring of a single part
+type partPlan struct {
+	plan *plan
+	in   []ref
+	out  []ref
+	// copies are extra chip outputs driven by a part output that already drives another one
+	copies [][2]ref
+}
+
+// builder flattens chips into a netlist
+type builder struct {
+	loader *Loader
+	nets   int32
+	nodes  []node
+	dffs   []dff
+	comps  []*instance
+	plans  map[*Chip]*plan
+	// active holds the chips currently being planned so chips that contain themselves are caught
+	active map[*Chip]bool
+	// scratch holds the nets of the parts being instantiated
+	scratch []int32
+}
+
+// newNets allocates nets for a bus
+func (b *builder) newNets(width int) []int32 {
+	nets := make([]int32, width)
+	for i := range nets {
+		nets[i] = b.nets
+		b.nets++
+	}
+	return nets
+}
+
+// width returns the number of bits a bus covers, given the width of the pin it refers to
+func width(bus Bus, pinWidth int) int {
+	if bus.Sliced {
+		return bus.Hi - bus.Lo + 1
+	}
+	return pinWidth
+}
+
+// low returns the first bit a bus covers
+func low(bus Bus) int {
+	if bus.Sliced {
+		return bus.Lo
+	}
+	return 0
+}
+
+// isPin checks if a name is one of the given pins
+func isPin(pins []*Pin, name string) bool {
+	for _, pin := range pins {
+		if pin.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// plan checks the wiring of a chip and works out where every bit goes
+func (b *builder) plan(chip *Chip) (*plan, error) {
+	if p, ok := b.plans[chip]; ok {
+		return p, nil
+	}
+	if b.active[chip] {
+		return nil, &Error{File: filepath.Base(chip.File), Line: chip.Line, Msg: fmt.Sprintf("chip %s contains itself", chip.Name)}
+	}
+	b.active[chip] = true
+	defer delete(b.active, chip)
+
+	p := &plan{chip: chip, inOffset: make(map[string]int), outOffset: make(map[string]int)}
+	for _, pin := range chip.In {
+		p.inOffset[pin.Name] = p.inBits
+		p.inBits += pin.Width
+	}
+	for _, pin := range chip.Out {
+		p.outOffset[pin.Name] = p.outBits
+		p.outBits += pin.Width
+	}
+	if chip.Builtin != "" {
+		b.plans[chip] = p
+		return p, nil
+	}
+
+	file := filepath.Base(chip.File)
+	errorf := func(line int, format string, args ...any) error {
+		return &Error{File: file, Line: line, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	parts := make([]*plan, len(chip.Parts))
+	for i, part := range chip.Parts {
+		sub, err := b.loader.Load(part.Chip)
+		if err != nil {
+			if _, ok := err.(*Error); ok {
+				return nil, err
+			}
+			return nil, errorf(part.Line, "%v", err)
+		}
+		if parts[i], err = b.plan(sub); err != nil {
+			return nil, err
+		}
+	}
+
+	// First pass: work out where the outputs of every part go, which gives every internal pin its nets
+	internal := make(map[string][]ref)
+	driven := make([]bool, p.outBits)
+	p.parts = make([]partPlan, len(chip.Parts))
+	for i, part := range chip.Parts {
+		sub := parts[i].chip
+		pp := partPlan{plan: parts[i], out: make([]ref, parts[i].outBits)}
+		for j := range pp.out {
+			pp.out[j] = ref{kind: refUnset}
+		}
+
+		// Outputs wired to the chip's own outputs use those outputs, anything else gets a local net
+		aliases := make([]*Connection, 0)
+		for _, conn := range part.Conns {
+			pin, ok := sub.Output(conn.Inner.Name)
+			if !ok {
+				continue
+			}
+			if conn.Inner.Sliced && conn.Inner.Hi >= pin.Width {
+				return nil, errorf(conn.Line, "%s is out of range for %s[%d]", conn.Inner, pin.Name, pin.Width)
+			}
+			lo := parts[i].outOffset[pin.Name] + low(conn.Inner)
+			w := width(conn.Inner, pin.Width)
+
+			switch {
+			case conn.Outer.IsConstant():
+				return nil, errorf(conn.Line, "output %s of %s can't be connected to %s", conn.Inner, part.Chip, conn.Outer.Name)
+			case isPin(chip.In, conn.Outer.Name):
+				return nil, errorf(conn.Line, "output %s of %s can't drive input pin %s", conn.Inner, part.Chip, conn.Outer.Name)
+			case isPin(chip.Out, conn.Outer.Name):
+				own, _ := chip.Output(conn.Outer.Name)
+				if conn.Outer.Sliced && conn.Outer.Hi >= own.Width {
+					return nil, errorf(conn.Line, "%s is out of range for %s[%d]", conn.Outer, own.Name, own.Width)
+				}
+				if ow := width(conn.Outer, own.Width); ow != w {
+					return nil, errorf(conn.Line, "width mismatch: %s is %s but %s is %s", conn.Inner, bits(w), conn.Outer, bits(ow))
+				}
+				olo := p.outOffset[own.Name] + low(conn.Outer)
+				for k := 0; k < w; k++ {
+					if driven[olo+k] {
+						return nil, errorf(conn.Line, "%s has more than one driver", bit(own, olo+k-p.outOffset[own.Name]))
+					}
+					driven[olo+k] = true
+					target := ref{kind: refOut, index: int32(olo + k)}
+					if pp.out[lo+k].kind == refUnset {
+						pp.out[lo+k] = target
+					} else {
+						pp.copies = append(pp.copies, [2]ref{pp.out[lo+k], target})
+					}
+				}
+			default:
+				if conn.Outer.Sliced {
+					return nil, errorf(conn.Line, "internal pin %s can't be sliced", conn.Outer.Name)
+				}
+				if _, ok := internal[conn.Outer.Name]; ok {
+					return nil, errorf(conn.Line, "internal pin %s has more than one driver", conn.Outer.Name)
+				}
+				internal[conn.Outer.Name] = nil
+				aliases = append(aliases, conn)
+			}
+		}
+
+		for j := range pp.out {
+			if pp.out[j].kind == refUnset {
+				pp.out[j] = ref{kind: refLocal, index: p.locals}
+				p.locals++
+			}
+		}
+		for _, conn := range aliases {
+			pin, _ := sub.Output(conn.Inner.Name)
+			lo := parts[i].outOffset[pin.Name] + low(conn.Inner)
+			internal[conn.Outer.Name] = pp.out[lo : lo+width(conn.Inner, pin.Width)]
+		}
+		p.parts[i] = pp
+	}
+
+	// Second pass: wire up the inputs of every part, anything left unconnected is false
+	for i, part := range chip.Parts {
+		sub := parts[i].chip
+		pp := &p.parts[i]
+		pp.in = make([]ref, parts[i].inBits)
+		set := make([]bool, parts[i].inBits)
+
+		for _, conn := range part.Conns {
+			if _, ok := sub.Output(conn.Inner.Name); ok {
+				continue
+			}
+			pin, ok := sub.Input(conn.Inner.Name)
+			if !ok {
+				return nil, errorf(conn.Line, "%s has no pin named %s", part.Chip, conn.Inner.Name)
+			}
+			if conn.Inner.Sliced && conn.Inner.Hi >= pin.Width {
+				return nil, errorf(conn.Line, "%s is out of range for %s[%d]", conn.Inner, pin.Name, pin.Width)
+			}
+			lo := parts[i].inOffset[pin.Name] + low(conn.Inner)
+			w := width(conn.Inner, pin.Width)
+
+			var refs []ref
+			switch {
+			case conn.Outer.IsConstant():
+				if conn.Outer.Sliced {
+					return nil, errorf(conn.Line, "%s can't be sliced", conn.Outer.Name)
+				}
+				refs = make([]ref, w)
+				if conn.Outer.Name == "true" {
+					for k := range refs {
+						refs[k].kind = refTrue
+					}
+				}
+			case isPin(chip.Out, conn.Outer.Name):
+				return nil, errorf(conn.Line, "output pin %s can't be used as an input to %s", conn.Outer.Name, part.Chip)
+			case isPin(chip.In, conn.Outer.Name):
+				own, _ := chip.Input(conn.Outer.Name)
+				if conn.Outer.Sliced && conn.Outer.Hi >= own.Width {
+					return nil, errorf(conn.Line, "%s is out of range for %s[%d]", conn.Outer, own.Name, own.Width)
+				}
+				olo := p.inOffset[own.Name] + low(conn.Outer)
+				refs = make([]ref, width(conn.Outer, own.Width))
+				for k := range refs {
+					refs[k] = ref{kind: refIn, index: int32(olo + k)}
+				}
+			default:
+				if conn.Outer.Sliced {
+					return nil, errorf(conn.Line, "internal pin %s can't be sliced", conn.Outer.Name)
+				}
+				if refs, ok = internal[conn.Outer.Name]; !ok {
+					return nil, errorf(conn.Line, "pin %s is not connected to the output of any part", conn.Outer.Name)
+				}
+			}
+			if len(refs) != w {
+				return nil, errorf(conn.Line, "width mismatch: %s is %s but %s is %s", conn.Inner, bits(w), conn.Outer, bits(len(refs)))
+			}
+
+			for k := 0; k < w; k++ {
+				if set[lo+k] {
+					return nil, errorf(conn.Line, "input %s of %s is connected more than once", bit(pin, lo+k-parts[i].inOffset[pin.Name]), part.Chip)
+				}
+				set[lo+k] = true
+				pp.in[lo+k] = refs[k]
+			}
+		}
+	}
+
+	b.plans[chip] = p
+	return p, nil
+}
+
+// instantiate adds a chip to the netlist, wired to the given nets for its inputs and outputs
+func (b *builder) instantiate(p *plan, in []int32, out []int32) {
+	if p.chip.Builtin != "" {
+		b.builtin(p, in, out)
+		return
+	}
+
+	base := b.nets
+	b.nets += p.locals
+	resolve := func(r ref) int32 {
+		switch r.kind {
+		case refFalse:
+			return netFalse
+		case refTrue:
+			return netTrue
+		case refIn:
+			return in[r.index]
+		case refOut:
+			return out[r.index]
+		}
+		return base + r.index
+	}
+
+	for _, part := range p.parts {
+		// The nets of the part only need to live until it is instantiated, so they come off of a stack
+		mark := len(b.scratch)
+		for _, r := range part.in {
+			b.scratch = append(b.scratch, resolve(r))
+		}
+		for _, r := range part.out {
+			b.scratch = append(b.scratch, resolve(r))
+		}
+		for _, c := range part.copies {
+			b.nodes = append(b.nodes, node{kind: copyNode, a: resolve(c[0]), out: resolve(c[1])})
+		}
+		nets := b.scratch[mark:]
+		b.instantiate(part.plan, nets[:len(part.in)], nets[len(part.in):])
+		b.scratch = b.scratch[:mark]
+	}
+}
+
+// builtin adds a builtin chip to the netlist
+func (b *builder) builtin(p *plan, in []int32, out []int32) {
+	switch p.chip.Builtin {
+	case "Nand":
+		b.nodes = append(b.nodes, node{kind: nandNode, a: in[0], b: in[1], out: out[0]})
+		return
+	case "DFF":
+		b.dffs = append(b.dffs, dff{in: in[0], out: out[0]})
+		return
+	}
+
+	ports := &ports{in: make(map[string][]int32), out: make(map[string][]int32)}
+	for _, pin := range p.chip.In {
+		ports.in[pin.Name] = append([]int32(nil), in[p.inOffset[pin.Name]:p.inOffset[pin.Name]+pin.Width]...)
+	}
+	for _, pin := range p.chip.Out {
+		ports.out[pin.Name] = append([]int32(nil), out[p.outOffset[pin.Name]:p.outOffset[pin.Name]+pin.Width]...)
+	}
+	def := Builtins[p.chip.Builtin]
+	reads := make([]int32, 0)
+	for _, name := range def.Comb {
+		reads = append(reads, ports.in[name]...)
+	}
+
+	b.comps = append(b.comps, &instance{name: p.chip.Name, comp: def.New(ports), ports: ports, reads: reads})
+	b.nodes = append(b.nodes, node{kind: builtinNode, a: int32(len(b.comps) - 1)})
+}
+
+// reads returns the nets a node depends on straight away
+func (b *builder) reads(n node, buf []int32) []int32 {
+	switch n.kind {
+	case nandNode:
+		return append(buf[:0], n.a, n.b)
+	case copyNode:
+		return append(buf[:0], n.a)
+	}
+	return b.comps[n.a].reads
+}
+
+// sort orders the nodes so every node comes after the nodes that drive its inputs
+func (b *builder) sort() ([]node, error) {
+	driver := make([]int32, b.nets)
+	for i := range driver {
+		driver[i] = -1
+	}
+	for i, n := range b.nodes {
+		if n.kind == builtinNode {
+			for _, nets := range b.comps[n.a].ports.out {
+				for _, net := range nets {
+					driver[net] = int32(i)
+				}
+			}
+		} else {
+			driver[n.out] = int32(i)
+		}
+	}
+
+	// Count the dependencies of every node, and lay out the nodes that depend on each node one after another
+	pending := make([]int32, len(b.nodes))
+	start := make([]int32, len(b.nodes)+1)
+	buf := make([]int32, 0, 2)
+	for i, n := range b.nodes {
+		for _, net := range b.reads(n, buf) {
+			if d := driver[net]; d != -1 {
+				pending[i]++
+				start[d+1]++
+			}
+		}
+	}
+	for i := 1; i < len(start); i++ {
+		start[i] += start[i-1]
+	}
+	users := make([]int32, start[len(start)-1])
+	fill := append([]int32(nil), start[:len(b.nodes)]...)
+	for i, n := range b.nodes {
+		for _, net := range b.reads(n, buf) {
+			if d := driver[net]; d != -1 {
+				users[fill[d]] = int32(i)
+				fill[d]++
+			}
+		}
+	}
+
+	order := make([]node, 0, len(b.nodes))
+	queue := make([]int32, 0, len(b.nodes))
+	for i := range b.nodes {
+		if pending[i] == 0 {
+			queue = append(queue, int32(i))
+		}
+	}
+	for head := 0; head < len(queue); head++ {
+		i := queue[head]
+		order = append(order, b.nodes[i])
+		for _, u := range users[start[i]:start[i+1]] {
+			pending[u]--
+			if pending[u] == 0 {
+				queue = append(queue, u)
+			}
+		}
+	}
+
+	if len(order) != len(b.nodes) {
+		return nil, fmt.Errorf("combinational loop")
+	}
+	return order, nil
+}
@@ -0,0 +1,227 @@
+package hdl
+
+import (
+	"fmt"
+	"jackcompiler/pkg/hack"
+	"os"
+	"path/filepath"
+)
+
+// Builtin is a chip implemented in Go rather than HDL
+type Builtin struct {
+	Chip *Chip
+	// Comb lists the inputs that affect the outputs straight away, the rest are only read when the clock ticks
+	Comb []string
+	// New builds the chip's state, Nand and DFF have none since the simulator handles them itself
+	New func(p *ports) component
+}
+
+// component is the state of a builtin chip within a simulation
+type component interface {
+	// eval computes the outputs from the inputs and the current state
+	eval(v []uint8)
+	// tick reads the clocked inputs, and tock makes the new state visible
+	tick(v []uint8)
+	tock()
+	// get and set access the state as Name[] (index -1) or Name[index]
+	get(index int) (int, bool)
+	set(index int, value int) bool
+}
+
+// ports holds the nets wired to each pin of a builtin chip
+type ports struct {
+	in  map[string][]int32
+	out map[string][]int32
+}
+
+// read gets the value of an input from its nets, bit 0 first
+func (p *ports) read(v []uint8, pin string) int {
+	value := 0
+	for i, net := range p.in[pin] {
+		value |= int(v[net]) << i
+	}
+	return value
+}
+
+// write sets the nets of an output from a value
+func (p *ports) write(v []uint8, pin string, value int) {
+	for i, net := range p.out[pin] {
+		v[net] = uint8(value >> i & 1)
+	}
+}
+
+// chipOf builds the interface of a builtin chip, pins are name and width pairs
+func chipOf(name string, in []any, out []any) *Chip {
+	chip := &Chip{Name: name, File: "builtin", Builtin: name}
+	for i := 0; i < len(in); i += 2 {
+		chip.In = append(chip.In, &Pin{Name: in[i].(string), Width: in[i+1].(int)})
+	}
+	for i := 0; i < len(out); i += 2 {
+		chip.Out = append(chip.Out, &Pin{Name: out[i].(string), Width: out[i+1].(int)})
+	}
+	return chip
+}
+
+// Builtins holds the chips that don't have to be written in HDL
+// Nand and DFF are the primitives everything else is made of, the rest are the parts of the Hack platform
+// that the course provides rather than having you build
+var Builtins = map[string]*Builtin{
+	"Nand": {Chip: chipOf("Nand", []any{"a", 1, "b", 1}, []any{"out", 1}), Comb: []string{"a", "b"}},
+	"DFF":  {Chip: chipOf("DFF", []any{"in", 1}, []any{"out", 1})},
+	"ARegister": {
+		Chip: chipOf("ARegister", []any{"in", 16, "load", 1}, []any{"out", 16}),
+		New:  func(p *ports) component { return &register{ports: p} },
+	},
+	"DRegister": {
+		Chip: chipOf("DRegister", []any{"in", 16, "load", 1}, []any{"out", 16}),
+		New:  func(p *ports) component { return &register{ports: p} },
+	},
+	"ROM32K": {
+		Chip: chipOf("ROM32K", []any{"address", 15}, []any{"out", 16}),
+		Comb: []string{"address"},
+		New:  func(p *ports) component { return &memory{ports: p, words: make([]int, 32768), readOnly: true} },
+	},
+	"Screen": {
+		Chip: chipOf("Screen", []any{"in", 16, "load", 1, "address", 13}, []any{"out", 16}),
+		Comb: []string{"address"},
+		New:  func(p *ports) component { return &memory{ports: p, words: make([]int, 8192)} },
+	},
+	"Keyboard": {
+		Chip: chipOf("Keyboard", nil, []any{"out", 16}),
+		New:  func(p *ports) component { return &keyboard{ports: p} },
+	},
+}
+
+// register is a 16 bit register, which is what the CPU's A and D registers are
+type register struct {
+	ports *ports
+	value int
+	next  int
+}
+
+func (r *register) eval(v []uint8) {
+	r.ports.write(v, "out", r.value)
+}
+
+func (r *register) tick(v []uint8) {
+	r.next = r.value
+	if r.ports.read(v, "load") == 1 {
+		r.next = r.ports.read(v, "in")
+	}
+}
+
+func (r *register) tock() {
+	r.value = r.next
+}
+
+func (r *register) get(index int) (int, bool) {
+	return r.value, index == -1
+}
+
+func (r *register) set(index int, value int) bool {
+	if index != -1 {
+		return false
+	}
+	r.value, r.next = value&0xFFFF, value&0xFFFF
+	return true
+}
+
+// memory is a block of words, read by address straight away and written when the clock ticks
+type memory struct {
+	ports    *ports
+	words    []int
+	readOnly bool
+
+	pending bool
+	addr    int
+	value   int
+}
+
+func (m *memory) eval(v []uint8) {
+	m.ports.write(v, "out", m.words[m.ports.read(v, "address")])
+}
+
+func (m *memory) tick(v []uint8) {
+	m.pending = !m.readOnly && m.ports.read(v, "load") == 1
+	if m.pending {
+		m.addr = m.ports.read(v, "address")
+		m.value = m.ports.read(v, "in")
+	}
+}
+
+func (m *memory) tock() {
+	if m.pending {
+		m.words[m.addr] = m.value
+		m.pending = false
+	}
+}
+
+func (m *memory) get(index int) (int, bool) {
+	if index < 0 || index >= len(m.words) {
+		return 0, false
+	}
+	return m.words[index], true
+}
+
+func (m *memory) set(index int, value int) bool {
+	if index < 0 || index >= len(m.words) {
+		return false
+	}
+	m.words[index] = value & 0xFFFF
+	return true
+}
+
+// load fills the memory with a program, the way `ROM32K load Prog.hack` does in test scripts
+func (m *memory) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var program []uint16
+	if filepath.Ext(path) == ".asm" {
+		program, err = hack.Assemble(filepath.Base(path), f)
+	} else {
+		program, err = hack.ReadBinary(filepath.Base(path), f)
+	}
+	if err != nil {
+		return err
+	}
+	if len(program) > len(m.words) {
+		return fmt.Errorf("%s does not fit in memory", filepath.Base(path))
+	}
+	for i := range m.words {
+		m.words[i] = 0
+	}
+	for i, word := range program {
+		m.words[i] = int(word)
+	}
+	return nil
+}
+
+// keyboard holds the key currently pressed, which only changes when a test script sets it
+type keyboard struct {
+	ports *ports
+	key   int
+}
+
+func (k *keyboard) eval(v []uint8) {
+	k.ports.write(v, "out", k.key)
+}
+
+func (k *keyboard) tick(v []uint8) {}
+
+func (k *keyboard) tock() {}
+
+func (k *keyboard) get(index int) (int, bool) {
+	return k.key, index == -1
+}
+
+func (k *keyboard) set(index int, value int) bool {
+	if index != -1 {
+		return false
+	}
+	k.key = value & 0xFFFF
+	return true
+}
@@ -0,0 +1,381 @@
+package hdl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Check looks for wiring mistakes in a chip without building it, using the loader to find its parts
+// Unlike Build, it keeps going after the first problem so everything can be fixed at once
+func (l *Loader) Check(chip *Chip) []*Error {
+	c := &checker{loader: l, chip: chip, deps: make(map[*Chip]map[string][]string), active: make(map[*Chip]bool)}
+	c.check()
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Line < c.errors[j].Line
+	})
+	return c.errors
+}
+
+// CheckFile parses the chip in a .hdl file and checks it, looking for its parts in the chip's own directory,
+// then the directories of path, and then the rest of DefaultPath
+// A chip that doesn't parse gives a single problem, with the file's full path rather than its base name
+func CheckFile(hdlFile string, path []string) []*Error {
+	chip, err := ParseFile(hdlFile)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.File = hdlFile
+			return []*Error{e}
+		}
+		return []*Error{{File: hdlFile, Msg: err.Error()}}
+	}
+	search := DefaultPath(hdlFile)
+	search = append(append(append([]string{}, search[0]), path...), search[1:]...)
+	return NewLoader(search...).Check(chip)
+}
+
+// checker collects the problems with a single chip
+type checker struct {
+	loader *Loader
+	chip   *Chip
+	errors []*Error
+
+	// deps maps each chip to which inputs each of its outputs depend on straight away
+	deps   map[*Chip]map[string][]string
+	active map[*Chip]bool
+}
+
+// errorf records a problem
+func (c *checker) errorf(line int, format string, args ...any) {
+	c.errors = append(c.errors, &Error{File: c.chip.File, Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// internalPin is a pin that only exists inside the chip, created by connecting a part's output to it
+type internalPin struct {
+	width int
+	line  int
+}
+
+// check runs every check on the chip
+func (c *checker) check() {
+	chip := c.chip
+	seen := make(map[string]bool)
+	for _, pin := range append(append([]*Pin{}, chip.In...), chip.Out...) {
+		if seen[pin.Name] {
+			c.errorf(pin.Line, "pin %s is declared more than once", pin.Name)
+		}
+		seen[pin.Name] = true
+	}
+	if chip.Builtin != "" {
+		if _, ok := Builtins[chip.Builtin]; !ok {
+			c.errorf(chip.Line, "unknown builtin chip %s", chip.Builtin)
+		}
+		return
+	}
+
+	// Find the parts, skipping any that can't be loaded
+	parts := make([]*Chip, len(chip.Parts))
+	for i, part := range chip.Parts {
+		sub, err := c.loader.Load(part.Chip)
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				c.errorf(part.Line, "can't load %s: %v", part.Chip, e)
+			} else {
+				c.errorf(part.Line, "unknown chip %s", part.Chip)
+			}
+			continue
+		}
+		parts[i] = sub
+	}
+
+	// Outputs of parts define the internal pins, and drive the chip's outputs
+	internal := make(map[string]*internalPin)
+	driven := make(map[string][]bool)
+	for _, pin := range chip.Out {
+		driven[pin.Name] = make([]bool, pin.Width)
+	}
+	for i, part := range chip.Parts {
+		if parts[i] == nil {
+			continue
+		}
+		for _, conn := range part.Conns {
+			pin, ok := parts[i].Output(conn.Inner.Name)
+			if !ok {
+				continue
+			}
+			w, ok := c.slice(conn, conn.Inner, pin)
+			if !ok {
+				continue
+			}
+
+			switch {
+			case conn.Outer.IsConstant():
+				c.errorf(conn.Line, "output %s of %s can't be connected to %s", conn.Inner, part.Chip, conn.Outer.Name)
+			case isPin(chip.In, conn.Outer.Name):
+				c.errorf(conn.Line, "output %s of %s can't drive input pin %s", conn.Inner, part.Chip, conn.Outer.Name)
+			case isPin(chip.Out, conn.Outer.Name):
+				own, _ := chip.Output(conn.Outer.Name)
+				ow, ok := c.slice(conn, conn.Outer, own)
+				if !ok {
+					continue
+				}
+				if ow != w {
+					c.errorf(conn.Line, "width mismatch: %s of %s is %s but %s is %s", conn.Inner, part.Chip, bits(w), conn.Outer, bits(ow))
+					continue
+				}
+				for k := low(conn.Outer); k < low(conn.Outer)+ow; k++ {
+					if driven[own.Name][k] {
+						c.errorf(conn.Line, "%s has more than one driver", bit(own, k))
+						break
+					}
+					driven[own.Name][k] = true
+				}
+			default:
+				if conn.Outer.Sliced {
+					c.errorf(conn.Line, "internal pin %s can't be sliced", conn.Outer.Name)
+					continue
+				}
+				if prev, ok := internal[conn.Outer.Name]; ok {
+					c.errorf(conn.Line, "internal pin %s has more than one driver (also driven on line %d)", conn.Outer.Name, prev.line)
+					continue
+				}
+				internal[conn.Outer.Name] = &internalPin{width: w, line: conn.Line}
+			}
+		}
+	}
+
+	// Inputs of parts can read constants, the chip's inputs, and internal pins
+	for i, part := range chip.Parts {
+		if parts[i] == nil {
+			continue
+		}
+		set := make(map[string][]bool)
+		for _, conn := range part.Conns {
+			if _, ok := parts[i].Output(conn.Inner.Name); ok {
+				continue
+			}
+			pin, ok := parts[i].Input(conn.Inner.Name)
+			if !ok {
+				c.errorf(conn.Line, "%s has no pin named %s", part.Chip, conn.Inner.Name)
+				continue
+			}
+			w, ok := c.slice(conn, conn.Inner, pin)
+			if !ok {
+				continue
+			}
+			if set[pin.Name] == nil {
+				set[pin.Name] = make([]bool, pin.Width)
+			}
+			for k := low(conn.Inner); k < low(conn.Inner)+w; k++ {
+				if set[pin.Name][k] {
+					c.errorf(conn.Line, "input %s of %s is connected more than once", bit(pin, k), part.Chip)
+					break
+				}
+				set[pin.Name][k] = true
+			}
+
+			ow := w
+			switch {
+			case conn.Outer.IsConstant():
+				if conn.Outer.Sliced {
+					c.errorf(conn.Line, "%s can't be sliced", conn.Outer.Name)
+				}
+			case isPin(chip.Out, conn.Outer.Name):
+				c.errorf(conn.Line, "output pin %s can't be used as an input to %s", conn.Outer.Name, part.Chip)
+			case isPin(chip.In, conn.Outer.Name):
+				own, _ := chip.Input(conn.Outer.Name)
+				if ow, ok = c.slice(conn, conn.Outer, own); !ok {
+					continue
+				}
+			default:
+				in, ok := internal[conn.Outer.Name]
+				if !ok {
+					c.errorf(conn.Line, "pin %s is not connected to the output of any part", conn.Outer.Name)
+					continue
+				}
+				if conn.Outer.Sliced {
+					c.errorf(conn.Line, "internal pin %s can't be sliced", conn.Outer.Name)
+					continue
+				}
+				ow = in.width
+			}
+			if ow != w {
+				c.errorf(conn.Line, "width mismatch: %s of %s is %s but %s is %s", conn.Inner, part.Chip, bits(w), conn.Outer, bits(ow))
+			}
+		}
+	}
+
+	// Every bit of every output needs something driving it
+	for _, pin := range chip.Out {
+		for lo := 0; lo < pin.Width; lo++ {
+			if driven[pin.Name][lo] {
+				continue
+			}
+			hi := lo
+			for hi+1 < pin.Width && !driven[pin.Name][hi+1] {
+				hi++
+			}
+			bus := Bus{Name: pin.Name, Lo: lo, Hi: hi, Sliced: pin.Width > 1}
+			c.errorf(pin.Line, "output %s is not connected", bus)
+			lo = hi
+		}
+	}
+
+	c.loops(parts)
+}
+
+// slice checks that a bus fits within the pin it refers to, returning its width
+func (c *checker) slice(conn *Connection, bus Bus, pin *Pin) (int, bool) {
+	if bus.Sliced && bus.Hi >= pin.Width {
+		if pin.Width == 1 {
+			c.errorf(conn.Line, "%s is out of range, %s is a single bit", bus, pin.Name)
+		} else {
+			c.errorf(conn.Line, "%s is out of range, %s has bits 0..%d", bus, pin.Name, pin.Width-1)
+		}
+		return 0, false
+	}
+	return width(bus, pin.Width), true
+}
+
+// bit names a single bit of a pin
+func bit(pin *Pin, index int) string {
+	if pin.Width == 1 {
+		return pin.Name
+	}
+	return fmt.Sprintf("%s[%d]", pin.Name, index)
+}
+
+// bits describes a width
+func bits(width int) string {
+	if width == 1 {
+		return "1 bit"
+	}
+	return fmt.Sprintf("%d bits", width)
+}
+
+// edge is a path through a part from a signal it reads to a signal it drives
+type edge struct {
+	to   string
+	line int
+}
+
+// graph builds the edges between the signals of a chip, following only the paths that don't go through a clock
+func (c *checker) graph(chip *Chip, parts []*Chip) map[string][]edge {
+	edges := make(map[string][]edge)
+	for i, part := range chip.Parts {
+		if parts[i] == nil {
+			continue
+		}
+		deps := c.depsOf(parts[i])
+		for _, out := range part.Conns {
+			if _, ok := parts[i].Output(out.Inner.Name); !ok || out.Outer.IsConstant() || isPin(chip.In, out.Outer.Name) {
+				continue
+			}
+			for _, in := range part.Conns {
+				if _, ok := parts[i].Input(in.Inner.Name); !ok || in.Outer.IsConstant() {
+					continue
+				}
+				for _, dep := range deps[out.Inner.Name] {
+					if dep == in.Inner.Name {
+						edges[in.Outer.Name] = append(edges[in.Outer.Name], edge{to: out.Outer.Name, line: part.Line})
+					}
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// depsOf works out which inputs of a chip each of its outputs depend on without going through a clock
+func (c *checker) depsOf(chip *Chip) map[string][]string {
+	if deps, ok := c.deps[chip]; ok {
+		return deps
+	}
+	deps := make(map[string][]string)
+	if c.active[chip] {
+		return deps
+	}
+	c.active[chip] = true
+	defer delete(c.active, chip)
+
+	if chip.Builtin != "" {
+		if builtin, ok := Builtins[chip.Builtin]; ok {
+			for _, pin := range chip.Out {
+				deps[pin.Name] = builtin.Comb
+			}
+		}
+		c.deps[chip] = deps
+		return deps
+	}
+
+	parts := make([]*Chip, len(chip.Parts))
+	for i, part := range chip.Parts {
+		parts[i], _ = c.loader.Load(part.Chip)
+	}
+	edges := c.graph(chip, parts)
+	for _, in := range chip.In {
+		reached := make(map[string]bool)
+		stack := []string{in.Name}
+		for len(stack) > 0 {
+			signal := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range edges[signal] {
+				if !reached[e.to] {
+					reached[e.to] = true
+					stack = append(stack, e.to)
+				}
+			}
+		}
+		for _, out := range chip.Out {
+			if reached[out.Name] {
+				deps[out.Name] = append(deps[out.Name], in.Name)
+			}
+		}
+	}
+	c.deps[chip] = deps
+	return deps
+}
+
+// loops reports every loop of signals that doesn't go through a clocked part
+func (c *checker) loops(parts []*Chip) {
+	edges := c.graph(c.chip, parts)
+	signals := make([]string, 0, len(edges))
+	for signal := range edges {
+		signals = append(signals, signal)
+	}
+	sort.Strings(signals)
+
+	// Depth first search, where a signal that is still on the path has been reached again by going around a loop
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[string]int)
+	path := make([]string, 0)
+	var visit func(signal string)
+	visit = func(signal string) {
+		state[signal] = onPath
+		path = append(path, signal)
+		for _, e := range edges[signal] {
+			switch state[e.to] {
+			case unvisited:
+				visit(e.to)
+			case onPath:
+				start := len(path) - 1
+				for path[start] != e.to {
+					start--
+				}
+				loop := append(append([]string{}, path[start:]...), e.to)
+				c.errorf(e.line, "combinational loop: %s", strings.Join(loop, " -> "))
+			}
+		}
+		path = path[:len(path)-1]
+		state[signal] = done
+	}
+	for _, signal := range signals {
+		if state[signal] == unvisited {
+			visit(signal)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheck checks the problems hdlcheck reports for chips in testdata, found with the same CheckFile and -path it
+// uses since the chips are built from the repository's own
+// Problems are written as line: message, since the file name is whatever path the chip was checked at
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"Broken.hdl", []string{
+			"4: output wide[8..15] is not connected",
+			"4: output loose is not connected",
+			"7: combinational loop: loop1 -> loop2 -> loop1",
+			"10: width mismatch: out of Not16 is 16 bits but wide[8..15] is 8 bits",
+			"10: width mismatch: in of Not16 is 16 bits but a is 1 bit",
+			"11: And has no pin named c",
+			"12: b[16] is out of range, b has bits 0..15",
+			"13: unknown chip Xnor",
+			"14: out has more than one driver",
+			"14: pin nowhere is not connected to the output of any part",
+			"16: output out of Not can't drive input pin a",
+		}},
+		{"Counter.hdl", nil},
+	}
+	path := []string{filepath.Join(hardware, "01"), filepath.Join(hardware, "02"), filepath.Join(hardware, "03/a")}
+	for _, test := range tests {
+		errs := CheckFile(filepath.Join("testdata", test.file), path)
+		for i := 0; i < len(errs) || i < len(test.want); i++ {
+			switch {
+			case i >= len(errs):
+				t.Errorf("%s: missing %s", test.file, test.want[i])
+			case i >= len(test.want):
+				t.Errorf("%s: unexpected %v", test.file, errs[i])
+			case fmt.Sprintf("%d: %s", errs[i].Line, errs[i].Msg) != test.want[i]:
+				t.Errorf("%s: got %v, want %s", test.file, errs[i], test.want[i])
+			}
+		}
+	}
+}
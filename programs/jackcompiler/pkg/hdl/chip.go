@@ -0,0 +1,94 @@
+package hdl
+
+import (
+	"fmt"
+)
+
+// Pin is an input or output declared by a chip, Width is 1 for single bit pins
+type Pin struct {
+	Name  string
+	Width int
+	Line  int
+}
+
+// Bus refers to a pin by name, or to the bits Lo to Hi of it when Sliced is set
+// The names true and false are the constant buses
+type Bus struct {
+	Name   string
+	Lo     int
+	Hi     int
+	Sliced bool
+}
+
+func (b Bus) String() string {
+	if !b.Sliced {
+		return b.Name
+	}
+	if b.Lo == b.Hi {
+		return fmt.Sprintf("%s[%d]", b.Name, b.Lo)
+	}
+	return fmt.Sprintf("%s[%d..%d]", b.Name, b.Lo, b.Hi)
+}
+
+// IsConstant checks if the bus is true or false
+func (b Bus) IsConstant() bool {
+	return b.Name == "true" || b.Name == "false"
+}
+
+// Connection wires a pin of a part (Inner) to a signal of the chip it is used in (Outer)
+type Connection struct {
+	Inner Bus
+	Outer Bus
+	Line  int
+}
+
+// Part is a chip used inside another chip's PARTS section
+type Part struct {
+	Chip  string
+	Conns []*Connection
+	Line  int
+}
+
+// Chip is the parsed contents of a .hdl file
+type Chip struct {
+	Name  string
+	File  string
+	In    []*Pin
+	Out   []*Pin
+	Parts []*Part
+	// Builtin is the name of the builtin implementation for chips that use BUILTIN instead of PARTS
+	Builtin string
+	Clocked []string
+	Line    int
+}
+
+// Error is a problem with a chip, pointing at the line that caused it
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Input finds an input pin by name
+func (c *Chip) Input(name string) (*Pin, bool) {
+	for _, pin := range c.In {
+		if pin.Name == name {
+			return pin, true
+		}
+	}
+	return nil, false
+}
+
+// Output finds an output pin by name
+func (c *Chip) Output(name string) (*Pin, bool) {
+	for _, pin := range c.Out {
+		if pin.Name == name {
+			return pin, true
+		}
+	}
+	return nil, false
+}
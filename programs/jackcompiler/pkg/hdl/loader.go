@@ -0,0 +1,81 @@
+package hdl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Loader finds chips by name, looking through the directories of Path in order and then the builtins
+type Loader struct {
+	Path  []string
+	chips map[string]*Chip
+}
+
+// NewLoader constructs a loader that searches the given directories
+func NewLoader(path ...string) *Loader {
+	return &Loader{Path: path, chips: make(map[string]*Chip)}
+}
+
+// DefaultPath returns the directories searched for the parts of the chip in hdlFile
+// The chip's own directory comes first, followed by the earlier projects of the hardware directory it is in,
+// 01, 02, and everything in 03, so chips in hardware/05 can use the ones built in hardware/01 through hardware/03
+// The hardware directory is the parent or grandparent of the chip's directory that has a 01 in it
+func DefaultPath(hdlFile string) []string {
+	dir := filepath.Dir(hdlFile)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	path := []string{dir}
+
+	for root, level := filepath.Dir(dir), 0; level < 2; root, level = filepath.Dir(root), level+1 {
+		if info, err := os.Stat(filepath.Join(root, "01")); err != nil || !info.IsDir() {
+			continue
+		}
+		projects := []string{filepath.Join(root, "01"), filepath.Join(root, "02")}
+		parts, _ := filepath.Glob(filepath.Join(root, "03", "*"))
+		projects = append(projects, parts...)
+		for _, project := range projects {
+			if info, err := os.Stat(project); err == nil && info.IsDir() && project != dir {
+				path = append(path, project)
+			}
+		}
+		break
+	}
+	return path
+}
+
+// Load finds and parses a chip
+func (l *Loader) Load(name string) (*Chip, error) {
+	if chip, ok := l.chips[name]; ok {
+		return chip, nil
+	}
+
+	for _, dir := range l.Path {
+		path := filepath.Join(dir, name+".hdl")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		chip, err := ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if chip.Name != name {
+			return nil, &Error{File: filepath.Base(path), Line: chip.Line, Msg: fmt.Sprintf("file defines chip %s instead of %s", chip.Name, name)}
+		}
+		// Chips that point at a builtin take on its interface
+		if chip.Builtin != "" {
+			if _, ok := Builtins[chip.Builtin]; !ok {
+				return nil, &Error{File: filepath.Base(path), Line: chip.Line, Msg: fmt.Sprintf("unknown builtin chip %s", chip.Builtin)}
+			}
+		}
+		l.chips[name] = chip
+		return chip, nil
+	}
+
+	if builtin, ok := Builtins[name]; ok {
+		l.chips[name] = builtin.Chip
+		return builtin.Chip, nil
+	}
+	return nil, fmt.Errorf("chip %s not found", name)
+}
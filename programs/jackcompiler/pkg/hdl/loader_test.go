@@ -0,0 +1,51 @@
+package hdl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestDefaultPath checks that chips are looked for in their own directory and then the earlier projects,
+// without wandering into other directories
+func TestDefaultPath(t *testing.T) {
+	root := t.TempDir()
+	hw := filepath.Join(root, "hardware")
+	for _, dir := range []string{"01", "02", "03/a", "03/b", "04/fill", "05"} {
+		if err := os.MkdirAll(filepath.Join(hw, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Nothing outside the hardware directory is searched, even when it has chips in it
+	if err := os.MkdirAll(filepath.Join(root, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"hardware/05/CPU.hdl", []string{"05", "01", "02", "03/a", "03/b"}},
+		{"hardware/03/a/PC.hdl", []string{"03/a", "01", "02", "03/b"}},
+		{"hardware/01/And.hdl", []string{"01", "02", "03/a", "03/b"}},
+		{"hardware/04/fill/Fill.hdl", []string{"04/fill", "01", "02", "03/a", "03/b"}},
+	}
+	for _, test := range tests {
+		want := make([]string, len(test.want))
+		for i, dir := range test.want {
+			want[i] = filepath.Join(hw, dir)
+		}
+		if got := DefaultPath(filepath.Join(root, test.file)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", test.file, got, want)
+		}
+	}
+	if got := DefaultPath(filepath.Join(root, "other", "Chip.hdl")); !reflect.DeepEqual(got, []string{filepath.Join(root, "other")}) {
+		t.Errorf("a chip outside any hardware directory searches %v, want only its own directory", got)
+	}
+
+	// The repository's chips build with the default path
+	if _, err := BuildFile(filepath.Join(hardware, "03", "a", "PC.hdl")); err != nil {
+		t.Error(err)
+	}
+}
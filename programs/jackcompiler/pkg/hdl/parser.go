@@ -0,0 +1,338 @@
+package hdl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// token is a word, number, or punctuation of an HDL file
+type token struct {
+	text string
+	line int
+}
+
+// ParseFile reads and parses a .hdl file
+func ParseFile(path string) (*Chip, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, string(contents))
+}
+
+// Parse parses the contents of a .hdl file, path is used for error messages
+func Parse(path string, contents string) (*Chip, error) {
+	p := &parser{file: filepath.Base(path)}
+	if err := p.tokenize(contents); err != nil {
+		return nil, err
+	}
+	chip, err := p.chip()
+	if err != nil {
+		return nil, err
+	}
+	chip.File = path
+	return chip, nil
+}
+
+// parser builds a chip out of the tokens of an HDL file
+type parser struct {
+	file   string
+	tokens []token
+	pos    int
+}
+
+// errorf builds an error pointing at a line of the file
+func (p *parser) errorf(line int, format string, args ...any) error {
+	return &Error{File: p.file, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// tokenize splits the file into tokens, throwing away comments
+func (p *parser) tokenize(contents string) error {
+	line := 1
+	for i := 0; i < len(contents); {
+		c := contents[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(contents[i:], "//"):
+			for i < len(contents) && contents[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(contents[i:], "/*"):
+			end := strings.Index(contents[i+2:], "*/")
+			if end == -1 {
+				return p.errorf(line, "unterminated comment")
+			}
+			line += strings.Count(contents[i:i+end+4], "\n")
+			i += end + 4
+		case strings.HasPrefix(contents[i:], ".."):
+			p.tokens = append(p.tokens, token{text: "..", line: line})
+			i += 2
+		case strings.IndexByte("{}()[],;=:", c) != -1:
+			p.tokens = append(p.tokens, token{text: string(c), line: line})
+			i++
+		case isWordChar(c):
+			start := i
+			for i < len(contents) && isWordChar(contents[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, token{text: contents[start:i], line: line})
+		default:
+			return p.errorf(line, "unexpected character %q", c)
+		}
+	}
+	return nil
+}
+
+// isWordChar checks if a character can be part of a name or number
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// isName checks if a token is a name rather than a number or punctuation
+func isName(text string) bool {
+	return text != "" && isWordChar(text[0]) && (text[0] < '0' || text[0] > '9')
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		line := 1
+		if len(p.tokens) > 0 {
+			line = p.tokens[len(p.tokens)-1].line
+		}
+		return token{text: "", line: line}
+	}
+	return p.tokens[p.pos]
+}
+
+// next consumes the next token
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// expect consumes the next token, failing if it isn't the given text
+func (p *parser) expect(text string) (token, error) {
+	t := p.next()
+	if t.text != text {
+		return t, p.errorf(t.line, "expected %q, got %s", text, describe(t))
+	}
+	return t, nil
+}
+
+// name consumes a name
+func (p *parser) name(what string) (token, error) {
+	t := p.next()
+	if !isName(t.text) {
+		return t, p.errorf(t.line, "expected %s, got %s", what, describe(t))
+	}
+	return t, nil
+}
+
+// number consumes a non-negative number
+func (p *parser) number() (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if err != nil || n < 0 {
+		return 0, p.errorf(t.line, "expected a number, got %s", describe(t))
+	}
+	return n, nil
+}
+
+// describe names a token for error messages
+func describe(t token) string {
+	if t.text == "" {
+		return "end of file"
+	}
+	return strconv.Quote(t.text)
+}
+
+// chip parses CHIP Name { IN ...; OUT ...; PARTS: ... }
+func (p *parser) chip() (*Chip, error) {
+	start, err := p.expect("CHIP")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.name("chip name")
+	if err != nil {
+		return nil, err
+	}
+	chip := &Chip{Name: name.text, Line: start.line}
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	if p.peek().text == "IN" {
+		p.next()
+		if chip.In, err = p.pins(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().text == "OUT" {
+		p.next()
+		if chip.Out, err = p.pins(); err != nil {
+			return nil, err
+		}
+	}
+
+	switch t := p.next(); t.text {
+	case "PARTS":
+		if _, err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		for p.peek().text != "}" && p.peek().text != "" {
+			part, err := p.part()
+			if err != nil {
+				return nil, err
+			}
+			chip.Parts = append(chip.Parts, part)
+		}
+	case "BUILTIN":
+		builtin, err := p.name("builtin chip name")
+		if err != nil {
+			return nil, err
+		}
+		chip.Builtin = builtin.text
+		if _, err := p.expect(";"); err != nil {
+			return nil, err
+		}
+		if p.peek().text == "CLOCKED" {
+			p.next()
+			for {
+				pin, err := p.name("pin name")
+				if err != nil {
+					return nil, err
+				}
+				chip.Clocked = append(chip.Clocked, pin.text)
+				if p.peek().text != "," {
+					break
+				}
+				p.next()
+			}
+			if _, err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, p.errorf(t.line, "expected PARTS or BUILTIN, got %s", describe(t))
+	}
+
+	if _, err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.text != "" {
+		return nil, p.errorf(t.line, "unexpected %s after the end of the chip", describe(t))
+	}
+	return chip, nil
+}
+
+// pins parses a comma separated list of pin declarations up to a semicolon
+func (p *parser) pins() ([]*Pin, error) {
+	pins := make([]*Pin, 0)
+	for {
+		name, err := p.name("pin name")
+		if err != nil {
+			return nil, err
+		}
+		pin := &Pin{Name: name.text, Width: 1, Line: name.line}
+		if p.peek().text == "[" {
+			p.next()
+			if pin.Width, err = p.number(); err != nil {
+				return nil, err
+			}
+			if pin.Width < 1 || pin.Width > 16 {
+				return nil, p.errorf(name.line, "width of %s must be between 1 and 16", pin.Name)
+			}
+			if _, err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		pins = append(pins, pin)
+
+		if t := p.next(); t.text == ";" {
+			return pins, nil
+		} else if t.text != "," {
+			return nil, p.errorf(t.line, "expected \",\" or \";\", got %s", describe(t))
+		}
+	}
+}
+
+// part parses Name(pin=signal, ...);
+func (p *parser) part() (*Part, error) {
+	name, err := p.name("chip name")
+	if err != nil {
+		return nil, err
+	}
+	part := &Part{Chip: name.text, Line: name.line}
+	if _, err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	for {
+		inner, line, err := p.bus()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect("="); err != nil {
+			return nil, err
+		}
+		outer, _, err := p.bus()
+		if err != nil {
+			return nil, err
+		}
+		part.Conns = append(part.Conns, &Connection{Inner: inner, Outer: outer, Line: line})
+
+		if t := p.next(); t.text == ")" {
+			break
+		} else if t.text != "," {
+			return nil, p.errorf(t.line, "expected \",\" or \")\", got %s", describe(t))
+		}
+	}
+
+	if _, err := p.expect(";"); err != nil {
+		return nil, err
+	}
+	return part, nil
+}
+
+// bus parses a pin name with an optional [i] or [i..j] after it
+func (p *parser) bus() (Bus, int, error) {
+	name, err := p.name("pin name")
+	if err != nil {
+		return Bus{}, 0, err
+	}
+	bus := Bus{Name: name.text}
+	if p.peek().text != "[" {
+		return bus, name.line, nil
+	}
+
+	p.next()
+	bus.Sliced = true
+	if bus.Lo, err = p.number(); err != nil {
+		return Bus{}, 0, err
+	}
+	bus.Hi = bus.Lo
+	if p.peek().text == ".." {
+		p.next()
+		if bus.Hi, err = p.number(); err != nil {
+			return Bus{}, 0, err
+		}
+	}
+	if _, err := p.expect("]"); err != nil {
+		return Bus{}, 0, err
+	}
+	if bus.Hi < bus.Lo {
+		return Bus{}, 0, p.errorf(name.line, "invalid sub bus %s", bus)
+	}
+	return bus, name.line, nil
+}
@@ -0,0 +1,226 @@
+package hdl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Nets 0 and 1 always hold false and true
+const (
+	netFalse int32 = 0
+	netTrue  int32 = 1
+)
+
+// Kinds of node in the netlist
+const (
+	nandNode uint8 = iota
+	copyNode
+	builtinNode
+)
+
+// node is a combinational element of the netlist
+// For builtin nodes, a is the index of the component
+type node struct {
+	kind uint8
+	a    int32
+	b    int32
+	out  int32
+}
+
+// dff is a single bit of state, it remembers in when the clock ticks and shows it on out when it tocks
+type dff struct {
+	in   int32
+	out  int32
+	next uint8
+}
+
+// instance is a builtin chip with state within the netlist
+type instance struct {
+	name  string
+	comp  component
+	ports *ports
+	// reads are the nets the outputs depend on straight away
+	reads []int32
+}
+
+// Sim simulates a chip that has been flattened down to Nand gates, flip-flops, and builtin chips
+type Sim struct {
+	Chip *Chip
+
+	nets    []uint8
+	nodes   []node
+	dffs    []dff
+	comps   []*instance
+	inputs  map[string][]int32
+	outputs map[string][]int32
+}
+
+// Eval propagates the inputs through the combinational logic
+func (s *Sim) Eval() {
+	v := s.nets
+	for _, n := range s.nodes {
+		switch n.kind {
+		case nandNode:
+			v[n.out] = 1 ^ (v[n.a] & v[n.b])
+		case copyNode:
+			v[n.out] = v[n.a]
+		case builtinNode:
+			s.comps[n.a].comp.eval(v)
+		}
+	}
+}
+
+// Tick is the rising edge of the clock, where clocked chips read their inputs
+func (s *Sim) Tick() {
+	s.Eval()
+	for i := range s.dffs {
+		s.dffs[i].next = s.nets[s.dffs[i].in]
+	}
+	for _, c := range s.comps {
+		c.comp.tick(s.nets)
+	}
+}
+
+// Tock is the falling edge of the clock, where clocked chips show their new state
+func (s *Sim) Tock() {
+	for _, d := range s.dffs {
+		s.nets[d.out] = d.next
+	}
+	for _, c := range s.comps {
+		c.comp.tock()
+	}
+	s.Eval()
+}
+
+// Size returns the number of Nand gates and flip-flops the chip was flattened into
+func (s *Sim) Size() (int, int) {
+	nands := 0
+	for _, n := range s.nodes {
+		if n.kind == nandNode {
+			nands++
+		}
+	}
+	return nands, len(s.dffs)
+}
+
+// lookup finds the nets of a pin of the simulated chip, which may be sliced as name[i] or name[i..j]
+func (s *Sim) lookup(name string) ([]int32, bool, error) {
+	base, rest, sliced := strings.Cut(name, "[")
+	nets, isInput := s.inputs[base]
+	if !isInput {
+		var ok bool
+		if nets, ok = s.outputs[base]; !ok {
+			return nil, false, nil
+		}
+	}
+	if !sliced {
+		return nets, isInput, nil
+	}
+
+	var lo, hi int
+	if n, _ := fmt.Sscanf(rest, "%d..%d]", &lo, &hi); n != 2 {
+		if n, _ := fmt.Sscanf(rest, "%d]", &lo); n != 1 {
+			return nil, false, fmt.Errorf("invalid variable %q", name)
+		}
+		hi = lo
+	}
+	if lo < 0 || hi < lo || hi >= len(nets) {
+		return nil, false, fmt.Errorf("%s is out of range", name)
+	}
+	return nets[lo : hi+1], isInput, nil
+}
+
+// component finds the first builtin chip with the given name, for variables such as DRegister[] or RAM16K[5]
+func (s *Sim) component(name string) (component, int, error) {
+	base, rest, ok := strings.Cut(name, "[")
+	if !ok || !strings.HasSuffix(rest, "]") {
+		return nil, 0, fmt.Errorf("unknown variable %q", name)
+	}
+	index := -1
+	if rest != "]" {
+		if n, _ := fmt.Sscanf(rest, "%d]", &index); n != 1 || index < 0 {
+			return nil, 0, fmt.Errorf("invalid variable %q", name)
+		}
+	}
+	for _, c := range s.comps {
+		if c.name == base {
+			return c.comp, index, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("unknown variable %q", name)
+}
+
+// Get reads a pin, or the state of a builtin part
+// 16 bit values are signed, narrower ones are not
+func (s *Sim) Get(name string) (int, error) {
+	nets, _, err := s.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	if nets == nil {
+		comp, index, err := s.component(name)
+		if err != nil {
+			return 0, err
+		}
+		value, ok := comp.get(index)
+		if !ok {
+			return 0, fmt.Errorf("%s is out of range", name)
+		}
+		return int(int16(value)), nil
+	}
+
+	value := 0
+	for i, net := range nets {
+		value |= int(s.nets[net]) << i
+	}
+	if len(nets) == 16 {
+		value = int(int16(value))
+	}
+	return value, nil
+}
+
+// Set writes an input pin, or the state of a builtin part
+// Like the hardware simulator, changes to inputs aren't seen by the outputs until the next Eval, Tick, or Tock
+func (s *Sim) Set(name string, value int) error {
+	nets, isInput, err := s.lookup(name)
+	if err != nil {
+		return err
+	}
+	if nets == nil {
+		comp, index, err := s.component(name)
+		if err != nil {
+			return err
+		}
+		if !comp.set(index, value) {
+			return fmt.Errorf("%s is out of range", name)
+		}
+		return nil
+	}
+	if !isInput {
+		return fmt.Errorf("%s is an output and can't be set", name)
+	}
+
+	for i, net := range nets {
+		s.nets[net] = uint8(value >> i & 1)
+	}
+	return nil
+}
+
+// Command runs a chip specific command from a test script, such as `ROM32K load Prog.hack`
+// Relative file names are resolved against dir
+func (s *Sim) Command(chip string, args []string, dir string) error {
+	if len(args) != 2 || args[0] != "load" {
+		return fmt.Errorf("unknown command %s %s", chip, strings.Join(args, " "))
+	}
+	for _, c := range s.comps {
+		if mem, ok := c.comp.(*memory); ok && c.name == chip {
+			path := args[1]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			return mem.load(path)
+		}
+	}
+	return fmt.Errorf("%s can't load files", chip)
+}
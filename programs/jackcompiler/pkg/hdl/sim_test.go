@@ -0,0 +1,145 @@
+package hdl
+
+import (
+	"jackcompiler/pkg/hack"
+	"path/filepath"
+	"testing"
+)
+
+// hardware is where the repository's chips are, the simulator is tested by building them
+const hardware = "../../../../hardware"
+
+// buildChip builds one of the repository's chips, finding its parts in the earlier projects
+func buildChip(t *testing.T, name string) *Sim {
+	t.Helper()
+	dirs := []string{"01", "02", "03/a", "03/b"}
+	path := make([]string, len(dirs))
+	for i, dir := range dirs {
+		path[i] = filepath.Join(hardware, dir)
+	}
+	sim, err := NewLoader(path...).Build(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// setAll sets input pins and evaluates the chip
+func setAll(t *testing.T, sim *Sim, pins map[string]int) {
+	t.Helper()
+	for name, value := range pins {
+		if err := sim.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sim.Eval()
+}
+
+// mustGet reads a pin
+func mustGet(t *testing.T, sim *Sim, name string) int {
+	t.Helper()
+	value, err := sim.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// TestAnd checks the truth table of a chip made of a Nand and a Not
+func TestAnd(t *testing.T) {
+	sim := buildChip(t, "And")
+	for a := 0; a < 2; a++ {
+		for b := 0; b < 2; b++ {
+			setAll(t, sim, map[string]int{"a": a, "b": b})
+			if got := mustGet(t, sim, "out"); got != a&b {
+				t.Errorf("And(%d, %d) = %d, want %d", a, b, got, a&b)
+			}
+		}
+	}
+	if nands, dffs := sim.Size(); nands != 2 || dffs != 0 {
+		t.Errorf("And is %d Nands and %d DFFs, want 2 and 0", nands, dffs)
+	}
+}
+
+// TestALU checks every control setting against the CPU emulator's ALU, along with the zr and ng flags
+func TestALU(t *testing.T) {
+	sim := buildChip(t, "ALU")
+	pins := []string{"zx", "nx", "zy", "ny", "f", "no"}
+	values := [][2]int16{{0, 0}, {17, 3}, {-1, 1}, {-32768, 32767}, {12345, -4321}}
+	for _, xy := range values {
+		for control := uint16(0); control < 64; control++ {
+			inputs := map[string]int{"x": int(xy[0]), "y": int(xy[1])}
+			for i, pin := range pins {
+				inputs[pin] = int(control >> (5 - i) & 1)
+			}
+			setAll(t, sim, inputs)
+
+			want := hack.ALU(xy[0], xy[1], control)
+			zr, ng := 0, 0
+			if want == 0 {
+				zr = 1
+			}
+			if want < 0 {
+				ng = 1
+			}
+			out, gotZr, gotNg := mustGet(t, sim, "out"), mustGet(t, sim, "zr"), mustGet(t, sim, "ng")
+			if out != int(want) || gotZr != zr || gotNg != ng {
+				t.Errorf("ALU(%d, %d, %06b) = %d, zr %d, ng %d, want %d, zr %d, ng %d",
+					xy[0], xy[1], control, out, gotZr, gotNg, want, zr, ng)
+			}
+		}
+	}
+}
+
+// TestBit checks that a bit only changes when load is set, and not until the clock tocks
+func TestBit(t *testing.T) {
+	sim := buildChip(t, "Bit")
+	steps := []struct {
+		in, load int
+		// tick is the output between the tick and the tock, out is the output after the tock
+		tick, out int
+	}{
+		{1, 0, 0, 0},
+		{1, 1, 0, 1},
+		{0, 0, 1, 1},
+		{0, 1, 1, 0},
+		{1, 0, 0, 0},
+	}
+	for i, step := range steps {
+		setAll(t, sim, map[string]int{"in": step.in, "load": step.load})
+		sim.Tick()
+		tick := mustGet(t, sim, "out")
+		sim.Tock()
+		if out := mustGet(t, sim, "out"); tick != step.tick || out != step.out {
+			t.Errorf("step %d: out = %d after the tick and %d after the tock, want %d and %d", i, tick, out, step.tick, step.out)
+		}
+	}
+}
+
+// TestPC checks that reset beats load and load beats inc, and that the counter wraps around
+func TestPC(t *testing.T) {
+	sim := buildChip(t, "PC")
+	steps := []struct {
+		in, load, inc, reset int
+		out                  int
+	}{
+		{0, 0, 0, 0, 0},
+		{0, 0, 1, 0, 1},
+		{-32123, 0, 1, 0, 2},
+		{-32123, 1, 1, 0, -32123},
+		{-32123, 0, 0, 0, -32123},
+		{12345, 1, 0, 1, 0},
+		{32767, 1, 0, 0, 32767},
+		{0, 0, 1, 0, -32768},
+		{0, 0, 0, 0, -32768},
+		{5, 1, 1, 1, 0},
+	}
+	for i, step := range steps {
+		setAll(t, sim, map[string]int{"in": step.in, "load": step.load, "inc": step.inc, "reset": step.reset})
+		sim.Tick()
+		sim.Tock()
+		if out := mustGet(t, sim, "out"); out != step.out {
+			t.Errorf("step %d: out = %d, want %d", i, out, step.out)
+		}
+	}
+}
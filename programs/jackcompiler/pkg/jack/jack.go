@@ -0,0 +1,187 @@
+// Package jack compiles Jack programs held in memory, without touching the disk
+package jack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"jackcompiler/pkg/analyzer"
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/vm"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Options controls what Compile produces
+type Options struct {
+	// XML also produces the parse tree written by the analyzer for every class
+	XML bool
+	// LinkOS adds the compiled OS classes that the program doesn't define itself
+	LinkOS bool
+	// Optimize is the optimization level of the generated code, see compiler.Options
+	Optimize int
+}
+
+// File is the output for a single class
+type File struct {
+	// Name is the name of the class, which is also the name of the .vm file
+	Name string
+	VM   *vm.File
+	// XML is only filled in when Options.XML is set, and never for linked OS classes
+	XML []byte
+}
+
+// WriteVM writes the file in .vm format
+func (f *File) WriteVM(w io.Writer) error {
+	return vm.Write(w, f.VM.Commands)
+}
+
+// Result is everything produced by compiling a program, one file per class in the order they were given
+type Result struct {
+	Files []*File
+}
+
+// VMFiles returns the VM code of every file, ready for vm.NewMachine
+func (r Result) VMFiles() []*vm.File {
+	files := make([]*vm.File, len(r.Files))
+	for i, file := range r.Files {
+		files[i] = file.VM
+	}
+	return files
+}
+
+// Parse reads a single class from src
+// name is the file name used in error messages, e.g. Main.jack
+func Parse(name string, src io.Reader) (class *ast.Class, err error) {
+	defer recoverError(name, &err)
+
+	contents, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Parse(name, string(contents))
+}
+
+// Compile compiles a single class read from src
+// name is the file name, which must match the class, e.g. Main.jack for class Main
+func Compile(name string, src io.Reader, opts Options) (Result, error) {
+	contents, err := io.ReadAll(src)
+	if err != nil {
+		return Result{}, err
+	}
+	return compile([]source{{name: name, contents: string(contents)}}, opts)
+}
+
+// ParseFS reads every .jack file in the root of fsys, in name order
+func ParseFS(fsys fs.FS) ([]*ast.Class, error) {
+	sources, err := readFS(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make([]*ast.Class, 0, len(sources))
+	for _, src := range sources {
+		class, err := Parse(src.name, strings.NewReader(src.contents))
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+	}
+	return classes, nil
+}
+
+// CompileFS compiles every .jack file in the root of fsys as one program, in name order
+// Use fs.Sub to compile a directory further down
+func CompileFS(fsys fs.FS, opts Options) (Result, error) {
+	sources, err := readFS(fsys)
+	if err != nil {
+		return Result{}, err
+	}
+	return compile(sources, opts)
+}
+
+// source is a .jack file that has been read into memory
+type source struct {
+	name     string
+	contents string
+}
+
+// readFS reads the .jack files in the root of fsys
+func readFS(fsys fs.FS) ([]source, error) {
+	names, err := fs.Glob(fsys, "*.jack")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	sources := make([]source, 0, len(names))
+	for _, name := range names {
+		contents, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{name: name, contents: string(contents)})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no .jack files found")
+	}
+	return sources, nil
+}
+
+// compile compiles the sources as one program
+func compile(sources []source, opts Options) (result Result, err error) {
+	for _, src := range sources {
+		file, err := compileSource(src, opts)
+		if err != nil {
+			return Result{}, err
+		}
+		result.Files = append(result.Files, file)
+	}
+
+	if opts.LinkOS {
+		files, err := compiler.LinkOSWith(result.VMFiles(), compiler.Options{Optimize: opts.Optimize})
+		if err != nil {
+			return Result{}, err
+		}
+		for _, file := range files[len(result.Files):] {
+			result.Files = append(result.Files, &File{Name: file.Name, VM: file})
+		}
+	}
+	return result, nil
+}
+
+// compileSource compiles a single class
+func compileSource(src source, opts Options) (file *File, err error) {
+	name := path.Base(src.name)
+	defer recoverError(name, &err)
+
+	compiled, err := compiler.CompileWith(name, src.contents, compiler.Options{Optimize: opts.Optimize})
+	if err != nil {
+		return nil, err
+	}
+	file = &File{Name: compiled.Name, VM: compiled}
+
+	// The class is known to parse at this point, so the analyzer won't get stuck on it
+	if opts.XML {
+		engine := analyzer.NewStringEngine(name, src.contents)
+		var buf bytes.Buffer
+		if err := engine.Compile(&buf); err != nil {
+			if diagnostics := engine.Diagnostics(); len(diagnostics) > 0 {
+				return nil, fmt.Errorf("%s", strings.Join(diagnostics, "\n"))
+			}
+			return nil, err
+		}
+		file.XML = buf.Bytes()
+	}
+	return file, nil
+}
+
+// recoverError turns a panic from deeper in the compiler into an error, so callers never see one
+func recoverError(name string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%s: internal compiler error: %v", name, r)
+	}
+}
@@ -0,0 +1,144 @@
+package jack_test
+
+import (
+	"bytes"
+	"jackcompiler/pkg/jack"
+	"jackcompiler/pkg/vm"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// program is a two class program that needs the OS for Memory.alloc and Math.multiply
+var program = fstest.MapFS{
+	"Main.jack": {Data: []byte(`class Main {
+    static int result;
+
+    function void main() {
+        var Point p;
+        let p = Point.new(3, 4);
+        let result = p.dot(Point.new(5, -6));
+        return;
+    }
+}
+`)},
+	"Point.jack": {Data: []byte(`class Point {
+    field int x, y;
+
+    constructor Point new(int ax, int ay) {
+        let x = ax;
+        let y = ay;
+        return this;
+    }
+
+    method int dot(Point other) {
+        return (x * other.getX()) + (y * other.getY());
+    }
+
+    method int getX() {
+        return x;
+    }
+
+    method int getY() {
+        return y;
+    }
+}
+`)},
+	"README.md": {Data: []byte("Not a class\n")},
+}
+
+// TestCompileFS compiles a program from memory, writes its VM code out and reads it back, and runs it with the OS
+func TestCompileFS(t *testing.T) {
+	result, err := jack.CompileFS(program, jack.Options{XML: true, LinkOS: true, Optimize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) < 3 || result.Files[0].Name != "Main" || result.Files[1].Name != "Point" {
+		t.Fatalf("got %d files, want Main and Point followed by the OS", len(result.Files))
+	}
+
+	for i, file := range result.Files {
+		// Only the program's own classes have a parse tree
+		if hasXML := len(file.XML) > 0; hasXML != (i < 2) {
+			t.Errorf("%s: has xml %v, want %v", file.Name, hasXML, i < 2)
+		}
+
+		var written bytes.Buffer
+		if err := file.WriteVM(&written); err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := vm.Parse(file.Name, bytes.NewReader(written.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		var rewritten bytes.Buffer
+		if err := vm.Write(&rewritten, parsed.Commands); err != nil {
+			t.Fatal(err)
+		}
+		if rewritten.String() != written.String() {
+			t.Errorf("%s: reading the vm code back and writing it again gives\n%s\nwant\n%s", file.Name, rewritten.String(), written.String())
+		}
+	}
+	if xml := string(result.Files[1].XML); !strings.HasPrefix(xml, "<class>") || !strings.Contains(xml, "<identifier> dot </identifier>") {
+		t.Errorf("Point's parse tree is\n%s", xml)
+	}
+
+	m, err := vm.NewMachine(result.VMFiles())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Run(1000000); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted() {
+		t.Fatal("program didn't halt")
+	}
+	addr, _ := m.StaticAddress("Main", 0)
+	if got := m.RAM[addr]; got != -9 {
+		t.Errorf("Main.result = %d, want -9", got)
+	}
+}
+
+// TestCompile checks that compiling a class on its own gives the same code as compiling it with the rest of
+// the program, and that mistakes come back as errors
+func TestCompile(t *testing.T) {
+	whole, err := jack.CompileFS(program, jack.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := jack.Compile("Point.jack", bytes.NewReader(program["Point.jack"].Data), jack.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single.Files) != 1 {
+		t.Fatalf("got %d files, want 1", len(single.Files))
+	}
+	var want, got bytes.Buffer
+	if err := whole.Files[1].WriteVM(&want); err != nil {
+		t.Fatal(err)
+	}
+	if err := single.Files[0].WriteVM(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("Point compiles to\n%s\non its own, want\n%s", got.String(), want.String())
+	}
+
+	classes, err := jack.ParseFS(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(classes) != 2 || classes[0].Name != "Main" || len(classes[1].Subroutines) != 4 {
+		t.Errorf("parsed %d classes, want Main and Point with 4 subroutines", len(classes))
+	}
+
+	if _, err := jack.Compile("Main.jack", strings.NewReader("class Main {\n    function void main() {\n"), jack.Options{}); err == nil {
+		t.Error("compiled an unfinished class")
+	}
+	if _, err := jack.CompileFS(fstest.MapFS{}, jack.Options{}); err == nil || err.Error() != "no .jack files found" {
+		t.Errorf("got error %v compiling nothing, want no .jack files found", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Package jackgen generates random Jack classes that follow the grammar, for fuzzing and testing the compiler
+package jackgen
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Generator writes random classes, the same seed always gives the same classes
+type Generator struct {
+	rng *rand.Rand
+	out strings.Builder
+	// depth is how deeply the current statement or expression is nested
+	depth int
+	// MaxDepth limits nesting, which also keeps the size of each class in check
+	MaxDepth int
+	// Comments sprinkles comments of every style between tokens
+	Comments bool
+}
+
+// New constructs a generator from a seed
+func New(seed int64) *Generator {
+	return &Generator{rng: rand.New(rand.NewSource(seed)), MaxDepth: 4, Comments: true}
+}
+
+// names are the identifiers used for everything, short so that names collide often
+var names = []string{"a", "b", "i", "x", "y", "size", "Main", "Foo", "bar", "_t1"}
+
+var types = []string{"int", "char", "boolean", "Array", "String", "Foo"}
+
+var returnTypes = []string{"void", "int", "char", "boolean", "Array", "String", "Foo"}
+
+var ops = []string{"+", "-", "*", "/", "&", "|", "<", ">", "="}
+
+var keywordConstants = []string{"true", "false", "null", "this"}
+
+// Class returns the source of a random class with the given name
+func (g *Generator) Class(name string) string {
+	g.out.Reset()
+	g.depth = 0
+
+	g.write("class", name, "{")
+	for i := g.rng.Intn(3); i > 0; i-- {
+		g.write([]string{"static", "field"}[g.rng.Intn(2)], g.pick(types))
+		g.names()
+		g.write(";")
+	}
+	for i := 1 + g.rng.Intn(3); i > 0; i-- {
+		g.subroutine()
+	}
+	g.write("}")
+	return g.out.String()
+}
+
+// write adds tokens to the output, sometimes with a comment before them
+func (g *Generator) write(tokens ...string) {
+	for _, token := range tokens {
+		if g.Comments && g.rng.Intn(40) == 0 {
+			switch g.rng.Intn(3) {
+			case 0:
+				g.out.WriteString("// comment\n")
+			case 1:
+				g.out.WriteString("/* comment */ ")
+			default:
+				g.out.WriteString("/** api\n * comment */\n")
+			}
+		}
+		g.out.WriteString(token)
+		if g.rng.Intn(8) == 0 {
+			g.out.WriteString("\n")
+		} else {
+			g.out.WriteString(" ")
+		}
+	}
+}
+
+// pick returns a random element of list
+func (g *Generator) pick(list []string) string {
+	return list[g.rng.Intn(len(list))]
+}
+
+// names writes a comma separated list of names
+func (g *Generator) names() {
+	g.write(g.pick(names))
+	for i := g.rng.Intn(3); i > 0; i-- {
+		g.write(",", g.pick(names))
+	}
+}
+
+// subroutine writes a constructor, function, or method
+func (g *Generator) subroutine() {
+	kind := []string{"constructor", "function", "method"}[g.rng.Intn(3)]
+	g.write(kind, g.pick(returnTypes), g.pick(names), "(")
+	for i := g.rng.Intn(4); i > 0; i-- {
+		g.write(g.pick(types), g.pick(names))
+		if i > 1 {
+			g.write(",")
+		}
+	}
+	g.write(")", "{")
+	for i := g.rng.Intn(3); i > 0; i-- {
+		g.write("var", g.pick(types))
+		g.names()
+		g.write(";")
+	}
+	g.statements()
+	g.write("}")
+}
+
+// statements writes a random list of statements
+func (g *Generator) statements() {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	n := g.rng.Intn(5)
+	if g.depth > g.MaxDepth {
+		n = g.rng.Intn(2)
+	}
+	for ; n > 0; n-- {
+		g.statement()
+	}
+}
+
+// statement writes a single statement, only nesting further while there is depth left
+func (g *Generator) statement() {
+	choice := g.rng.Intn(5)
+	if g.depth > g.MaxDepth && (choice == 1 || choice == 2) {
+		choice = 0
+	}
+
+	switch choice {
+	case 0:
+		g.write("let", g.pick(names))
+		if g.rng.Intn(3) == 0 {
+			g.write("[")
+			g.expression()
+			g.write("]")
+		}
+		g.write("=")
+		g.expression()
+		g.write(";")
+	case 1:
+		g.write("if", "(")
+		g.expression()
+		g.write(")", "{")
+		g.statements()
+		g.write("}")
+		if g.rng.Intn(2) == 0 {
+			g.write("else", "{")
+			g.statements()
+			g.write("}")
+		}
+	case 2:
+		g.write("while", "(")
+		g.expression()
+		g.write(")", "{")
+		g.statements()
+		g.write("}")
+	case 3:
+		g.write("do")
+		g.call()
+		g.write(";")
+	default:
+		g.write("return")
+		if g.rng.Intn(2) == 0 {
+			g.expression()
+		}
+		g.write(";")
+	}
+}
+
+// expression writes term (op term)*
+func (g *Generator) expression() {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	g.term()
+	n := g.rng.Intn(3)
+	if g.depth > g.MaxDepth {
+		n = 0
+	}
+	for ; n > 0; n-- {
+		g.write(g.pick(ops))
+		g.term()
+	}
+}
+
+// term writes a single term, only nesting further while there is depth left
+func (g *Generator) term() {
+	choice := g.rng.Intn(9)
+	if g.depth > g.MaxDepth && choice >= 5 {
+		choice = g.rng.Intn(5)
+	}
+
+	switch choice {
+	case 0:
+		g.write(strconv.Itoa(g.rng.Intn(32768)))
+	case 1:
+		g.write(strconv.Quote(g.pick(names) + " text"))
+	case 2:
+		g.write(g.pick(keywordConstants))
+	case 3, 4:
+		g.write(g.pick(names))
+	case 5:
+		g.write(g.pick(names), "[")
+		g.expression()
+		g.write("]")
+	case 6:
+		g.call()
+	case 7:
+		g.write("(")
+		g.expression()
+		g.write(")")
+	default:
+		g.write([]string{"-", "~"}[g.rng.Intn(2)])
+		g.term()
+	}
+}
+
+// call writes a subroutine call, with or without a receiver
+func (g *Generator) call() {
+	if g.rng.Intn(2) == 0 {
+		g.write(g.pick(names), ".")
+	}
+	g.write(g.pick(names), "(")
+	if g.depth <= g.MaxDepth {
+		for i := g.rng.Intn(4); i > 0; i-- {
+			g.expression()
+			if i > 1 {
+				g.write(",")
+			}
+		}
+	}
+	g.write(")")
+}
@@ -0,0 +1,332 @@
+package jackgen
+
+import (
+	"jackcompiler/pkg/ast"
+	. "jackcompiler/pkg/common"
+	"strconv"
+)
+
+// ArraySize is the length of the array every generated program indexes into
+const ArraySize = 8
+
+// maxLoops is how deeply loops are nested, each subroutine has a counter for every level
+const maxLoops = 2
+
+// signature is a subroutine that generated code may call
+type signature struct {
+	receiver string
+	name     string
+	args     int
+	void     bool
+}
+
+// scope is what the code being generated can see
+type scope struct {
+	readable   []string
+	assignable []string
+	// counters are the loop counters that aren't in use yet, they are only readable inside their loop
+	counters []string
+	calls    []signature
+	// array is the name of an Array with ArraySize entries, or empty if there is none
+	array string
+	loops int
+}
+
+// Program returns a random program made up of a Main and a Box class
+// Unlike Class, the program is meant to be run: it always terminates, never divides by zero,
+// never indexes outside its array, and prints what it computes so that a miscompilation shows up in its output
+func (g *Generator) Program() []*ast.Class {
+	g.depth = 0
+
+	main := &ast.Class{Name: "Main", Vars: []*ast.ClassVarDec{{Kind: Static, Type: "int", Names: []string{"s0", "s1"}}}}
+	statics := []string{"s0", "s1"}
+
+	// Helpers only call the helpers before them, so nothing is recursive
+	helpers := make([]signature, 0)
+	for i := 1 + g.rng.Intn(3); i > 0; i-- {
+		name := "f" + strconv.Itoa(len(helpers))
+		s := &scope{
+			readable:   append([]string{"a", "b", "c", "d"}, statics...),
+			assignable: append([]string{"a", "b", "c", "d"}, statics...),
+			counters:   []string{"i0", "i1"},
+			calls:      append([]signature{}, helpers...),
+		}
+		sub := &ast.Subroutine{
+			Kind:       Function,
+			ReturnType: "int",
+			Name:       name,
+			Params:     []*ast.Param{{Type: "int", Name: "a"}, {Type: "int", Name: "b"}},
+			Locals:     []*ast.VarDec{{Type: "int", Names: []string{"c", "d", "i0", "i1"}}},
+		}
+		sub.Body = append(g.block(s), &ast.ReturnStatement{Value: g.value(s)})
+		main.Subroutines = append(main.Subroutines, sub)
+		helpers = append(helpers, signature{receiver: "Main", name: name, args: 2})
+	}
+
+	box := g.box(helpers)
+
+	s := &scope{
+		readable:   append([]string{"v0", "v1", "v2", "v3"}, statics...),
+		assignable: append([]string{"v0", "v1", "v2", "v3"}, statics...),
+		counters:   []string{"i0", "i1"},
+		calls:      append(append([]signature{}, helpers...), signature{receiver: "Box", name: "twice", args: 1}),
+		array:      "arr",
+	}
+	body := []ast.Statement{
+		&ast.LetStatement{Name: "arr", Value: call("Array", "new", &ast.IntegerConstant{Value: ArraySize})},
+	}
+	// Arrays start out holding whatever was in the heap, so they are filled in before they are read
+	body = append(body, loop("i0", ArraySize, []ast.Statement{
+		&ast.LetStatement{Name: "arr", Index: &ast.VarRef{Name: "i0"}, Value: &ast.VarRef{Name: "i0"}},
+	})...)
+	body = append(body, &ast.LetStatement{Name: "box", Value: call("Box", "new", g.value(s))})
+	// The methods of box can only be called once it has been constructed
+	s.calls = append(s.calls,
+		signature{receiver: "box", name: "get", args: 0},
+		signature{receiver: "box", name: "add", args: 1, void: true})
+	body = append(body, g.block(s)...)
+
+	// Print everything at the end so that any difference in the final state is seen
+	for _, expr := range []ast.Expression{
+		&ast.VarRef{Name: "v0"}, &ast.VarRef{Name: "v1"}, &ast.VarRef{Name: "v2"}, &ast.VarRef{Name: "v3"},
+		&ast.VarRef{Name: "s0"}, &ast.VarRef{Name: "s1"}, call("box", "get"),
+	} {
+		body = append(body, show(expr)...)
+	}
+	body = append(body, loop("i0", ArraySize, show(&ast.IndexExpr{Name: "arr", Index: &ast.VarRef{Name: "i0"}}))...)
+	body = append(body, &ast.ReturnStatement{})
+
+	main.Subroutines = append(main.Subroutines, &ast.Subroutine{
+		Kind:       Function,
+		ReturnType: "void",
+		Name:       "main",
+		Locals: []*ast.VarDec{
+			{Type: "int", Names: []string{"v0", "v1", "v2", "v3", "i0", "i1"}},
+			{Type: "Array", Names: []string{"arr"}},
+			{Type: "Box", Names: []string{"box"}},
+		},
+		Body: body,
+	})
+
+	return []*ast.Class{main, box}
+}
+
+// box generates a class with fields, a constructor, methods, and a function, which may call the helpers of Main
+func (g *Generator) box(helpers []signature) *ast.Class {
+	class := &ast.Class{Name: "Box", Vars: []*ast.ClassVarDec{{Kind: Field, Type: "int", Names: []string{"x", "y"}}}}
+	locals := []*ast.VarDec{{Type: "int", Names: []string{"t", "i0", "i1"}}}
+
+	twice := &scope{
+		readable:   []string{"n", "t"},
+		assignable: []string{"n", "t"},
+		counters:   []string{"i0", "i1"},
+		calls:      helpers,
+	}
+	get := &scope{
+		readable:   []string{"x", "y", "t"},
+		assignable: []string{"x", "y", "t"},
+		counters:   []string{"i0", "i1"},
+		calls:      append(append([]signature{}, helpers...), signature{receiver: "Box", name: "twice", args: 1}),
+	}
+	add := &scope{
+		readable:   []string{"x", "y", "t", "n"},
+		assignable: []string{"x", "y", "t", "n"},
+		counters:   []string{"i0", "i1"},
+		calls:      append(append([]signature{}, get.calls...), signature{name: "get", args: 0}),
+	}
+
+	// Fields start out holding whatever was in the heap, so the constructor sets them first
+	newBody := []ast.Statement{
+		&ast.LetStatement{Name: "x", Value: &ast.VarRef{Name: "n"}},
+		&ast.LetStatement{Name: "y", Value: &ast.IntegerConstant{Value: 0}},
+	}
+	newBody = append(newBody, g.block(add)...)
+	newBody = append(newBody, &ast.ReturnStatement{Value: &ast.KeywordConstant{Keyword: This}})
+
+	class.Subroutines = []*ast.Subroutine{
+		{Kind: Constructor, ReturnType: "Box", Name: "new", Params: []*ast.Param{{Type: "int", Name: "n"}}, Locals: locals, Body: newBody},
+		{Kind: Function, ReturnType: "int", Name: "twice", Params: []*ast.Param{{Type: "int", Name: "n"}}, Locals: locals,
+			Body: append(g.block(twice), &ast.ReturnStatement{Value: g.value(twice)})},
+		{Kind: Method, ReturnType: "int", Name: "get", Locals: locals,
+			Body: append(g.block(get), &ast.ReturnStatement{Value: g.value(get)})},
+		{Kind: Method, ReturnType: "void", Name: "add", Params: []*ast.Param{{Type: "int", Name: "n"}}, Locals: locals,
+			Body: append(g.block(add), &ast.ReturnStatement{})},
+	}
+	return class
+}
+
+// call builds a call expression
+func call(receiver string, name string, args ...ast.Expression) *ast.CallExpr {
+	return &ast.CallExpr{Receiver: receiver, Name: name, Args: args}
+}
+
+// show builds the statements that print an integer followed by a space
+func show(expr ast.Expression) []ast.Statement {
+	return []ast.Statement{
+		&ast.DoStatement{Call: call("Output", "printInt", expr)},
+		&ast.DoStatement{Call: call("Output", "printChar", &ast.IntegerConstant{Value: ' '})},
+	}
+}
+
+// loop builds the statements for counter going from 0 up to n
+func loop(counter string, n int, body []ast.Statement) []ast.Statement {
+	next := &ast.BinaryExpr{Op: '+', Left: &ast.VarRef{Name: counter}, Right: &ast.IntegerConstant{Value: 1}}
+	return []ast.Statement{
+		&ast.LetStatement{Name: counter, Value: &ast.IntegerConstant{Value: 0}},
+		&ast.WhileStatement{
+			Cond: &ast.BinaryExpr{Op: '<', Left: &ast.VarRef{Name: counter}, Right: &ast.IntegerConstant{Value: n}},
+			Body: append(body, &ast.LetStatement{Name: counter, Value: next}),
+		},
+	}
+}
+
+// block generates a random list of statements
+func (g *Generator) block(s *scope) []ast.Statement {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	n := 1 + g.rng.Intn(4)
+	if g.depth > g.MaxDepth {
+		n = g.rng.Intn(2)
+	}
+	statements := make([]ast.Statement, 0)
+	for ; n > 0; n-- {
+		statements = append(statements, g.command(s)...)
+	}
+	return statements
+}
+
+// command generates a single statement, or a loop along with the statement that starts its counter
+func (g *Generator) command(s *scope) []ast.Statement {
+	choice := g.rng.Intn(8)
+	if g.depth > g.MaxDepth && (choice == 3 || choice == 4) {
+		choice = 0
+	}
+	if choice == 4 && (len(s.counters) == 0 || s.loops >= maxLoops) {
+		choice = 0
+	}
+	if choice == 2 && s.array == "" {
+		choice = 0
+	}
+	if choice == 5 && (len(s.calls) == 0 || s.loops > 0) {
+		choice = 6
+	}
+
+	switch choice {
+	case 0, 1:
+		return []ast.Statement{&ast.LetStatement{Name: g.pick(s.assignable), Value: g.value(s)}}
+	case 2:
+		return []ast.Statement{&ast.LetStatement{Name: s.array, Index: g.index(s), Value: g.value(s)}}
+	case 3:
+		statement := &ast.IfStatement{Cond: g.value(s), Then: g.block(s)}
+		if g.rng.Intn(2) == 0 {
+			statement.Else = g.block(s)
+		}
+		return []ast.Statement{statement}
+	case 4:
+		// The counter can be read inside the loop but never assigned, so the loop always ends
+		counter := s.counters[0]
+		s.counters = s.counters[1:]
+		s.readable = append(s.readable, counter)
+		s.loops++
+		body := g.block(s)
+		s.loops--
+		s.readable = s.readable[:len(s.readable)-1]
+		s.counters = append([]string{counter}, s.counters...)
+		return loop(counter, g.rng.Intn(4), body)
+	case 5:
+		return []ast.Statement{&ast.DoStatement{Call: g.invoke(s, true)}}
+	case 6:
+		return show(g.value(s))
+	default:
+		return []ast.Statement{&ast.DoStatement{Call: call("Output", "printString", &ast.StringConstant{Value: g.pick(names) + "!"})}}
+	}
+}
+
+// index generates an expression that is always a valid index into the array
+func (g *Generator) index(s *scope) ast.Expression {
+	return &ast.BinaryExpr{Op: '&', Left: g.value(s), Right: &ast.IntegerConstant{Value: ArraySize - 1}}
+}
+
+// invoke generates a call to one of the subroutines in scope, void ones are only picked for do statements
+func (g *Generator) invoke(s *scope, void bool) *ast.CallExpr {
+	candidates := make([]signature, 0, len(s.calls))
+	for _, sig := range s.calls {
+		if void || !sig.void {
+			candidates = append(candidates, sig)
+		}
+	}
+	sig := candidates[g.rng.Intn(len(candidates))]
+
+	args := make([]ast.Expression, sig.args)
+	for i := range args {
+		args[i] = g.value(s)
+	}
+	return call(sig.receiver, sig.name, args...)
+}
+
+// value generates term (op term)*
+func (g *Generator) value(s *scope) ast.Expression {
+	g.depth++
+	defer func() { g.depth-- }()
+
+	expr := g.operand(s)
+	n := g.rng.Intn(3)
+	if g.depth > g.MaxDepth {
+		n = 0
+	}
+	for ; n > 0; n-- {
+		op := rune(g.pick(ops)[0])
+		right := g.operand(s)
+		// Dividing by an odd number is never dividing by zero
+		if op == '/' {
+			right = &ast.BinaryExpr{Op: '|', Left: right, Right: &ast.IntegerConstant{Value: 1}}
+		}
+		expr = &ast.BinaryExpr{Op: op, Left: expr, Right: right}
+	}
+	return expr
+}
+
+// operand generates a single term, only nesting further while there is depth left
+func (g *Generator) operand(s *scope) ast.Expression {
+	choice := g.rng.Intn(10)
+	if g.depth > g.MaxDepth && choice >= 5 {
+		choice = g.rng.Intn(5)
+	}
+	if choice == 5 && s.array == "" || choice == 6 && !g.canCall(s) {
+		choice = 2
+	}
+
+	switch choice {
+	case 0:
+		return &ast.IntegerConstant{Value: g.rng.Intn(10)}
+	case 1:
+		return &ast.IntegerConstant{Value: g.rng.Intn(32768)}
+	case 2, 3:
+		return &ast.VarRef{Name: g.pick(s.readable)}
+	case 4:
+		return &ast.KeywordConstant{Keyword: []KeywordType{True, False}[g.rng.Intn(2)]}
+	case 5:
+		return &ast.IndexExpr{Name: s.array, Index: g.index(s)}
+	case 6:
+		return g.invoke(s, false)
+	case 7, 8:
+		return &ast.UnaryExpr{Op: []rune{'-', '~'}[g.rng.Intn(2)], Operand: g.operand(s)}
+	default:
+		return g.value(s)
+	}
+}
+
+// canCall returns true if there is something that returns a value to call
+// Calls inside loops are left out, which keeps the number of steps a program takes reasonable
+func (g *Generator) canCall(s *scope) bool {
+	if s.loops > 0 {
+		return false
+	}
+	for _, sig := range s.calls {
+		if !sig.void {
+			return true
+		}
+	}
+	return false
+}
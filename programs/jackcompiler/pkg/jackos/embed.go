@@ -0,0 +1,13 @@
+package jackos
+
+import (
+	"embed"
+)
+
+// FS holds one .jack file per OS class
+//
+//go:embed *.jack
+var FS embed.FS
+
+// Classes lists the OS classes in the order they should be linked
+var Classes = []string{"Array", "Keyboard", "Math", "Memory", "Output", "Screen", "String", "Sys"}
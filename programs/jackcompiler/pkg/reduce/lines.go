@@ -0,0 +1,27 @@
+package reduce
+
+import (
+	"strings"
+)
+
+// Lines deletes as many lines of src as it can while keep still returns true, and returns what is left
+// It is for input that doesn't parse, so unlike Reduce the candidates it tries aren't always valid Jack
+func Lines(src string, keep func(string) bool) string {
+	lines := strings.SplitAfter(src, "\n")
+	for progress := true; progress; {
+		progress = false
+		// Large chunks go first, the last round removes single lines
+		for size := len(lines); size > 0; size /= 2 {
+			for start := 0; start < len(lines); {
+				candidate := without(lines, start, size)
+				if keep(strings.Join(candidate, "")) {
+					lines = candidate
+					progress = true
+					continue
+				}
+				start += size
+			}
+		}
+	}
+	return strings.Join(lines, "")
+}
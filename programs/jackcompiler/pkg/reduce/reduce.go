@@ -0,0 +1,315 @@
+// Package reduce shrinks Jack programs while they keep showing some behaviour, such as a compiler bug
+package reduce
+
+import (
+	"jackcompiler/pkg/ast"
+)
+
+// Reduce deletes as much of classes as it can while keep still returns true, and returns what is left
+// The classes are changed in place. Every candidate is still a syntactically valid program: classes,
+// subroutines, variables, parameters, statements, and call arguments are removed, if and while statements
+// are replaced by their bodies, and expressions are replaced by one of their operands or by 0.
+// Return statements are never dropped from a list, only simplified.
+func Reduce(classes []*ast.Class, keep func([]*ast.Class) bool) []*ast.Class {
+	r := &reducer{classes: classes, keep: keep}
+	for progress := true; progress; {
+		progress = r.removeClasses()
+		progress = r.removeSubroutines() || progress
+		progress = r.removeStatements() || progress
+		progress = r.flattenStatements() || progress
+		progress = r.simplifyExpressions() || progress
+		progress = r.removeArguments() || progress
+		progress = r.removeVariables() || progress
+	}
+	return r.classes
+}
+
+// reducer holds the program being reduced
+type reducer struct {
+	classes []*ast.Class
+	keep    func([]*ast.Class) bool
+}
+
+// try applies a change, undoing it again if the program no longer shows the behaviour
+func (r *reducer) try(apply func(), undo func()) bool {
+	apply()
+	if r.keep(r.classes) {
+		return true
+	}
+	undo()
+	return false
+}
+
+// removeClasses tries to drop whole classes, at least one is always left
+func (r *reducer) removeClasses() bool {
+	progress := false
+	for i := 0; i < len(r.classes) && len(r.classes) > 1; {
+		old := r.classes
+		if r.try(func() { r.classes = without(old, i, 1) }, func() { r.classes = old }) {
+			progress = true
+			continue
+		}
+		i++
+	}
+	return progress
+}
+
+// removeSubroutines tries to drop each subroutine
+func (r *reducer) removeSubroutines() bool {
+	progress := false
+	for _, class := range r.classes {
+		for i := 0; i < len(class.Subroutines); {
+			old := class.Subroutines
+			if r.try(func() { class.Subroutines = without(old, i, 1) }, func() { class.Subroutines = old }) {
+				progress = true
+				continue
+			}
+			i++
+		}
+	}
+	return progress
+}
+
+// removeStatements tries to drop runs of statements, starting with large runs and working down to single statements
+func (r *reducer) removeStatements() bool {
+	progress := false
+	// The lists are collected again after every change, so statements that were removed aren't visited
+	lists := walk(r.classes).lists
+	for k := 0; k < len(lists); k++ {
+		list := lists[k]
+		for size := len(*list); size > 0; size /= 2 {
+			for start := 0; start < len(*list); {
+				old := *list
+				candidate := withoutStatements(old, start, size)
+				if len(candidate) < len(old) && r.try(func() { *list = candidate }, func() { *list = old }) {
+					progress = true
+					lists = walk(r.classes).lists
+					continue
+				}
+				start += size
+			}
+		}
+	}
+	return progress
+}
+
+// flattenStatements tries to replace if and while statements with the statements inside them
+func (r *reducer) flattenStatements() bool {
+	progress := false
+	lists := walk(r.classes).lists
+	for k := 0; k < len(lists); k++ {
+		list := lists[k]
+		for i := 0; i < len(*list); i++ {
+			var bodies [][]ast.Statement
+			switch s := (*list)[i].(type) {
+			case *ast.IfStatement:
+				bodies = [][]ast.Statement{s.Then, s.Else}
+			case *ast.WhileStatement:
+				bodies = [][]ast.Statement{s.Body}
+			}
+			for _, body := range bodies {
+				old := *list
+				candidate := append(append(append([]ast.Statement{}, old[:i]...), body...), old[i+1:]...)
+				if r.try(func() { *list = candidate }, func() { *list = old }) {
+					progress = true
+					lists = walk(r.classes).lists
+					break
+				}
+			}
+		}
+	}
+	return progress
+}
+
+// simplifyExpressions tries to replace each expression with something smaller
+func (r *reducer) simplifyExpressions() bool {
+	progress := false
+	exprs := walk(r.classes).exprs
+	for k := 0; k < len(exprs); k++ {
+		expr := exprs[k]
+		for _, candidate := range simpler(*expr) {
+			old := *expr
+			if r.try(func() { *expr = candidate }, func() { *expr = old }) {
+				progress = true
+				exprs = walk(r.classes).exprs
+				break
+			}
+		}
+	}
+	return progress
+}
+
+// removeArguments tries to drop each argument of every call
+func (r *reducer) removeArguments() bool {
+	progress := false
+	calls := walk(r.classes).calls
+	for k := 0; k < len(calls); k++ {
+		call := calls[k]
+		for i := 0; i < len(call.Args); {
+			old := call.Args
+			if r.try(func() { call.Args = without(old, i, 1) }, func() { call.Args = old }) {
+				progress = true
+				calls = walk(r.classes).calls
+				continue
+			}
+			i++
+		}
+	}
+	return progress
+}
+
+// removeVariables tries to drop each declared variable and parameter, which only works once nothing uses it
+func (r *reducer) removeVariables() bool {
+	progress := false
+	for _, class := range r.classes {
+		// Going backwards means dropping a declaration doesn't move the ones still to come
+		for i := len(class.Vars) - 1; i >= 0; i-- {
+			progress = removeNames(r, &class.Vars, i, &class.Vars[i].Names) || progress
+		}
+		for _, sub := range class.Subroutines {
+			for i := len(sub.Locals) - 1; i >= 0; i-- {
+				progress = removeNames(r, &sub.Locals, i, &sub.Locals[i].Names) || progress
+			}
+			for i := len(sub.Params) - 1; i >= 0; i-- {
+				old := sub.Params
+				progress = r.try(func() { sub.Params = without(old, i, 1) }, func() { sub.Params = old }) || progress
+			}
+		}
+	}
+	return progress
+}
+
+// removeNames tries to drop each name of the declaration decs[i], dropping the declaration along with its last name
+// since declarations without any names aren't valid Jack
+func removeNames[T any](r *reducer, decs *[]T, i int, names *[]string) bool {
+	progress := false
+	for j := 0; j < len(*names); {
+		oldDecs, oldNames := *decs, *names
+		apply := func() { *names = without(oldNames, j, 1) }
+		if len(oldNames) == 1 {
+			apply = func() { *decs = without(oldDecs, i, 1) }
+		}
+		if r.try(apply, func() { *decs, *names = oldDecs, oldNames }) {
+			progress = true
+			if len(oldNames) == 1 {
+				return true
+			}
+			continue
+		}
+		j++
+	}
+	return progress
+}
+
+// without returns a copy of list with size elements removed from start
+func without[T any](list []T, start int, size int) []T {
+	end := start + size
+	if end > len(list) {
+		end = len(list)
+	}
+	return append(append([]T{}, list[:start]...), list[end:]...)
+}
+
+// withoutStatements removes a run of statements, keeping any return statements in it
+func withoutStatements(list []ast.Statement, start int, size int) []ast.Statement {
+	result := make([]ast.Statement, 0, len(list))
+	for i, statement := range list {
+		if _, ok := statement.(*ast.ReturnStatement); ok || i < start || i >= start+size {
+			result = append(result, statement)
+		}
+	}
+	return result
+}
+
+// simpler returns the expressions that could replace expr, smallest change first
+func simpler(expr ast.Expression) []ast.Expression {
+	zero := &ast.IntegerConstant{Value: 0}
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		return []ast.Expression{zero, e.Left, e.Right}
+	case *ast.UnaryExpr:
+		return []ast.Expression{zero, e.Operand}
+	case *ast.CallExpr:
+		return append([]ast.Expression{zero}, e.Args...)
+	case *ast.IndexExpr:
+		return []ast.Expression{zero, e.Index}
+	case *ast.IntegerConstant:
+		if e.Value == 0 {
+			return nil
+		}
+	case *ast.StringConstant:
+		if e.Value != "" {
+			return []ast.Expression{&ast.StringConstant{}, zero}
+		}
+	}
+	return []ast.Expression{zero}
+}
+
+// walk finds every statement list, expression, and call in classes, outermost first
+func walk(classes []*ast.Class) *collector {
+	c := &collector{}
+	for _, class := range classes {
+		for _, sub := range class.Subroutines {
+			c.statements(&sub.Body)
+		}
+	}
+	return c
+}
+
+// collector walks the syntax tree, keeping pointers to the parts that can be replaced
+type collector struct {
+	lists []*[]ast.Statement
+	exprs []*ast.Expression
+	calls []*ast.CallExpr
+}
+
+// statements walks a statement list
+func (c *collector) statements(list *[]ast.Statement) {
+	c.lists = append(c.lists, list)
+	for _, statement := range *list {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			if s.Index != nil {
+				c.expression(&s.Index)
+			}
+			c.expression(&s.Value)
+		case *ast.IfStatement:
+			c.expression(&s.Cond)
+			c.statements(&s.Then)
+			if s.Else != nil {
+				c.statements(&s.Else)
+			}
+		case *ast.WhileStatement:
+			c.expression(&s.Cond)
+			c.statements(&s.Body)
+		case *ast.DoStatement:
+			c.calls = append(c.calls, s.Call)
+			for i := range s.Call.Args {
+				c.expression(&s.Call.Args[i])
+			}
+		case *ast.ReturnStatement:
+			if s.Value != nil {
+				c.expression(&s.Value)
+			}
+		}
+	}
+}
+
+// expression walks an expression
+func (c *collector) expression(expr *ast.Expression) {
+	c.exprs = append(c.exprs, expr)
+	switch e := (*expr).(type) {
+	case *ast.BinaryExpr:
+		c.expression(&e.Left)
+		c.expression(&e.Right)
+	case *ast.UnaryExpr:
+		c.expression(&e.Operand)
+	case *ast.IndexExpr:
+		c.expression(&e.Index)
+	case *ast.CallExpr:
+		c.calls = append(c.calls, e)
+		for i := range e.Args {
+			c.expression(&e.Args[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package reduce_test
+
+import (
+	"bytes"
+	"jackcompiler/pkg/ast"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/reduce"
+	"strings"
+	"testing"
+)
+
+// format writes classes back out as Jack
+func format(t *testing.T, classes []*ast.Class) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, class := range classes {
+		if err := ast.Format(&buf, class); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+// TestReduce keeps a division by a call nested inside loops and ifs, and checks that everything around it goes
+// while what is left still parses, the keep check doesn't ask for j to be declared
+func TestReduce(t *testing.T) {
+	sources := []string{`class Main {
+    static int total;
+
+    function void main() {
+        var int i, j;
+        let i = 0;
+        while (i < 10) {
+            if (i > 3) {
+                let j = (i + 1) / Util.twice(i, 2);
+                let total = total + j;
+            }
+            let i = i + 1;
+        }
+        do Output.printInt(total);
+        return;
+    }
+}
+`, `class Util {
+    function int twice(int x, int unused) {
+        return x + x;
+    }
+
+    function int never() {
+        return 7;
+    }
+}
+`, `class Extra {
+    field int a;
+}
+`}
+	var classes []*ast.Class
+	for _, src := range sources {
+		class, err := compiler.Parse("Class.jack", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		classes = append(classes, class)
+	}
+
+	tried := 0
+	keep := func(candidate []*ast.Class) bool {
+		tried++
+		return strings.Contains(format(t, candidate), "/ Util.twice(")
+	}
+	reduced := reduce.Reduce(classes, keep)
+	got := format(t, reduced)
+	if !keep(reduced) {
+		t.Fatalf("reduced program lost the division\n%s", got)
+	}
+
+	want := `class Main {
+    function void main() {
+        let j = 0 / Util.twice();
+        return;
+    }
+}
+`
+	if got != want {
+		t.Errorf("reduced to\n%s\nafter %d tries, want\n%s", got, tried, want)
+	}
+	for _, class := range reduced {
+		if _, err := compiler.Parse(class.Name+".jack", format(t, []*ast.Class{class})); err != nil {
+			t.Errorf("reduced %s doesn't parse: %v", class.Name, err)
+		}
+	}
+}
+
+// TestLines checks that lines are removed both in chunks and one at a time
+func TestLines(t *testing.T) {
+	src := "a\nb\nc\nd\ne\nf\ng\n"
+	got := reduce.Lines(src, func(candidate string) bool {
+		return strings.Contains(candidate, "b\n") && strings.Contains(candidate, "f\n")
+	})
+	if got != "b\nf\n" {
+		t.Errorf("got %q, want %q", got, "b\nf\n")
+	}
+	if got := reduce.Lines(src, func(string) bool { return true }); got != "" {
+		t.Errorf("got %q when everything can go, want nothing", got)
+	}
+}
@@ -0,0 +1,52 @@
+package screen_test
+
+import (
+	"bytes"
+	"flag"
+	"jackcompiler/pkg/compiler"
+	"jackcompiler/pkg/screen"
+	"jackcompiler/pkg/vm"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden screenshots in testdata")
+
+// TestGolden runs 2048 until it has drawn its first board and waits for a key, and compares the screen against
+// testdata/2048.pbm, run with -update to regenerate it
+func TestGolden(t *testing.T) {
+	files, err := compiler.CompileProgram(filepath.Join("..", "..", "..", "2048"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine, err := vm.NewMachine(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := machine.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	// The board is finished well before this, after that the game only polls the keyboard
+	if err := machine.Run(1000000); err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	if err := screen.WritePBM(&got, machine.RAM[screen.Base:screen.Base+screen.Words]); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "2048.pbm")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("the screen doesn't match %s, check it with jackcompiler run -steps 1000000 -png and rerun with -update", golden)
+	}
+}
@@ -0,0 +1,82 @@
+package screen
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// palette maps 0 to white and 1 to black like the Hack screen
+var palette = color.Palette{color.White, color.Black}
+
+// Image converts the screen memory map into an image
+func Image(mem []int16) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, Width, Height), palette)
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			if Pixel(mem, x, y) {
+				img.Pix[y*img.Stride+x] = 1
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the screen as a black and white PNG
+func WritePNG(w io.Writer, mem []int16) error {
+	return png.Encode(w, Image(mem))
+}
+
+// WritePBM writes the screen as a binary (P4) PBM, where set bits are black
+func WritePBM(w io.Writer, mem []int16) error {
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "P4\n%d %d\n", Width, Height); err != nil {
+		return err
+	}
+
+	// PBM packs pixels most significant bit first, the Hack screen packs them least significant bit first
+	row := make([]byte, Width/8)
+	for y := 0; y < Height; y++ {
+		for i := range row {
+			row[i] = 0
+		}
+		for x := 0; x < Width; x++ {
+			if Pixel(mem, x, y) {
+				row[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteFile saves the screen to path, picking PNG or PBM from the extension
+func WriteFile(path string, mem []int16) error {
+	var write func(io.Writer, []int16) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		write = WritePNG
+	case ".pbm":
+		write = WritePBM
+	default:
+		return fmt.Errorf("%s: screenshots must end in .png or .pbm", path)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file, mem); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
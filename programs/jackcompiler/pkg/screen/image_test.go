@@ -0,0 +1,109 @@
+package screen
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pixels are set in the screen memory by testMemory, each sits at a different bit of its word
+var pixels = [][2]int{{0, 0}, {15, 0}, {16, 0}, {8, 1}, {511, 255}}
+
+// testMemory sets pixels the way Screen.drawPixel does, bit x % 16 of word y * 32 + x / 16
+func testMemory() []int16 {
+	mem := make([]int16, Words)
+	for _, p := range pixels {
+		mem[p[1]*WordsPerRow+p[0]/16] |= int16(uint16(1) << (p[0] % 16))
+	}
+	return mem
+}
+
+// TestWritePBM checks that the least significant bit first Hack words come out most significant bit first
+func TestWritePBM(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePBM(&buf, testMemory()); err != nil {
+		t.Fatal(err)
+	}
+
+	header := fmt.Sprintf("P4\n%d %d\n", Width, Height)
+	want := make([]byte, Width/8*Height)
+	// x = 0 and 15 are the ends of the first word, x = 16 starts the next
+	want[0] = 0x80
+	want[1] = 0x01
+	want[2] = 0x80
+	want[Width/8+1] = 0x80
+	want[len(want)-1] = 0x01
+	if got := buf.String(); got != header+string(want) {
+		if len(got) != len(header)+len(want) || got[:len(header)] != header {
+			t.Fatalf("got %d bytes starting %q, want %d starting %q", len(got), got[:len(header)], len(header)+len(want), header)
+		}
+		for i := range want {
+			if got[len(header)+i] != want[i] {
+				t.Errorf("byte %d of row %d is %08b, want %08b", i%(Width/8), i/(Width/8), got[len(header)+i], want[i])
+			}
+		}
+	}
+}
+
+// TestWritePNG checks that exactly the pixels that were set are black
+func TestWritePNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePNG(&buf, testMemory()); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != Width || size.Y != Height {
+		t.Fatalf("image is %v, want %dx%d", size, Width, Height)
+	}
+
+	set := make(map[[2]int]bool)
+	for _, p := range pixels {
+		set[p] = true
+	}
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			black := r == 0 && g == 0 && b == 0
+			white := r == 0xffff && g == 0xffff && b == 0xffff
+			if black != set[[2]int{x, y}] || black == white {
+				t.Errorf("pixel (%d, %d) is %v", x, y, img.At(x, y))
+			}
+		}
+	}
+}
+
+// TestWriteFile checks that the extension picks the format
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	mem := testMemory()
+	var pbm bytes.Buffer
+	if err := WritePBM(&pbm, mem); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(filepath.Join(dir, "Shot.PBM"), mem); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "Shot.PBM")); err != nil || !bytes.Equal(got, pbm.Bytes()) {
+		t.Errorf("Shot.PBM isn't the PBM of the screen: %v", err)
+	}
+	if err := WriteFile(filepath.Join(dir, "shot.png"), mem); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := os.Open(filepath.Join(dir, "shot.png")); err != nil {
+		t.Error(err)
+	} else {
+		if _, err := png.Decode(f); err != nil {
+			t.Errorf("shot.png isn't a PNG: %v", err)
+		}
+		f.Close()
+	}
+	if err := WriteFile(filepath.Join(dir, "shot.gif"), mem); err == nil {
+		t.Error("wrote a .gif")
+	}
+}
@@ -0,0 +1,106 @@
+package screen
+
+import (
+	"strings"
+)
+
+// Geometry of the Hack screen and where it lives in memory
+const (
+	Width       = 512
+	Height      = 256
+	Base        = 16384
+	WordsPerRow = Width / 16
+	Words       = WordsPerRow * Height
+)
+
+// Pixel returns true if the pixel at column x and row y is black
+// mem holds the screen memory map, starting at the first word of the screen
+func Pixel(mem []int16, x int, y int) bool {
+	word := mem[y*WordsPerRow+x/16]
+	return word>>(x%16)&1 != 0
+}
+
+// Mode is an enum for how pixels are drawn with text characters
+type Mode int
+
+const (
+	// Braille packs 2x4 dots into every character
+	Braille Mode = iota
+	// HalfBlock packs 1x2 dots into every character using the upper and lower half block characters
+	HalfBlock
+)
+
+// ModeMap will map modes by string to their respective type
+var ModeMap = map[string]Mode{
+	"braille":   Braille,
+	"halfblock": HalfBlock,
+}
+
+// braille dot bits in the order of the dot's row then column
+var brailleBits = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// halfBlocks is indexed by (top dot) | (bottom dot) << 1
+var halfBlocks = [4]rune{' ', '▀', '▄', '█'}
+
+// dot returns true if any pixel within the scale x scale block for a dot is black
+// Using any rather than most keeps one pixel wide lines visible when scaled down
+func dot(mem []int16, dx int, dy int, scale int) bool {
+	for y := dy * scale; y < (dy+1)*scale && y < Height; y++ {
+		for x := dx * scale; x < (dx+1)*scale && x < Width; x++ {
+			if Pixel(mem, x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Text renders the screen as lines of text, every dot covering a scale x scale block of pixels
+func Text(mem []int16, mode Mode, scale int) []string {
+	if scale < 1 {
+		scale = 1
+	}
+
+	cellW, cellH := 2, 4
+	if mode == HalfBlock {
+		cellW, cellH = 1, 2
+	}
+	dotsW := (Width + scale - 1) / scale
+	dotsH := (Height + scale - 1) / scale
+	cols := (dotsW + cellW - 1) / cellW
+	rows := (dotsH + cellH - 1) / cellH
+
+	lines := make([]string, rows)
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		b.Reset()
+		for col := 0; col < cols; col++ {
+			var ch rune
+			for i := 0; i < cellH; i++ {
+				for j := 0; j < cellW; j++ {
+					dx, dy := col*cellW+j, row*cellH+i
+					if dx >= dotsW || dy >= dotsH || !dot(mem, dx, dy, scale) {
+						continue
+					}
+					if mode == HalfBlock {
+						ch |= 1 << i
+					} else {
+						ch |= brailleBits[i][j]
+					}
+				}
+			}
+			if mode == HalfBlock {
+				b.WriteRune(halfBlocks[ch])
+			} else {
+				b.WriteRune(0x2800 + ch)
+			}
+		}
+		lines[row] = b.String()
+	}
+	return lines
+}
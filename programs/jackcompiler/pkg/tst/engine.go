@@ -0,0 +1,286 @@
+package tst
+
+import (
+	"fmt"
+	"jackcompiler/pkg/hack"
+	"jackcompiler/pkg/hdl"
+	"jackcompiler/pkg/vm"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Engine is something a test script can drive, such as the VM or the Hack CPU
+type Engine interface {
+	// Get reads a variable, such as RAM[256] or sp
+	Get(name string) (int, error)
+	// Set writes a variable
+	Set(name string, value int) error
+	// Step runs a stepping command, such as vmstep or ticktock
+	Step(command string) error
+}
+
+// Commander is implemented by engines that have their own commands, such as `ROM32K load Prog.hack`
+type Commander interface {
+	Command(name string, args []string, dir string) error
+}
+
+// Loader builds an engine from the file or directory named by a load command
+type Loader func(path string) (Engine, error)
+
+// Loaders maps file extensions to the engine that runs them, directories use the "" entry
+var Loaders = map[string]Loader{
+	"":      LoadVM,
+	".vm":   LoadVM,
+	".asm":  LoadCPU,
+	".hack": LoadCPU,
+	".hdl":  LoadHDL,
+}
+
+// splitIndex splits a variable such as RAM[12] into its name and index
+// The index is -1 if there is none
+func splitIndex(name string) (string, int, error) {
+	open := strings.IndexByte(name, '[')
+	if open == -1 {
+		return name, -1, nil
+	}
+	if !strings.HasSuffix(name, "]") {
+		return "", 0, fmt.Errorf("invalid variable %q", name)
+	}
+	index, err := strconv.Atoi(name[open+1 : len(name)-1])
+	if err != nil || index < 0 {
+		return "", 0, fmt.Errorf("invalid variable %q", name)
+	}
+	return name[:open], index, nil
+}
+
+// VMEngine runs VM programs one command at a time, like the VM emulator
+type VMEngine struct {
+	Machine *vm.Machine
+}
+
+// vmPointers maps the VM emulator's names for the pointer registers to their addresses
+var vmPointers = map[string]int{
+	"sp":       vm.SP,
+	"local":    vm.LCL,
+	"argument": vm.ARG,
+	"this":     vm.THIS,
+	"that":     vm.THAT,
+}
+
+// LoadVM loads a single .vm file or every .vm file in a directory
+// Execution starts at Sys.init if the program has one, otherwise at its first command
+func LoadVM(path string) (Engine, error) {
+	paths := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		if paths, err = filepath.Glob(filepath.Join(path, "*.vm")); err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no .vm files in %s", path)
+		}
+		sort.Strings(paths)
+	}
+
+	files := make([]*vm.File, 0, len(paths))
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		file, err := vm.Parse(strings.TrimSuffix(filepath.Base(p), ".vm"), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	machine, err := vm.NewMachine(files)
+	if err != nil {
+		return nil, err
+	}
+	if start, ok := machine.FunctionStart("Sys.init"); ok {
+		machine.SetPC(start)
+	}
+	return &VMEngine{Machine: machine}, nil
+}
+
+// address resolves a variable to a RAM address
+func (e *VMEngine) address(name string) (int, error) {
+	base, index, err := splitIndex(name)
+	if err != nil {
+		return 0, err
+	}
+
+	addr := -1
+	if ptr, ok := vmPointers[base]; ok {
+		addr = ptr
+		if index != -1 {
+			addr = int(e.Machine.RAM[ptr]) + index
+		}
+	} else if index != -1 {
+		switch base {
+		case "RAM":
+			addr = index
+		case "temp":
+			addr = vm.TempBase + index
+		case "pointer":
+			addr = vm.THIS + index
+		}
+	}
+
+	if addr == -1 {
+		return 0, fmt.Errorf("unknown variable %q", name)
+	}
+	if addr < 0 || addr >= vm.MemorySize {
+		return 0, fmt.Errorf("%s refers to invalid address %d", name, addr)
+	}
+	return addr, nil
+}
+
+func (e *VMEngine) Get(name string) (int, error) {
+	addr, err := e.address(name)
+	if err != nil {
+		return 0, err
+	}
+	return int(e.Machine.RAM[addr]), nil
+}
+
+func (e *VMEngine) Set(name string, value int) error {
+	addr, err := e.address(name)
+	if err != nil {
+		return err
+	}
+	e.Machine.RAM[addr] = int16(value)
+	return nil
+}
+
+func (e *VMEngine) Step(command string) error {
+	if command != "vmstep" {
+		return fmt.Errorf("%s is not supported when running VM code", command)
+	}
+	return e.Machine.Step()
+}
+
+// CPUEngine runs Hack machine code one instruction at a time, like the CPU emulator
+type CPUEngine struct {
+	CPU *hack.CPU
+}
+
+// LoadCPU loads a .hack file, or assembles a .asm file
+func LoadCPU(path string) (Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var program []uint16
+	if filepath.Ext(path) == ".asm" {
+		program, err = hack.Assemble(filepath.Base(path), f)
+	} else {
+		program, err = hack.ReadBinary(filepath.Base(path), f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CPUEngine{CPU: hack.NewCPU(program)}, nil
+}
+
+func (e *CPUEngine) Get(name string) (int, error) {
+	base, index, err := splitIndex(name)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case base == "A" && index == -1:
+		return int(e.CPU.A), nil
+	case base == "D" && index == -1:
+		return int(e.CPU.D), nil
+	case base == "PC" && index == -1:
+		return int(e.CPU.PC), nil
+	case base == "RAM" && index < hack.RAMSize && index != -1:
+		return int(e.CPU.RAM[index]), nil
+	case base == "ROM" && index < hack.ROMSize && index != -1:
+		return int(int16(e.CPU.ROM[index])), nil
+	}
+	return 0, fmt.Errorf("unknown variable %q", name)
+}
+
+func (e *CPUEngine) Set(name string, value int) error {
+	base, index, err := splitIndex(name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case base == "A" && index == -1:
+		e.CPU.A = int16(value)
+	case base == "D" && index == -1:
+		e.CPU.D = int16(value)
+	case base == "PC" && index == -1:
+		e.CPU.PC = uint16(value)
+	case base == "RAM" && index < hack.RAMSize && index != -1:
+		e.CPU.RAM[index] = int16(value)
+	case base == "ROM" && index < hack.ROMSize && index != -1:
+		e.CPU.ROM[index] = uint16(value)
+	default:
+		return fmt.Errorf("unknown variable %q", name)
+	}
+	return nil
+}
+
+func (e *CPUEngine) Step(command string) error {
+	if command != "ticktock" {
+		return fmt.Errorf("%s is not supported when running Hack machine code", command)
+	}
+	e.CPU.Step()
+	return nil
+}
+
+// HDLEngine simulates a chip, like the hardware simulator
+type HDLEngine struct {
+	Sim *hdl.Sim
+}
+
+// LoadHDL builds the chip in a .hdl file, finding its parts with hdl.DefaultPath
+func LoadHDL(path string) (Engine, error) {
+	sim, err := hdl.BuildFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &HDLEngine{Sim: sim}, nil
+}
+
+func (e *HDLEngine) Get(name string) (int, error) {
+	return e.Sim.Get(name)
+}
+
+func (e *HDLEngine) Set(name string, value int) error {
+	return e.Sim.Set(name, value)
+}
+
+func (e *HDLEngine) Step(command string) error {
+	switch command {
+	case "eval":
+		e.Sim.Eval()
+	case "tick":
+		e.Sim.Tick()
+	case "tock":
+		e.Sim.Tock()
+	case "ticktock":
+		e.Sim.Tick()
+		e.Sim.Tock()
+	default:
+		return fmt.Errorf("%s is not supported when simulating a chip", command)
+	}
+	return nil
+}
+
+func (e *HDLEngine) Command(name string, args []string, dir string) error {
+	return e.Sim.Command(name, args, dir)
+}
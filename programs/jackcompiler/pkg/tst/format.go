@@ -0,0 +1,96 @@
+package tst
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// column is an entry of an output-list, written as name%FL.W.R
+// F is the format (B, D, X, or S), and L, W, and R are the left padding, value width, and right padding
+type column struct {
+	name   string
+	format byte
+	left   int
+	width  int
+	right  int
+}
+
+// defaultColumn is the format used when a variable in an output-list doesn't give one
+var defaultColumn = column{format: 'D', left: 1, width: 6, right: 1}
+
+// parseColumn parses a single entry of an output-list
+func parseColumn(spec string) (column, error) {
+	name, format, found := strings.Cut(spec, "%")
+	col := defaultColumn
+	col.name = name
+	if name == "" {
+		return column{}, fmt.Errorf("invalid output column %q", spec)
+	}
+	if !found {
+		return col, nil
+	}
+
+	if len(format) < 2 || strings.IndexByte("BDXS", format[0]) == -1 {
+		return column{}, fmt.Errorf("invalid output format %q", spec)
+	}
+	col.format = format[0]
+	sizes := strings.Split(format[1:], ".")
+	if len(sizes) != 3 {
+		return column{}, fmt.Errorf("invalid output format %q", spec)
+	}
+	for i, dst := range []*int{&col.left, &col.width, &col.right} {
+		n, err := strconv.Atoi(sizes[i])
+		if err != nil || n < 0 {
+			return column{}, fmt.Errorf("invalid output format %q", spec)
+		}
+		*dst = n
+	}
+	if col.width == 0 {
+		return column{}, fmt.Errorf("invalid output format %q", spec)
+	}
+	return col, nil
+}
+
+// header returns the column's name centered within the column
+func (c column) header() string {
+	size := c.left + c.width + c.right
+	name := c.name
+	if len(name) > size {
+		name = name[:size]
+	}
+	space := size - len(name)
+	return strings.Repeat(" ", space/2) + name + strings.Repeat(" ", space-space/2)
+}
+
+// cell formats a value within the column
+func (c column) cell(value int, text string) string {
+	var s string
+	switch c.format {
+	case 'D':
+		s = fmt.Sprintf("%*d", c.width, value)
+	case 'B':
+		s = fmt.Sprintf("%0*b", c.width, uint64(value)&mask(c.width))
+	case 'X':
+		s = fmt.Sprintf("%0*X", c.width, uint64(value)&mask(c.width*4))
+	case 'S':
+		if text == "" {
+			text = strconv.Itoa(value)
+		}
+		s = fmt.Sprintf("%-*s", c.width, text)
+	}
+	return strings.Repeat(" ", c.left) + s + strings.Repeat(" ", c.right)
+}
+
+// mask returns a mask of the low bits of a value
+func mask(bits int) uint64 {
+	if bits >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<bits - 1
+}
+
+// formatRow joins the cells of an output line
+func formatRow(cells []string) string {
+	return "|" + strings.Join(cells, "|") + "|"
+}
@@ -0,0 +1,261 @@
+package tst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CompareError is returned when a line of output doesn't match the compare file
+type CompareError struct {
+	Script string
+	Line   int
+	Want   string
+	Got    string
+}
+
+func (e *CompareError) Error() string {
+	return fmt.Sprintf("%s: comparison failure at line %d", e.Script, e.Line)
+}
+
+// Result describes a script that ran to completion
+type Result struct {
+	// Output is the .out file that was written, or "" if the script didn't have an output-file
+	Output string
+	// Lines is the number of lines written to the output
+	Lines int
+	// Compared is true if the output was checked against a compare file
+	Compared bool
+	// Echo holds the messages printed with echo
+	Echo []string
+}
+
+// RunFile parses and runs a test script
+func RunFile(path string) (*Result, error) {
+	script, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Run(script)
+}
+
+// Run executes a script, writing its output file even if the output stops matching the compare file
+func Run(script *Script) (*Result, error) {
+	r := &runner{script: script, dir: filepath.Dir(script.Path), result: &Result{}}
+	err := r.commands(script.Commands)
+
+	if r.result.Output != "" {
+		contents := strings.Join(r.out, "\n")
+		if len(r.out) > 0 {
+			contents += "\n"
+		}
+		if writeErr := os.WriteFile(r.result.Output, []byte(contents), 0644); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.result, nil
+}
+
+// runner holds the state of a script while it runs
+type runner struct {
+	script  *Script
+	dir     string
+	result  *Result
+	engine  Engine
+	columns []column
+	out     []string
+	cmp     []string
+
+	// clock counts the number of full cycles, tocked is false between a tick and its tock
+	clock  int
+	tocked bool
+}
+
+// errorf builds an error pointing at a command of the script
+func (r *runner) errorf(command *Command, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", filepath.Base(r.script.Path), command.Line, fmt.Sprintf(format, args...))
+}
+
+// path resolves a file name relative to the script
+func (r *runner) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(r.dir, name)
+}
+
+// commands runs a list of commands
+func (r *runner) commands(commands []*Command) error {
+	for _, command := range commands {
+		if err := r.command(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// command runs a single command
+func (r *runner) command(command *Command) error {
+	// Everything but loading, output setup, and echo needs something loaded
+	switch command.Name {
+	case "load", "output-file", "compare-to", "output-list", "echo", "clear-echo", "repeat", "while":
+	default:
+		if r.engine == nil {
+			return r.errorf(command, "%s used before load", command.Name)
+		}
+	}
+
+	switch command.Name {
+	case "load":
+		path := r.dir
+		if len(command.Args) == 1 {
+			path = r.path(command.Args[0])
+		}
+		ext := filepath.Ext(path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			ext = ""
+		}
+		loader, ok := Loaders[ext]
+		if !ok {
+			return r.errorf(command, "don't know how to load %s", filepath.Base(path))
+		}
+		engine, err := loader(path)
+		if err != nil {
+			return r.errorf(command, "%v", err)
+		}
+		r.engine = engine
+		r.clock = 0
+		r.tocked = true
+	case "output-file":
+		r.result.Output = r.path(command.Args[0])
+		r.out = r.out[:0]
+	case "compare-to":
+		contents, err := os.ReadFile(r.path(command.Args[0]))
+		if err != nil {
+			return r.errorf(command, "%v", err)
+		}
+		r.cmp = strings.Split(strings.TrimRight(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n"), "\n")
+		r.result.Compared = true
+	case "output-list":
+		r.columns = r.columns[:0]
+		headers := make([]string, 0, len(command.Args))
+		for _, arg := range command.Args {
+			col, _ := parseColumn(arg)
+			r.columns = append(r.columns, col)
+			headers = append(headers, col.header())
+		}
+		return r.output(formatRow(headers))
+	case "output":
+		cells := make([]string, 0, len(r.columns))
+		for _, col := range r.columns {
+			value, text, err := r.get(col.name)
+			if err != nil {
+				return r.errorf(command, "%v", err)
+			}
+			cells = append(cells, col.cell(value, text))
+		}
+		return r.output(formatRow(cells))
+	case "set":
+		value, _ := ParseValue(command.Args[1])
+		if err := r.engine.Set(command.Args[0], value); err != nil {
+			return r.errorf(command, "%v", err)
+		}
+	case "echo":
+		r.result.Echo = append(r.result.Echo, command.Args[0])
+	case "clear-echo":
+	case "tick", "tock", "ticktock", "vmstep", "eval":
+		if err := r.engine.Step(command.Name); err != nil {
+			return r.errorf(command, "%v", err)
+		}
+		switch command.Name {
+		case "tick":
+			r.tocked = false
+		case "tock":
+			r.clock++
+			r.tocked = true
+		case "ticktock":
+			r.clock++
+		}
+	case "repeat":
+		for i := 0; len(command.Args) == 0 || i < mustAtoi(command.Args[0]); i++ {
+			if err := r.commands(command.Body); err != nil {
+				return err
+			}
+		}
+	case "while":
+		compare := comparisons[command.Args[1]]
+		want, _ := ParseValue(command.Args[2])
+		for {
+			if r.engine == nil {
+				return r.errorf(command, "while used before load")
+			}
+			value, _, err := r.get(command.Args[0])
+			if err != nil {
+				return r.errorf(command, "%v", err)
+			}
+			if !compare(value, want) {
+				break
+			}
+			if err := r.commands(command.Body); err != nil {
+				return err
+			}
+		}
+	case "breakpoint", "clear-breakpoints":
+		return r.errorf(command, "%s is not supported", command.Name)
+	default:
+		commander, ok := r.engine.(Commander)
+		if !ok {
+			return r.errorf(command, "unknown command %q", command.Name)
+		}
+		if err := commander.Command(command.Name, command.Args, r.dir); err != nil {
+			return r.errorf(command, "%v", err)
+		}
+	}
+	return nil
+}
+
+// get reads a variable, handling the clock itself
+// The text is only set for values that aren't plain numbers
+func (r *runner) get(name string) (int, string, error) {
+	if name == "time" {
+		text := strconv.Itoa(r.clock)
+		if !r.tocked {
+			text += "+"
+		}
+		return r.clock, text, nil
+	}
+	if r.engine == nil {
+		return 0, "", fmt.Errorf("nothing has been loaded")
+	}
+	value, err := r.engine.Get(name)
+	return value, "", err
+}
+
+// output writes a line to the output file, checking it against the compare file
+func (r *runner) output(line string) error {
+	r.out = append(r.out, line)
+	r.result.Lines = len(r.out)
+	if !r.result.Compared {
+		return nil
+	}
+
+	want := "<end of file>"
+	if len(r.out) <= len(r.cmp) {
+		want = r.cmp[len(r.out)-1]
+	}
+	if strings.TrimRight(want, " \t") != strings.TrimRight(line, " \t") {
+		return &CompareError{Script: filepath.Base(r.script.Path), Line: len(r.out), Want: want, Got: line}
+	}
+	return nil
+}
+
+// mustAtoi converts a number that was already checked by the parser
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,83 @@
+package tst
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyTestdata copies the scripts and the files they load into a temporary directory, since running a script
+// writes its .out file next to it
+func copyTestdata(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	entries, err := os.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		contents, err := os.ReadFile(filepath.Join("testdata", entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, entry.Name()), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestRunFile runs scripts against the CPU and VM engines, checking their output and compare failures
+func TestRunFile(t *testing.T) {
+	dir := copyTestdata(t)
+	tests := []struct {
+		script string
+		lines  int
+		// failLine is the line of output that doesn't match the compare file, or 0 if they all match
+		failLine int
+		want     string
+		got      string
+	}{
+		{script: "Max.tst", lines: 4},
+		{script: "Add.tst", lines: 3},
+		{
+			script:   "MaxWrong.tst",
+			failLine: 3,
+			want:     "|   23456  |   -1234  |   -1234  |",
+			got:      "|   23456  |   -1234  |   23456  |",
+		},
+	}
+	for _, test := range tests {
+		result, err := RunFile(filepath.Join(dir, test.script))
+		if test.failLine == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", test.script, err)
+				continue
+			}
+			if result.Lines != test.lines || !result.Compared {
+				t.Errorf("%s: wrote %d lines, compared %v, want %d lines compared", test.script, result.Lines, result.Compared, test.lines)
+			}
+			continue
+		}
+
+		var compareErr *CompareError
+		if !errors.As(err, &compareErr) {
+			t.Errorf("%s: got error %v, want a comparison failure", test.script, err)
+			continue
+		}
+		if compareErr.Line != test.failLine || compareErr.Want != test.want || compareErr.Got != test.got {
+			t.Errorf("%s: failed at line %d with\n%s\nwant\n%s, want line %d with\n%s\nwant\n%s", test.script,
+				compareErr.Line, compareErr.Got, compareErr.Want, test.failLine, test.got, test.want)
+		}
+		// The output is still written up to the line that failed, so it can be compared by hand
+		out, err := os.ReadFile(filepath.Join(dir, strings.TrimSuffix(test.script, ".tst")+".out"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(out), "\n"); lines != test.failLine {
+			t.Errorf("%s: wrote %d lines of output, want %d", test.script, lines, test.failLine)
+		}
+	}
+}
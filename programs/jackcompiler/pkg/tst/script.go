@@ -0,0 +1,283 @@
+package tst
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Command is a single command of a test script
+// Repeat and while commands hold the commands they loop over in Body
+type Command struct {
+	Name string
+	Args []string
+	Body []*Command
+	Line int
+}
+
+// Script is a parsed .tst file
+type Script struct {
+	// Path is where the script was read from, file names within the script are relative to its directory
+	Path     string
+	Commands []*Command
+}
+
+// argCounts maps every command to the number of arguments it takes, -1 means any number
+var argCounts = map[string]int{
+	"load":              -1,
+	"output-file":       1,
+	"compare-to":        1,
+	"output-list":       -1,
+	"output":            0,
+	"set":               2,
+	"echo":              1,
+	"clear-echo":        0,
+	"vmstep":            0,
+	"ticktock":          0,
+	"tick":              0,
+	"tock":              0,
+	"eval":              0,
+	"repeat":            -1,
+	"while":             3,
+	"breakpoint":        2,
+	"clear-breakpoints": 0,
+}
+
+// ParseFile reads and parses a test script
+func ParseFile(path string) (*Script, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, string(contents))
+}
+
+// Parse parses the contents of a test script, path is used for error messages and to resolve file names
+func Parse(path string, contents string) (*Script, error) {
+	p := &parser{name: filepath.Base(path), tokens: tokenize(contents)}
+	commands, err := p.commands(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{Path: path, Commands: commands}, nil
+}
+
+// token is a word, quoted string, or punctuation character of a script
+type token struct {
+	text   string
+	quoted bool
+	line   int
+}
+
+// tokenize splits a script into tokens, throwing away comments
+func tokenize(contents string) []token {
+	tokens := make([]token, 0)
+	line := 1
+	for i := 0; i < len(contents); {
+		c := contents[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(contents[i:], "//"):
+			for i < len(contents) && contents[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(contents[i:], "/*"):
+			end := strings.Index(contents[i+2:], "*/")
+			if end == -1 {
+				end = len(contents) - i - 4
+			}
+			line += strings.Count(contents[i:i+end+4], "\n")
+			i += end + 4
+		case strings.IndexByte(",;!{}", c) != -1:
+			tokens = append(tokens, token{text: string(c), line: line})
+			i++
+		case c == '"':
+			end := strings.IndexByte(contents[i+1:], '"')
+			if end == -1 {
+				end = len(contents) - i - 1
+			}
+			tokens = append(tokens, token{text: contents[i+1 : i+1+end], quoted: true, line: line})
+			i += end + 2
+		default:
+			start := i
+			for i < len(contents) && strings.IndexByte(" \t\r\n,;!{}\"", contents[i]) == -1 {
+				i++
+			}
+			tokens = append(tokens, token{text: contents[start:i], line: line})
+		}
+	}
+	return tokens
+}
+
+// parser builds commands out of the tokens of a script
+type parser struct {
+	name   string
+	tokens []token
+	pos    int
+}
+
+// errorf builds an error pointing at a line of the script
+func (p *parser) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.name, line, fmt.Sprintf(format, args...))
+}
+
+// isPunct checks if a token is the given unquoted punctuation
+func isPunct(t token, punct string) bool {
+	return !t.quoted && t.text == punct
+}
+
+// isTerminator checks if a token ends a command
+func isTerminator(t token) bool {
+	return isPunct(t, ",") || isPunct(t, ";") || isPunct(t, "!")
+}
+
+// commands parses commands until the end of the script, or the closing brace of a block
+func (p *parser) commands(inBlock bool) ([]*Command, error) {
+	commands := make([]*Command, 0)
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if isTerminator(t) {
+			p.pos++
+			continue
+		}
+		if isPunct(t, "}") {
+			if !inBlock {
+				return nil, p.errorf(t.line, "unexpected }")
+			}
+			p.pos++
+			return commands, nil
+		}
+
+		command, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+
+	if inBlock {
+		return nil, p.errorf(p.tokens[len(p.tokens)-1].line, "missing }")
+	}
+	return commands, nil
+}
+
+// command parses a single command, along with its body if it is a loop
+func (p *parser) command() (*Command, error) {
+	start := p.tokens[p.pos]
+	command := &Command{Name: start.text, Line: start.line}
+	want, ok := argCounts[command.Name]
+	if !ok {
+		// Commands that start with a chip name, such as `ROM32K load Prog.hack`, are handed to the engine
+		ok = !start.quoted && command.Name != "" && command.Name[0] >= 'A' && command.Name[0] <= 'Z'
+		want = -1
+	}
+	if !ok || start.quoted || isPunct(start, "{") {
+		return nil, p.errorf(start.line, "unknown command %q", start.text)
+	}
+	p.pos++
+
+	// Everything up to the end of the command (or the start of a loop's body) is an argument
+	for p.pos < len(p.tokens) {
+		t := p.tokens[p.pos]
+		if isTerminator(t) || isPunct(t, "}") || isPunct(t, "{") {
+			break
+		}
+		command.Args = append(command.Args, t.text)
+		p.pos++
+	}
+	if want != -1 && len(command.Args) != want {
+		return nil, p.errorf(start.line, "%s expects %d argument(s), got %d", command.Name, want, len(command.Args))
+	}
+
+	switch command.Name {
+	case "load":
+		if len(command.Args) > 1 {
+			return nil, p.errorf(start.line, "load expects at most 1 argument")
+		}
+	case "output-list":
+		for _, arg := range command.Args {
+			if _, err := parseColumn(arg); err != nil {
+				return nil, p.errorf(start.line, "%v", err)
+			}
+		}
+	case "set":
+		if _, err := ParseValue(command.Args[1]); err != nil {
+			return nil, p.errorf(start.line, "%v", err)
+		}
+	case "repeat", "while":
+		if command.Name == "repeat" {
+			if len(command.Args) > 1 {
+				return nil, p.errorf(start.line, "repeat expects at most 1 argument")
+			}
+			if len(command.Args) == 1 {
+				if n, err := strconv.Atoi(command.Args[0]); err != nil || n < 0 {
+					return nil, p.errorf(start.line, "invalid repeat count %q", command.Args[0])
+				}
+			}
+		} else {
+			if _, ok := comparisons[command.Args[1]]; !ok {
+				return nil, p.errorf(start.line, "invalid comparison %q", command.Args[1])
+			}
+			if _, err := ParseValue(command.Args[2]); err != nil {
+				return nil, p.errorf(start.line, "%v", err)
+			}
+		}
+
+		if p.pos >= len(p.tokens) || !isPunct(p.tokens[p.pos], "{") {
+			return nil, p.errorf(start.line, "expected { after %s", command.Name)
+		}
+		p.pos++
+		body, err := p.commands(true)
+		if err != nil {
+			return nil, err
+		}
+		command.Body = body
+	}
+
+	return command, nil
+}
+
+// comparisons maps the operators allowed in a while condition to their implementation
+var comparisons = map[string]func(a int, b int) bool{
+	"=":  func(a int, b int) bool { return a == b },
+	"<>": func(a int, b int) bool { return a != b },
+	"<":  func(a int, b int) bool { return a < b },
+	">":  func(a int, b int) bool { return a > b },
+	"<=": func(a int, b int) bool { return a <= b },
+	">=": func(a int, b int) bool { return a >= b },
+}
+
+// ParseValue parses a value the way set does, it is decimal unless prefixed by %B (binary), %X (hex), or %D (decimal)
+func ParseValue(text string) (int, error) {
+	base := 10
+	digits := text
+	if len(text) > 2 && text[0] == '%' {
+		switch text[1] {
+		case 'B':
+			base = 2
+		case 'X':
+			base = 16
+		case 'D':
+			base = 10
+		default:
+			return 0, fmt.Errorf("invalid value %q", text)
+		}
+		digits = text[2:]
+	}
+
+	value, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	// Binary and hex values are 16 bit patterns, so the top bit is the sign
+	if base != 10 && value >= 1<<15 && value < 1<<16 {
+		value -= 1 << 16
+	}
+	return int(value), nil
+}
@@ -0,0 +1,13 @@
+load Add.vm,
+output-file Add.out,
+compare-to Add.cmp,
+output-list RAM[16]%D1.6.1 RAM[17]%D1.6.1;
+
+repeat 4 {
+    vmstep;
+}
+output;
+repeat 4 {
+    vmstep;
+}
+output;
@@ -0,0 +1,23 @@
+// Runs Max.asm on a few pairs of values
+load Max.asm,
+output-file Max.out,
+compare-to Max.cmp,
+output-list RAM[0]%D2.6.2 RAM[1]%D2.6.2 RAM[2]%D2.6.2;
+
+set RAM[0] 3, set RAM[1] 5;
+repeat 14 {
+    ticktock;
+}
+output;
+
+set PC 0, set RAM[0] 23456, set RAM[1] -1234;
+repeat 14 {
+    ticktock;
+}
+output;
+
+set PC 0, set RAM[0] %X0010, set RAM[1] %B10001;
+repeat 14 {
+    ticktock;
+}
+output;
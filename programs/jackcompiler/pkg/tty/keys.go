@@ -0,0 +1,90 @@
+package tty
+
+// Key codes the Hack keyboard uses for keys that don't have an ASCII character
+const (
+	KeyNewLine   = 128
+	KeyBackSpace = 129
+	KeyLeft      = 130
+	KeyUp        = 131
+	KeyRight     = 132
+	KeyDown      = 133
+	KeyHome      = 134
+	KeyEnd       = 135
+	KeyPageUp    = 136
+	KeyPageDown  = 137
+	KeyInsert    = 138
+	KeyDelete    = 139
+	KeyEscape    = 140
+	KeyF1        = 141
+)
+
+// KeyQuit is returned by DecodeKeys when Ctrl-C is pressed, it is never written to the keyboard register
+const KeyQuit = -1
+
+// escapeKeys maps the terminal's escape sequences (without the leading ESC) to Hack key codes
+var escapeKeys = map[string]int16{
+	"[A":   KeyUp,
+	"[B":   KeyDown,
+	"[C":   KeyRight,
+	"[D":   KeyLeft,
+	"OA":   KeyUp,
+	"OB":   KeyDown,
+	"OC":   KeyRight,
+	"OD":   KeyLeft,
+	"[H":   KeyHome,
+	"[F":   KeyEnd,
+	"OH":   KeyHome,
+	"OF":   KeyEnd,
+	"[1~":  KeyHome,
+	"[4~":  KeyEnd,
+	"[2~":  KeyInsert,
+	"[3~":  KeyDelete,
+	"[5~":  KeyPageUp,
+	"[6~":  KeyPageDown,
+	"OP":   KeyF1,
+	"OQ":   KeyF1 + 1,
+	"OR":   KeyF1 + 2,
+	"OS":   KeyF1 + 3,
+	"[15~": KeyF1 + 4,
+	"[17~": KeyF1 + 5,
+	"[18~": KeyF1 + 6,
+	"[19~": KeyF1 + 7,
+	"[20~": KeyF1 + 8,
+	"[21~": KeyF1 + 9,
+	"[23~": KeyF1 + 10,
+	"[24~": KeyF1 + 11,
+}
+
+// DecodeKeys converts bytes read from a raw terminal into Hack key codes
+// Escape sequences are expected to arrive within a single read, which is how terminals send them
+func DecodeKeys(buf []byte) []int16 {
+	keys := make([]int16, 0, len(buf))
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		switch {
+		case c == 3:
+			keys = append(keys, KeyQuit)
+		case c == '\r' || c == '\n':
+			keys = append(keys, KeyNewLine)
+		case c == 127 || c == 8:
+			keys = append(keys, KeyBackSpace)
+		case c == 27:
+			// Find the longest escape sequence that matches
+			matched := false
+			for end := len(buf); end > i+1; end-- {
+				if key, ok := escapeKeys[string(buf[i+1:end])]; ok {
+					keys = append(keys, key)
+					i = end - 1
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				keys = append(keys, KeyEscape)
+			}
+		case c >= 32 && c < 127:
+			keys = append(keys, int16(c))
+		}
+	}
+	return keys
+}
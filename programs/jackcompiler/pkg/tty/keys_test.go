@@ -0,0 +1,39 @@
+package tty
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDecodeKeys checks plain characters, control keys, and escape sequences, including several in one read
+func TestDecodeKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []int16
+	}{
+		{"", []int16{}},
+		{"aZ 9~", []int16{'a', 'Z', ' ', '9', '~'}},
+		{"\r\n\x7f\x08", []int16{KeyNewLine, KeyNewLine, KeyBackSpace, KeyBackSpace}},
+		{"\x03", []int16{KeyQuit}},
+		// Other control characters have no Hack key
+		{"\t\x01x", []int16{'x'}},
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", []int16{KeyUp, KeyDown, KeyRight, KeyLeft}},
+		{"\x1bOA\x1bOH\x1b[F", []int16{KeyUp, KeyHome, KeyEnd}},
+		{"\x1b[3~\x1b[5~\x1b[6~\x1b[2~", []int16{KeyDelete, KeyPageUp, KeyPageDown, KeyInsert}},
+		{"\x1bOP\x1bOS\x1b[15~\x1b[24~", []int16{KeyF1, KeyF1 + 3, KeyF1 + 4, KeyF1 + 11}},
+		// The sequence is matched and the characters after it are keys of their own
+		{"\x1b[Ax", []int16{KeyUp, 'x'}},
+		{"\x1b[1~1", []int16{KeyHome, '1'}},
+		// A lone escape, or one that doesn't start a known sequence, is the escape key
+		{"\x1b", []int16{KeyEscape}},
+		{"\x1b\x1b[D", []int16{KeyEscape, KeyLeft}},
+		{"\x1b[Z", []int16{KeyEscape, '[', 'Z'}},
+		// Bytes of UTF-8 characters are dropped
+		{"é!", []int16{'!'}},
+	}
+	for _, test := range tests {
+		if got := DecodeKeys([]byte(test.in)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package tty
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"jackcompiler/pkg/screen"
+	"jackcompiler/pkg/vm"
+	"time"
+)
+
+// Options controls how a program is run in the terminal
+type Options struct {
+	Mode  screen.Mode
+	Scale int
+	// Rate is the number of VM commands to execute every second
+	Rate int
+	// KeyHold is how long a key stays in the keyboard register after it is pressed,
+	// since terminals only tell us about presses and not releases
+	KeyHold time.Duration
+	// FPS is the number of times a second the screen is redrawn
+	FPS int
+}
+
+// DefaultOptions are the options used by `jackcompiler run -tty`
+var DefaultOptions = Options{
+	Mode:    screen.Braille,
+	Scale:   2,
+	Rate:    11000000,
+	KeyHold: 150 * time.Millisecond,
+	FPS:     30,
+}
+
+// Run executes a booted machine, drawing its screen to out and feeding keys read from in into the keyboard register
+// in should already be in raw mode, Run returns once Ctrl-C is pressed or the program hits an error
+func Run(m *vm.Machine, in io.Reader, out io.Writer, opts Options) error {
+	keys := make(chan int16, 16)
+	go readKeys(in, keys)
+
+	w := bufio.NewWriter(out)
+	// Clear the screen and hide the cursor, then put the cursor back when we are done
+	fmt.Fprint(w, "\x1b[2J\x1b[?25l")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\r\n")
+		w.Flush()
+	}()
+
+	frame := time.Second / time.Duration(opts.FPS)
+	stepsPerFrame := uint64(opts.Rate / opts.FPS)
+	var lastKey time.Time
+	var prev []string
+
+	for {
+		start := time.Now()
+
+		// Take in everything that has been typed since the last frame
+		for pending := true; pending; {
+			select {
+			case key := <-keys:
+				if key == KeyQuit {
+					return nil
+				}
+				m.RAM[vm.KeyboardAddr] = key
+				lastKey = start
+			default:
+				pending = false
+			}
+		}
+		if m.RAM[vm.KeyboardAddr] != 0 && start.Sub(lastKey) > opts.KeyHold {
+			m.RAM[vm.KeyboardAddr] = 0
+		}
+
+		if err := m.Run(stepsPerFrame); err != nil {
+			return err
+		}
+
+		// Only redraw the lines that changed
+		lines := screen.Text(m.RAM[screen.Base:screen.Base+screen.Words], opts.Mode, opts.Scale)
+		for i, line := range lines {
+			if i < len(prev) && prev[i] == line {
+				continue
+			}
+			fmt.Fprintf(w, "\x1b[%d;1H%s", i+1, line)
+		}
+		prev = lines
+
+		status := fmt.Sprintf("steps: %d  key: %d", m.Steps(), m.RAM[vm.KeyboardAddr])
+		if m.Halted() {
+			status += "  [halted]"
+		}
+		status += "  (Ctrl-C to quit)"
+		fmt.Fprintf(w, "\x1b[%d;1H\x1b[2K%s", len(lines)+1, status)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		time.Sleep(frame - time.Since(start))
+	}
+}
+
+// readKeys sends every key read from in to keys, sending KeyQuit when in is closed
+func readKeys(in io.Reader, keys chan<- int16) {
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		for _, key := range DecodeKeys(buf[:n]) {
+			keys <- key
+		}
+		if err != nil {
+			keys <- KeyQuit
+			return
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package tty
+
+import (
+	"errors"
+)
+
+// MakeRaw is not supported on this platform
+func MakeRaw(fd int) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
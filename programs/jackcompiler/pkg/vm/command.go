@@ -0,0 +1,144 @@
+package vm
+
+import (
+	"strconv"
+)
+
+// Op is an enum for the operation a VM command performs
+type Op int
+
+const (
+	Add Op = iota
+	Sub
+	Neg
+	Eq
+	Gt
+	Lt
+	And
+	Or
+	Not
+	Push
+	Pop
+	Label
+	Goto
+	IfGoto
+	Function
+	Call
+	Return
+)
+
+// Segment is an enum for the memory segments push and pop operate on
+type Segment int
+
+const (
+	Argument Segment = iota
+	Local
+	Static
+	Constant
+	This
+	That
+	Pointer
+	Temp
+)
+
+// OpStrMap will map operations by type to their respective string
+var OpStrMap = map[Op]string{
+	Add:      "add",
+	Sub:      "sub",
+	Neg:      "neg",
+	Eq:       "eq",
+	Gt:       "gt",
+	Lt:       "lt",
+	And:      "and",
+	Or:       "or",
+	Not:      "not",
+	Push:     "push",
+	Pop:      "pop",
+	Label:    "label",
+	Goto:     "goto",
+	IfGoto:   "if-goto",
+	Function: "function",
+	Call:     "call",
+	Return:   "return",
+}
+
+// OpMap will map operations by string to their respective type
+var OpMap = map[string]Op{
+	"add":      Add,
+	"sub":      Sub,
+	"neg":      Neg,
+	"eq":       Eq,
+	"gt":       Gt,
+	"lt":       Lt,
+	"and":      And,
+	"or":       Or,
+	"not":      Not,
+	"push":     Push,
+	"pop":      Pop,
+	"label":    Label,
+	"goto":     Goto,
+	"if-goto":  IfGoto,
+	"function": Function,
+	"call":     Call,
+	"return":   Return,
+}
+
+// SegmentStrMap will map segments by type to their respective string
+var SegmentStrMap = map[Segment]string{
+	Argument: "argument",
+	Local:    "local",
+	Static:   "static",
+	Constant: "constant",
+	This:     "this",
+	That:     "that",
+	Pointer:  "pointer",
+	Temp:     "temp",
+}
+
+// SegmentMap will map segments by string to their respective type
+var SegmentMap = map[string]Segment{
+	"argument": Argument,
+	"local":    Local,
+	"static":   Static,
+	"constant": Constant,
+	"this":     This,
+	"that":     That,
+	"pointer":  Pointer,
+	"temp":     Temp,
+}
+
+// Command is a single VM command
+// Name holds the label or function name, Index holds the segment index, local count, or argument count
+type Command struct {
+	Op      Op
+	Segment Segment
+	Name    string
+	Index   int
+	// Pos is where in the Jack source the command came from, or nil if it wasn't compiled from Jack
+	Pos *Position
+}
+
+// IsArithmetic returns true if the command is one of the arithmetic/logical commands
+func (c Command) IsArithmetic() bool {
+	return c.Op <= Not
+}
+
+// String returns the command as it would be written in a .vm file
+func (c Command) String() string {
+	switch c.Op {
+	case Push, Pop:
+		return OpStrMap[c.Op] + " " + SegmentStrMap[c.Segment] + " " + strconv.Itoa(c.Index)
+	case Label, Goto, IfGoto:
+		return OpStrMap[c.Op] + " " + c.Name
+	case Function, Call:
+		return OpStrMap[c.Op] + " " + c.Name + " " + strconv.Itoa(c.Index)
+	}
+	return OpStrMap[c.Op]
+}
+
+// File is the list of commands that came from a single .vm file
+// The name of the file (without extension) decides which static segment the commands use
+type File struct {
+	Name     string
+	Commands []Command
+}
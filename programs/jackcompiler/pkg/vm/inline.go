@@ -0,0 +1,191 @@
+package vm
+
+import (
+	"strconv"
+)
+
+// Inlined is a function whose calls from another function were replaced by a copy of its body
+type Inlined struct {
+	Caller string
+	Callee string
+	// Sites is the number of calls that were replaced
+	Sites int
+}
+
+// firstInlineTemp is the first temp register an inlined body keeps its arguments and locals in
+// The compiler only uses temp 0 and temp 1, and never keeps a value in them across a call
+const firstInlineTemp = 2
+
+// leaf is a function that can be inlined
+type leaf struct {
+	// file is the file whose statics the body uses, or "" if it doesn't use any
+	file     string
+	usedArgs int
+	nLocals  int
+	body     []Command
+	setsThis bool
+}
+
+// Inline replaces calls to small functions that don't call anything with their bodies, so they cost no more
+// than the commands they are made of, and returns the new files along with the calls it replaced
+// maxSize is the number of commands a function may have, not counting its function command, to be inlined
+// Arguments and locals of an inlined body live in the temp segment, and THIS is saved and restored around
+// bodies that change it, but THAT is not, which is fine for code from the compiler since it never relies on
+// THAT surviving a call
+// The functions themselves are left in place, RemoveUnreachable will drop them once nothing calls them
+func Inline(files []*File, maxSize int) ([]*File, []Inlined) {
+	leaves := findLeaves(files, maxSize)
+
+	result := make([]*File, len(files))
+	var inlined []Inlined
+	// sites maps a caller and callee to their place in inlined
+	sites := make(map[[2]string]int)
+	count := 0
+	for i, file := range files {
+		out := &File{Name: file.Name}
+		function := ""
+		for _, command := range file.Commands {
+			if command.Op == Function {
+				function = command.Name
+			}
+			l, ok := leaves[command.Name]
+			// Statics belong to the file they are used in
+			if command.Op != Call || !ok || !l.fits(command.Index) || (l.file != "" && l.file != file.Name) {
+				out.Commands = append(out.Commands, command)
+				continue
+			}
+			out.Commands = append(out.Commands, l.expand(command, command.Name+"$INLINE"+strconv.Itoa(count))...)
+			count++
+			key := [2]string{function, command.Name}
+			if _, ok := sites[key]; !ok {
+				sites[key] = len(inlined)
+				inlined = append(inlined, Inlined{Caller: function, Callee: command.Name})
+			}
+			inlined[sites[key]].Sites++
+		}
+		result[i] = out
+	}
+	return result, inlined
+}
+
+// findLeaves finds the functions that can be inlined
+func findLeaves(files []*File, maxSize int) map[string]*leaf {
+	leaves := make(map[string]*leaf)
+	for _, file := range files {
+		for start, command := range file.Commands {
+			// The machine halts when Sys.halt is called, which it can't tell once the call is gone
+			if command.Op != Function || command.Name == "Sys.halt" {
+				continue
+			}
+			end := start + 1
+			for end < len(file.Commands) && file.Commands[end].Op != Function {
+				end++
+			}
+			if l := asLeaf(file.Name, command, file.Commands[start+1:end], maxSize); l != nil {
+				leaves[command.Name] = l
+			}
+		}
+	}
+	return leaves
+}
+
+// asLeaf checks whether a function body can be inlined, returning nil if it can't
+func asLeaf(file string, function Command, body []Command, maxSize int) *leaf {
+	if len(body) == 0 || len(body) > maxSize || body[len(body)-1].Op != Return {
+		return nil
+	}
+	l := &leaf{nLocals: function.Index, body: body}
+	for _, command := range body {
+		switch command.Op {
+		case Call:
+			return nil
+		case Push, Pop:
+			switch command.Segment {
+			case Argument:
+				if command.Index+1 > l.usedArgs {
+					l.usedArgs = command.Index + 1
+				}
+			case Local:
+				if command.Index >= l.nLocals {
+					return nil
+				}
+			case Static:
+				l.file = file
+			case Temp:
+				if command.Index >= firstInlineTemp {
+					return nil
+				}
+			case Pointer:
+				if command.Op == Pop && command.Index == 0 {
+					l.setsThis = true
+				}
+			}
+		}
+	}
+	return l
+}
+
+// fits checks whether a call with nArgs arguments can be inlined, which needs a temp register for
+// every argument and local, and one more for THIS if the body changes it
+func (l *leaf) fits(nArgs int) bool {
+	n := nArgs + l.nLocals
+	if l.setsThis {
+		n++
+	}
+	return nArgs >= l.usedArgs && n <= 8-firstInlineTemp
+}
+
+// expand returns the commands that replace a call, prefix makes its labels different from every other call's
+// The commands that move the arguments and locals around come from the call, and the body from the function
+func (l *leaf) expand(call Command, prefix string) []Command {
+	nArgs := call.Index
+	temp := func(op Op, index int) Command {
+		return Command{Op: op, Segment: Temp, Index: firstInlineTemp + index, Pos: call.Pos}
+	}
+	saved := nArgs + l.nLocals
+
+	var out []Command
+	// The last argument is on top of the stack
+	for i := nArgs - 1; i >= 0; i-- {
+		out = append(out, temp(Pop, i))
+	}
+	for i := 0; i < l.nLocals; i++ {
+		out = append(out, Command{Op: Push, Segment: Constant, Pos: call.Pos}, temp(Pop, nArgs+i))
+	}
+	if l.setsThis {
+		out = append(out, Command{Op: Push, Segment: Pointer, Pos: call.Pos}, temp(Pop, saved))
+	}
+
+	end := prefix + "$END"
+	jumpsToEnd := false
+	for i, command := range l.body {
+		switch command.Op {
+		case Push, Pop:
+			switch command.Segment {
+			case Argument:
+				command.Segment, command.Index = Temp, firstInlineTemp+command.Index
+			case Local:
+				command.Segment, command.Index = Temp, firstInlineTemp+nArgs+command.Index
+			}
+		case Label, Goto, IfGoto:
+			command.Name = prefix + "$" + command.Name
+		case Return:
+			// The return value is the only thing the body leaves on the stack
+			if i == len(l.body)-1 {
+				continue
+			}
+			command = Command{Op: Goto, Name: end, Pos: command.Pos}
+			jumpsToEnd = true
+		}
+		out = append(out, command)
+	}
+	if jumpsToEnd {
+		out = append(out, Command{Op: Label, Name: end, Pos: call.Pos})
+	}
+
+	// Restoring THIS leaves the return value where it is
+	if l.setsThis {
+		out = append(out, temp(Push, saved), Command{Op: Pop, Segment: Pointer, Pos: call.Pos})
+	}
+	return out
+}
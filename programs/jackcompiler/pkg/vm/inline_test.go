@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestInline runs a program before and after inlining, checking that it leaves the same values in its statics
+// and in the object it works on
+func TestInline(t *testing.T) {
+	main, err := Parse("Sys", strings.NewReader(`
+		function Sys.init 1
+		push constant 3000
+		pop pointer 0
+		push constant 4000
+		call Box.set 1
+		pop temp 0
+		push constant 4000
+		call Box.get 1
+		push static 0
+		call Sys.max 2
+		pop static 2
+		push static 0
+		push static 1
+		call Sys.clamp 2
+		pop static 3
+		push pointer 0
+		push constant 3000
+		eq
+		pop local 0
+		push static 0
+		call Box.count 1
+		push local 0
+		and
+		pop static 1
+		push constant 0
+		return
+		function Sys.max 0
+		push argument 0
+		push argument 1
+		gt
+		if-goto LEFT
+		push argument 1
+		return
+		label LEFT
+		push argument 0
+		return
+		function Sys.clamp 1
+		push argument 0
+		pop local 0
+		push local 0
+		push argument 1
+		gt
+		not
+		if-goto DONE
+		push argument 1
+		pop local 0
+		label DONE
+		push local 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	box, err := Parse("Box", strings.NewReader(`
+		function Box.set 0
+		push argument 0
+		pop pointer 0
+		push static 0
+		pop this 0
+		push static 1
+		pop this 1
+		push constant 0
+		return
+		function Box.get 0
+		push argument 0
+		pop pointer 0
+		push this 0
+		push this 1
+		add
+		return
+		function Box.count 0
+		push static 0
+		push constant 1
+		add
+		pop static 0
+		push static 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, inlined := Inline([]*File{main, box}, 16)
+	// Box.set and Box.count use the statics of Box
+	want := []Inlined{
+		{Caller: "Sys.init", Callee: "Box.get", Sites: 1},
+		{Caller: "Sys.init", Callee: "Sys.max", Sites: 1},
+		{Caller: "Sys.init", Callee: "Sys.clamp", Sites: 1},
+	}
+	if !reflect.DeepEqual(inlined, want) {
+		t.Errorf("inlined %v, want %v", inlined, want)
+	}
+
+	for _, input := range inputs {
+		before, after := runInline(t, []*File{main, box}, input), runInline(t, files, input)
+		if before != after {
+			t.Errorf("with inputs %v the program left %v before inlining and %v after", input, before, after)
+		}
+	}
+}
+
+// runInline runs a program until it returns from Sys.init and gives back its statics and the object at 4000
+func runInline(t *testing.T, files []*File, input [2]int16) [6]int16 {
+	m, err := NewMachine(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	m.RAM[StaticBase], m.RAM[StaticBase+1] = input[0], input[1]
+	m.RAM[StaticBase+4], m.RAM[StaticBase+5] = input[1], input[0]
+	if err := m.Run(10000); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted() {
+		t.Fatal("program didn't halt")
+	}
+	var result [6]int16
+	copy(result[:4], m.RAM[StaticBase:])
+	copy(result[4:], m.RAM[4000:])
+	return result
+}
+
+// TestInlineLimits checks the functions and calls that are left alone
+func TestInlineLimits(t *testing.T) {
+	main, err := Parse("Main", strings.NewReader(`
+		function Main.main 0
+		call Main.caller 0
+		call Main.big 0
+		push constant 1
+		push constant 2
+		push constant 3
+		push constant 4
+		push constant 5
+		call Main.many 5
+		call Util.counter 0
+		call Util.local 0
+		call Sys.halt 0
+		return
+		function Main.caller 0
+		call Main.big 0
+		return
+		function Main.big 0
+		push constant 1
+		push constant 2
+		add
+		return
+		function Main.many 2
+		push argument 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	util, err := Parse("Util", strings.NewReader(`
+		function Util.counter 0
+		push static 0
+		return
+		function Util.local 0
+		push constant 1
+		return
+		function Sys.halt 0
+		push constant 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, inlined := Inline([]*File{main, util}, 3)
+	// caller calls something, big is too big, many needs more temps than there are, counter uses another
+	// file's statics, and the machine has to see the call to Sys.halt
+	want := []Inlined{{Caller: "Main.main", Callee: "Util.local", Sites: 1}}
+	if !reflect.DeepEqual(inlined, want) {
+		t.Errorf("inlined %v, want %v", inlined, want)
+	}
+}
+
+// TestInlinePositions checks that the body of an inlined function keeps the positions it was compiled from,
+// and the commands that move its arguments and locals around come from the call
+func TestInlinePositions(t *testing.T) {
+	call := &Position{File: "Main.jack", Line: 3, Subroutine: "Main.main"}
+	body := &Position{File: "Util.jack", Line: 8, Subroutine: "Util.twice"}
+	commands := []Command{
+		{Op: Function, Name: "Main.main", Pos: call},
+		{Op: Push, Segment: Constant, Index: 4, Pos: call},
+		{Op: Call, Name: "Util.twice", Index: 1, Pos: call},
+		{Op: Return, Pos: call},
+		{Op: Function, Name: "Util.twice", Index: 1, Pos: body},
+		{Op: Push, Segment: Argument, Pos: body},
+		{Op: Push, Segment: Argument, Pos: body},
+		{Op: Add, Pos: body},
+		{Op: Return, Pos: body},
+	}
+	files, _ := Inline([]*File{{Name: "Main", Commands: commands[:4]}, {Name: "Util", Commands: commands[4:]}}, 16)
+	var got []string
+	for _, command := range files[0].Commands {
+		got = append(got, command.String()+" @ "+command.Pos.String())
+	}
+	want := []string{
+		"function Main.main 0 @ Main.jack:3",
+		"push constant 4 @ Main.jack:3",
+		"pop temp 2 @ Main.jack:3",
+		"push constant 0 @ Main.jack:3",
+		"pop temp 3 @ Main.jack:3",
+		"push temp 2 @ Util.jack:8",
+		"push temp 2 @ Util.jack:8",
+		"add @ Util.jack:8",
+		"return @ Main.jack:3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inlined to %v, want %v", got, want)
+	}
+}
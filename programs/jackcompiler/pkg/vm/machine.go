@@ -0,0 +1,458 @@
+package vm
+
+import (
+	"fmt"
+)
+
+// Addresses of the Hack platform's memory map that the VM relies on
+const (
+	SP           = 0
+	LCL          = 1
+	ARG          = 2
+	THIS         = 3
+	THAT         = 4
+	TempBase     = 5
+	StaticBase   = 16
+	StackBase    = 256
+	HeapBase     = 2048
+	ScreenBase   = 16384
+	KeyboardAddr = 24576
+	MemorySize   = 32768
+)
+
+// instruction is a command that has been linked, so jump and call targets are resolved to program counters
+// and static indexes are resolved to addresses
+type instruction struct {
+	op  Op
+	seg Segment
+	arg int
+}
+
+// function is the linked information about a single VM function
+type function struct {
+	name  string
+	start int
+	file  string
+}
+
+// Frame is an entry on the machine's call stack
+type Frame struct {
+	Function string
+	ReturnPC int
+	// Args and Locals are the addresses the function's arguments and locals start at
+	Args   int
+	Locals int
+}
+
+// RuntimeError is returned when a program does something the VM can't execute
+type RuntimeError struct {
+	PC       int
+	Function string
+	Msg      string
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Function == "" {
+		return fmt.Sprintf("vm: pc %d: %s", e.PC, e.Msg)
+	}
+	return fmt.Sprintf("vm: %s (pc %d): %s", e.Function, e.PC, e.Msg)
+}
+
+// Machine is an interpreter for linked VM programs that works on the Hack platform's memory map
+type Machine struct {
+	RAM [MemorySize]int16
+
+	commands  []Command
+	program   []instruction
+	functions []function
+	funcIndex map[string]int
+	// owner maps each program counter to the index of the function containing it, -1 if there is none
+	owner []int
+	// statics maps file names to the addresses their static variables start at and how many there are
+	statics map[string][2]int
+
+	pc     int
+	frames []Frame
+	steps  uint64
+	halted bool
+}
+
+// NewMachine links the given files into a single program that starts executing at the first command
+// Call Boot to start from Sys.init instead
+func NewMachine(files []*File) (*Machine, error) {
+	m := &Machine{funcIndex: make(map[string]int), statics: make(map[string][2]int)}
+
+	// First pass: lay out the commands and find all the functions and labels
+	labels := make(map[string]int)
+	staticBase := make([]int, len(files))
+	nextStatic := StaticBase
+	for i, file := range files {
+		staticBase[i] = nextStatic
+		scope := file.Name
+		owner := -1
+		maxStatic := -1
+		for _, command := range file.Commands {
+			pc := len(m.commands)
+			switch command.Op {
+			case Function:
+				if _, ok := m.funcIndex[command.Name]; ok {
+					return nil, fmt.Errorf("vm: function %s defined more than once", command.Name)
+				}
+				m.funcIndex[command.Name] = len(m.functions)
+				owner = len(m.functions)
+				m.functions = append(m.functions, function{name: command.Name, start: pc, file: file.Name})
+				scope = command.Name
+			case Label:
+				key := scope + "$" + command.Name
+				if _, ok := labels[key]; ok {
+					return nil, fmt.Errorf("vm: label %s defined more than once in %s", command.Name, scope)
+				}
+				labels[key] = pc
+			case Push, Pop:
+				if command.Segment == Static && command.Index > maxStatic {
+					maxStatic = command.Index
+				}
+			}
+			m.commands = append(m.commands, command)
+			m.owner = append(m.owner, owner)
+		}
+		m.statics[file.Name] = [2]int{nextStatic, maxStatic + 1}
+		nextStatic += maxStatic + 1
+		if nextStatic > StackBase {
+			return nil, fmt.Errorf("vm: too many static variables (%s)", file.Name)
+		}
+	}
+
+	// Second pass: resolve the targets of every command
+	m.program = make([]instruction, len(m.commands))
+	pc := 0
+	for i, file := range files {
+		scope := file.Name
+		for _, command := range file.Commands {
+			ins := instruction{op: command.Op, seg: command.Segment, arg: command.Index}
+			switch command.Op {
+			case Function:
+				scope = command.Name
+			case Label, Goto, IfGoto:
+				target, ok := labels[scope+"$"+command.Name]
+				if !ok {
+					return nil, fmt.Errorf("vm: %s: undefined label %s", scope, command.Name)
+				}
+				ins.arg = target
+			case Call:
+				if _, ok := m.funcIndex[command.Name]; !ok {
+					return nil, fmt.Errorf("vm: %s: call to undefined function %s", scope, command.Name)
+				}
+			case Push, Pop:
+				if command.Segment == Static {
+					ins.arg = staticBase[i] + command.Index
+				}
+			}
+			m.program[pc] = ins
+			pc++
+		}
+	}
+
+	m.RAM[SP] = StackBase
+	return m, nil
+}
+
+// Boot sets the machine up the same way the bootstrap code does: SP is set to 256 and Sys.init is called
+func (m *Machine) Boot() error {
+	if _, ok := m.funcIndex["Sys.init"]; !ok {
+		return fmt.Errorf("vm: cannot boot, Sys.init is not defined")
+	}
+	m.RAM[SP] = StackBase
+	m.frames = m.frames[:0]
+	m.halted = false
+	m.pc = len(m.program)
+	return m.call("Sys.init", 0)
+}
+
+// PC returns the index of the next command to execute
+func (m *Machine) PC() int {
+	return m.pc
+}
+
+// SetPC moves execution to the given command index
+func (m *Machine) SetPC(pc int) {
+	m.pc = pc
+	m.halted = false
+}
+
+// Steps returns the number of commands executed so far
+func (m *Machine) Steps() uint64 {
+	return m.steps
+}
+
+// Halted returns true once the program has called Sys.halt, returned from its outermost function,
+// or run off the end of the program
+func (m *Machine) Halted() bool {
+	return m.halted
+}
+
+// Frames returns the call stack, outermost call first
+func (m *Machine) Frames() []Frame {
+	return m.frames
+}
+
+// Commands returns the linked program
+func (m *Machine) Commands() []Command {
+	return m.commands
+}
+
+// FunctionAt returns the name of the function containing the given command, or "" if there is none
+func (m *Machine) FunctionAt(pc int) string {
+	if pc < 0 || pc >= len(m.owner) || m.owner[pc] == -1 {
+		return ""
+	}
+	return m.functions[m.owner[pc]].name
+}
+
+// FunctionStart returns the index of the function command for the named function
+func (m *Machine) FunctionStart(name string) (int, bool) {
+	idx, ok := m.funcIndex[name]
+	if !ok {
+		return 0, false
+	}
+	return m.functions[idx].start, true
+}
+
+// StaticAddress returns the address of a file's static variable, or false if the file never uses it,
+// in which case it doesn't have one
+func (m *Machine) StaticAddress(file string, index int) (int, bool) {
+	statics, ok := m.statics[file]
+	if !ok || index < 0 || index >= statics[1] {
+		return 0, false
+	}
+	return statics[0] + index, true
+}
+
+// errorf builds a runtime error for the current command
+func (m *Machine) errorf(format string, args ...any) error {
+	return &RuntimeError{PC: m.pc, Function: m.FunctionAt(m.pc), Msg: fmt.Sprintf(format, args...)}
+}
+
+// push pushes a value onto the stack
+func (m *Machine) push(value int16) error {
+	sp := int(m.RAM[SP])
+	if sp < 0 || sp >= MemorySize {
+		return m.errorf("stack pointer out of range (%d)", sp)
+	}
+	m.RAM[sp] = value
+	m.RAM[SP]++
+	return nil
+}
+
+// pop pops a value off of the stack
+func (m *Machine) pop() (int16, error) {
+	sp := int(m.RAM[SP]) - 1
+	if sp < 0 || sp >= MemorySize {
+		return 0, m.errorf("stack pointer out of range (%d)", sp+1)
+	}
+	m.RAM[SP]--
+	return m.RAM[sp], nil
+}
+
+// address resolves the RAM address of a segment entry
+func (m *Machine) address(seg Segment, arg int) (int, error) {
+	var addr int
+	switch seg {
+	case Argument:
+		addr = int(m.RAM[ARG]) + arg
+	case Local:
+		addr = int(m.RAM[LCL]) + arg
+	case This:
+		addr = int(m.RAM[THIS]) + arg
+	case That:
+		addr = int(m.RAM[THAT]) + arg
+	case Pointer:
+		addr = THIS + arg
+	case Temp:
+		addr = TempBase + arg
+	case Static:
+		addr = arg
+	}
+	if addr < 0 || addr >= MemorySize {
+		return 0, m.errorf("%s %d refers to invalid address %d", SegmentStrMap[seg], arg, addr)
+	}
+	return addr, nil
+}
+
+// call builds the frame for a call to the named function and jumps to it
+func (m *Machine) call(name string, nArgs int) error {
+	// Sys.halt is handled by the machine, just like the VM emulator does
+	if name == "Sys.halt" {
+		m.halted = true
+		return nil
+	}
+
+	returnPC := m.pc + 1
+	for _, value := range []int16{int16(returnPC), m.RAM[LCL], m.RAM[ARG], m.RAM[THIS], m.RAM[THAT]} {
+		if err := m.push(value); err != nil {
+			return err
+		}
+	}
+	m.RAM[ARG] = m.RAM[SP] - 5 - int16(nArgs)
+	m.RAM[LCL] = m.RAM[SP]
+	m.frames = append(m.frames, Frame{Function: name, ReturnPC: returnPC, Args: int(m.RAM[ARG]), Locals: int(m.RAM[LCL])})
+	m.pc = m.functions[m.funcIndex[name]].start
+	return nil
+}
+
+// ret returns from the current function
+func (m *Machine) ret() error {
+	frame := int(m.RAM[LCL])
+	if frame < 5 || frame >= MemorySize {
+		return m.errorf("invalid frame pointer %d", frame)
+	}
+	value, err := m.pop()
+	if err != nil {
+		return err
+	}
+	arg := int(m.RAM[ARG])
+	if arg < 0 || arg >= MemorySize {
+		return m.errorf("invalid argument pointer %d", arg)
+	}
+	m.RAM[arg] = value
+	m.RAM[SP] = int16(arg + 1)
+	m.RAM[THAT] = m.RAM[frame-1]
+	m.RAM[THIS] = m.RAM[frame-2]
+	m.RAM[ARG] = m.RAM[frame-3]
+	m.RAM[LCL] = m.RAM[frame-4]
+
+	// The return address is taken from our own call stack so large programs aren't limited to 16 bits
+	if len(m.frames) == 0 {
+		m.halted = true
+		return nil
+	}
+	m.pc = m.frames[len(m.frames)-1].ReturnPC
+	m.frames = m.frames[:len(m.frames)-1]
+	return nil
+}
+
+// Step executes a single command
+func (m *Machine) Step() error {
+	if m.halted {
+		return nil
+	}
+	if m.pc < 0 || m.pc >= len(m.program) {
+		m.halted = true
+		return nil
+	}
+
+	ins := m.program[m.pc]
+	m.steps++
+
+	switch ins.op {
+	case Add, Sub, And, Or, Eq, Gt, Lt:
+		y, err := m.pop()
+		if err != nil {
+			return err
+		}
+		x, err := m.pop()
+		if err != nil {
+			return err
+		}
+		var result int16
+		switch ins.op {
+		case Add:
+			result = x + y
+		case Sub:
+			result = x - y
+		case And:
+			result = x & y
+		case Or:
+			result = x | y
+		case Eq:
+			result = boolValue(x == y)
+		case Gt:
+			result = boolValue(x > y)
+		case Lt:
+			result = boolValue(x < y)
+		}
+		if err := m.push(result); err != nil {
+			return err
+		}
+	case Neg, Not:
+		x, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if ins.op == Neg {
+			x = -x
+		} else {
+			x = ^x
+		}
+		if err := m.push(x); err != nil {
+			return err
+		}
+	case Push:
+		value := int16(ins.arg)
+		if ins.seg != Constant {
+			addr, err := m.address(ins.seg, ins.arg)
+			if err != nil {
+				return err
+			}
+			value = m.RAM[addr]
+		}
+		if err := m.push(value); err != nil {
+			return err
+		}
+	case Pop:
+		addr, err := m.address(ins.seg, ins.arg)
+		if err != nil {
+			return err
+		}
+		value, err := m.pop()
+		if err != nil {
+			return err
+		}
+		m.RAM[addr] = value
+	case Label:
+		// Nothing to do
+	case Goto:
+		m.pc = ins.arg
+		return nil
+	case IfGoto:
+		value, err := m.pop()
+		if err != nil {
+			return err
+		}
+		if value != 0 {
+			m.pc = ins.arg
+			return nil
+		}
+	case Function:
+		for i := 0; i < ins.arg; i++ {
+			if err := m.push(0); err != nil {
+				return err
+			}
+		}
+	case Call:
+		return m.call(m.commands[m.pc].Name, ins.arg)
+	case Return:
+		return m.ret()
+	}
+
+	m.pc++
+	return nil
+}
+
+// Run executes up to n commands, stopping early if the program halts or hits an error
+func (m *Machine) Run(n uint64) error {
+	for i := uint64(0); i < n && !m.halted; i++ {
+		if err := m.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boolValue converts a Go boolean to the VM's true (-1) and false (0)
+func boolValue(b bool) int16 {
+	if b {
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Parse reads the commands of a .vm file
+// name is the file name without its extension, and is used for error messages and static variables
+func Parse(name string, r io.Reader) (*File, error) {
+	file := &File{Name: name}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		// Throw away comments and surrounding whitespace
+		line := scanner.Text()
+		if idx := strings.Index(line, "//"); idx != -1 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		command, err := parseCommand(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s.vm:%d: %v", name, lineNum, err)
+		}
+		file.Commands = append(file.Commands, command)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// parseCommand builds a command from the whitespace separated fields of a line
+func parseCommand(fields []string) (Command, error) {
+	op, ok := OpMap[fields[0]]
+	if !ok {
+		return Command{}, fmt.Errorf("unknown command %q", fields[0])
+	}
+	command := Command{Op: op}
+
+	// Make sure we were given the right number of arguments for the operation
+	wantArgs := 0
+	switch op {
+	case Push, Pop, Function, Call:
+		wantArgs = 2
+	case Label, Goto, IfGoto:
+		wantArgs = 1
+	}
+	if len(fields)-1 != wantArgs {
+		return Command{}, fmt.Errorf("%s expects %d argument(s), got %d", fields[0], wantArgs, len(fields)-1)
+	}
+
+	switch op {
+	case Push, Pop:
+		segment, ok := SegmentMap[fields[1]]
+		if !ok {
+			return Command{}, fmt.Errorf("unknown segment %q", fields[1])
+		}
+		command.Segment = segment
+		index, err := strconv.Atoi(fields[2])
+		if err != nil || index < 0 {
+			return Command{}, fmt.Errorf("invalid index %q", fields[2])
+		}
+		command.Index = index
+
+		// Check the bounds of the fixed size segments
+		if (segment == Pointer && index > 1) || (segment == Temp && index > 7) ||
+			(segment == Constant && index > 32767) {
+			return Command{}, fmt.Errorf("index %d out of range for segment %s", index, fields[1])
+		}
+		if op == Pop && segment == Constant {
+			return Command{}, fmt.Errorf("cannot pop to constant segment")
+		}
+	case Label, Goto, IfGoto:
+		command.Name = fields[1]
+	case Function, Call:
+		command.Name = fields[1]
+		count, err := strconv.Atoi(fields[2])
+		if err != nil || count < 0 {
+			return Command{}, fmt.Errorf("invalid count %q", fields[2])
+		}
+		command.Index = count
+	}
+
+	return command, nil
+}
+
+// Write writes the commands of a file in .vm format
+func Write(w io.Writer, commands []Command) error {
+	bw := bufio.NewWriter(w)
+	for _, command := range commands {
+		if _, err := bw.WriteString(command.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
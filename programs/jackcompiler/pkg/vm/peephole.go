@@ -0,0 +1,253 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+)
+
+// opSet is a set of operations, used to match a single command of a peephole pattern
+type opSet uint32
+
+// of builds the set holding the given operations
+func of(ops ...Op) opSet {
+	var set opSet
+	for _, op := range ops {
+		set |= 1 << op
+	}
+	return set
+}
+
+// anyOp matches every operation
+const anyOp = opSet(1<<(Return+1) - 1)
+
+// has checks whether op is in the set
+func (s opSet) has(op Op) bool {
+	return s&(1<<op) != 0
+}
+
+// rule is a peephole optimization
+// pattern matches a run of commands by their operations, and rewrite returns what they are replaced by,
+// or false if the commands don't qualify after all
+// A label can only be jumped to from elsewhere, so commands between the first and last of a match always run
+// one after another, as long as the pattern only has labels at its end
+type rule struct {
+	name    string
+	pattern []opSet
+	rewrite func(commands []Command) ([]Command, bool)
+}
+
+// comparisons are the operations that only ever leave true (-1) or false (0) on the stack
+var comparisons = of(Eq, Gt, Lt)
+
+// rules are tried in order at every command
+var rules = []rule{
+	{
+		// push x, pop x stores x back where it came from
+		name:    "push/pop same location",
+		pattern: []opSet{of(Push), of(Pop)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return nil, c[0].Segment == c[1].Segment && c[0].Index == c[1].Index
+		},
+	},
+	{
+		name:    "double not",
+		pattern: []opSet{of(Not), of(Not)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return nil, true
+		},
+	},
+	{
+		name:    "double neg",
+		pattern: []opSet{of(Neg), of(Neg)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return nil, true
+		},
+	},
+	{
+		// An if statement jumps over its else branch when the condition is true, so a negated comparison
+		// can jump straight to the else branch instead
+		// Only comparisons qualify, not of any other value is also true whenever the value isn't -1
+		name:    "negated condition",
+		pattern: []opSet{comparisons, of(Not), of(IfGoto), of(Goto), of(Label)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return []Command{c[0], {Op: IfGoto, Name: c[3].Name}, c[4]}, c[2].Name == c[4].Name
+		},
+	},
+	{
+		name:    "constant condition",
+		pattern: []opSet{of(Push), of(IfGoto)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			if c[0].Segment != Constant {
+				return nil, false
+			}
+			if c[0].Index == 0 {
+				return nil, true
+			}
+			return []Command{{Op: Goto, Name: c[1].Name}}, true
+		},
+	},
+	{
+		// This is how true is pushed, and the complement of any other constant isn't 0 either
+		name:    "constant condition",
+		pattern: []opSet{of(Push), of(Not), of(IfGoto)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return []Command{{Op: Goto, Name: c[2].Name}}, c[0].Segment == Constant
+		},
+	},
+	{
+		name:    "jump to next label",
+		pattern: []opSet{of(Goto), of(Label)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return c[1:], c[0].Name == c[1].Name
+		},
+	},
+	{
+		// The condition still has to come off the stack
+		name:    "jump to next label",
+		pattern: []opSet{of(IfGoto), of(Label)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return []Command{{Op: Pop, Segment: Temp, Index: 0}, c[1]}, c[0].Name == c[1].Name
+		},
+	},
+	{
+		// Nothing after a goto or return runs until the next label, and a function starts afresh
+		name:    "unreachable code",
+		pattern: []opSet{of(Goto, Return), anyOp &^ of(Label, Function)},
+		rewrite: func(c []Command) ([]Command, bool) {
+			return c[:1], true
+		},
+	},
+}
+
+// unusedLabel is the name of the rule that removes labels nothing jumps to
+const unusedLabel = "unused label"
+
+// OptStats counts what Optimize has done, over every call it was given to
+type OptStats struct {
+	// Before and After are the number of commands that went in and came out
+	Before int
+	After  int
+	// Rules maps the name of each rule to the number of times it was applied
+	Rules map[string]int
+}
+
+// count records that a rule was applied
+func (s *OptStats) count(name string) {
+	if s == nil {
+		return
+	}
+	if s.Rules == nil {
+		s.Rules = make(map[string]int)
+	}
+	s.Rules[name]++
+}
+
+// Write writes the statistics as a table, with a line for every rule
+func (s *OptStats) Write(w io.Writer) error {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if !seen[r.name] {
+			seen[r.name] = true
+			names = append(names, r.name)
+		}
+	}
+	names = append(names, unusedLabel)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%-24s %d\n", name, s.Rules[name]); err != nil {
+			return err
+		}
+	}
+	saved := 0.0
+	if s.Before > 0 {
+		saved = 100 * float64(s.Before-s.After) / float64(s.Before)
+	}
+	_, err := fmt.Fprintf(w, "%d commands before, %d after (%.1f%% fewer)\n", s.Before, s.After, saved)
+	return err
+}
+
+// Optimize applies peephole optimizations to commands until none of them match, returning the new commands
+// The program behaves the same way, apart from temp 0 being overwritten in places it would have been left alone
+// stats may be nil
+func Optimize(commands []Command, stats *OptStats) []Command {
+	if stats != nil {
+		stats.Before += len(commands)
+	}
+	commands = append([]Command{}, commands...)
+	for progress := true; progress; {
+		progress = false
+		for i := 0; i < len(commands); i++ {
+			for _, r := range rules {
+				if replaced, ok := r.apply(commands, i); ok {
+					commands = replaced
+					stats.count(r.name)
+					progress = true
+				}
+			}
+		}
+		if removed, ok := removeUnusedLabels(commands, stats); ok {
+			commands = removed
+			progress = true
+		}
+	}
+	if stats != nil {
+		stats.After += len(commands)
+	}
+	return commands
+}
+
+// apply rewrites the commands matching the rule at index i
+func (r rule) apply(commands []Command, i int) ([]Command, bool) {
+	if i+len(r.pattern) > len(commands) {
+		return nil, false
+	}
+	window := commands[i : i+len(r.pattern)]
+	for j, set := range r.pattern {
+		if !set.has(window[j].Op) {
+			return nil, false
+		}
+	}
+	replacement, ok := r.rewrite(window)
+	if !ok {
+		return nil, false
+	}
+	// Commands made up by the rewrite come from wherever the window starts
+	for j := range replacement {
+		if replacement[j].Pos == nil {
+			replacement[j].Pos = window[0].Pos
+		}
+	}
+	result := append([]Command{}, commands[:i]...)
+	result = append(result, replacement...)
+	return append(result, commands[i+len(r.pattern):]...), true
+}
+
+// removeUnusedLabels removes the labels that nothing in the same function jumps to
+func removeUnusedLabels(commands []Command, stats *OptStats) ([]Command, bool) {
+	// Labels belong to the function they are in
+	used := make(map[string]bool)
+	function := ""
+	for _, command := range commands {
+		switch command.Op {
+		case Function:
+			function = command.Name
+		case Goto, IfGoto:
+			used[function+"$"+command.Name] = true
+		}
+	}
+
+	result := make([]Command, 0, len(commands))
+	function = ""
+	for _, command := range commands {
+		if command.Op == Function {
+			function = command.Name
+		}
+		if command.Op == Label && !used[function+"$"+command.Name] {
+			stats.count(unusedLabel)
+			continue
+		}
+		result = append(result, command)
+	}
+	return result, len(result) < len(commands)
+}
@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+// inputs are stored in static 0 and 1 before each program runs
+var inputs = [][2]int16{{0, 0}, {0, -1}, {-1, 0}, {1, 2}, {2, 1}, {7, 7}, {-32768, 32767}, {5, -3}}
+
+// TestOptimize runs small programs before and after optimizing them, checking that every rule is used
+// and that the programs leave the same values in their static variables
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		rule string
+		code string
+	}{
+		{"push/pop same location", `
+			push static 0
+			pop static 0
+			push static 0
+			push static 1
+			add
+			pop static 2`},
+		{"double not", `
+			push static 0
+			not
+			not
+			pop static 2`},
+		{"double neg", `
+			push static 1
+			neg
+			neg
+			pop static 2`},
+		{"negated condition", `
+			push static 0
+			push static 1
+			lt
+			not
+			if-goto IF_TRUE0
+			goto IF_FALSE0
+			label IF_TRUE0
+			push constant 1
+			pop static 2
+			goto IF_END0
+			label IF_FALSE0
+			push constant 2
+			pop static 2
+			label IF_END0`},
+		{"constant condition", `
+			label WHILE_EXP0
+			push constant 0
+			not
+			not
+			if-goto WHILE_END0
+			push static 0
+			push constant 1
+			add
+			pop static 0
+			push static 0
+			push constant 10
+			gt
+			if-goto WHILE_END0
+			goto WHILE_EXP0
+			label WHILE_END0
+			push constant 0
+			if-goto SKIP
+			push constant 3
+			pop static 2
+			label SKIP`},
+		{"jump to next label", `
+			push static 0
+			if-goto IF_TRUE0
+			goto IF_FALSE0
+			label IF_TRUE0
+			label IF_FALSE0
+			push static 1
+			if-goto NEXT
+			label NEXT
+			push static 1
+			pop static 2`},
+		{"unreachable code", `
+			push static 0
+			if-goto IF_TRUE0
+			goto IF_FALSE0
+			label IF_TRUE0
+			push constant 4
+			pop static 2
+			push constant 0
+			return
+			goto IF_END0
+			label IF_FALSE0
+			push constant 5
+			pop static 2
+			label IF_END0`},
+		{"unused label", `
+			label UNUSED
+			push static 0
+			pop static 2`},
+	}
+
+	for _, test := range tests {
+		file, err := Parse("Sys", strings.NewReader("function Sys.init 0\n"+test.code+"\npush constant 0\nreturn\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats := &OptStats{}
+		optimized := &File{Name: "Sys", Commands: Optimize(file.Commands, stats)}
+		if stats.Rules[test.rule] == 0 {
+			t.Errorf("%s: rule not applied", test.rule)
+		}
+		if stats.After >= stats.Before || stats.After != len(optimized.Commands) {
+			t.Errorf("%s: went from %d commands to %d", test.rule, stats.Before, stats.After)
+		}
+
+		for _, input := range inputs {
+			before := runStatics(t, file, input)
+			after := runStatics(t, optimized, input)
+			if before != after {
+				t.Errorf("%s: with inputs %v the statics were %v before optimizing and %v after", test.rule, input, before, after)
+			}
+		}
+	}
+}
+
+// runStatics runs a program until it returns from Sys.init and gives back its first static variables
+func runStatics(t *testing.T, file *File, input [2]int16) [4]int16 {
+	m, err := NewMachine([]*File{file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	m.RAM[StaticBase], m.RAM[StaticBase+1] = input[0], input[1]
+	if err := m.Run(1000000); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted() {
+		t.Fatalf("program didn't halt:\n%v", file.Commands)
+	}
+	var statics [4]int16
+	copy(statics[:], m.RAM[StaticBase:])
+	return statics
+}
@@ -0,0 +1,71 @@
+package vm
+
+// Removed is a function that RemoveUnreachable took out of a program
+type Removed struct {
+	Name string
+	// Commands is the number of commands the function had, including its function command
+	Commands int
+}
+
+// RemoveUnreachable drops every function that can't be called, directly or indirectly, from one of roots
+// Roots that aren't defined are skipped, and calls to functions that aren't part of files are assumed to
+// never call back into them, which holds for the OS
+// The files themselves are left alone, new ones are returned along with the functions removed in program order
+func RemoveUnreachable(files []*File, roots ...string) ([]*File, []Removed) {
+	// Find which functions each function calls
+	calls := make(map[string][]string)
+	for _, file := range files {
+		function := ""
+		for _, command := range file.Commands {
+			switch command.Op {
+			case Function:
+				function = command.Name
+				calls[function] = nil
+			case Call:
+				calls[function] = append(calls[function], command.Name)
+			}
+		}
+	}
+
+	reached := make(map[string]bool)
+	queue := []string{}
+	for _, root := range roots {
+		if _, ok := calls[root]; ok && !reached[root] {
+			reached[root] = true
+			queue = append(queue, root)
+		}
+	}
+	for len(queue) > 0 {
+		function := queue[0]
+		queue = queue[1:]
+		for _, callee := range calls[function] {
+			if _, ok := calls[callee]; ok && !reached[callee] {
+				reached[callee] = true
+				queue = append(queue, callee)
+			}
+		}
+	}
+
+	result := make([]*File, len(files))
+	var removed []Removed
+	for i, file := range files {
+		kept := &File{Name: file.Name}
+		// Commands before the first function don't belong to any and are kept
+		keep := true
+		for _, command := range file.Commands {
+			if command.Op == Function {
+				keep = reached[command.Name]
+				if !keep {
+					removed = append(removed, Removed{Name: command.Name})
+				}
+			}
+			if keep {
+				kept.Commands = append(kept.Commands, command)
+			} else {
+				removed[len(removed)-1].Commands++
+			}
+		}
+		result[i] = kept
+	}
+	return result, removed
+}
@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRemoveUnreachable checks that functions are only kept when they can be called from a root
+func TestRemoveUnreachable(t *testing.T) {
+	main, err := Parse("Main", strings.NewReader(`
+		function Main.main 0
+		call Main.used 0
+		call Output.printInt 1
+		return
+		function Main.used 0
+		call Main.used 0
+		call Util.deep 0
+		return
+		function Main.unused 0
+		call Util.deep 0
+		call Util.dead 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	util, err := Parse("Util", strings.NewReader(`
+		function Util.deep 0
+		push constant 1
+		return
+		function Util.dead 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, removed := RemoveUnreachable([]*File{main, util}, "Sys.init", "Main.main")
+	want := []Removed{{Name: "Main.unused", Commands: 4}, {Name: "Util.dead", Commands: 2}}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed %v, want %v", removed, want)
+	}
+	if len(files[0].Commands) != 8 || len(files[1].Commands) != 3 || len(main.Commands) != 12 {
+		t.Errorf("kept %v and %v", files[0].Commands, files[1].Commands)
+	}
+}
+
+// TestRemoveUnreachableRoots checks how roots that aren't defined, cycles, and calls out of the program are
+// treated, and that commands before the first function are kept
+func TestRemoveUnreachableRoots(t *testing.T) {
+	sys, err := Parse("Sys", strings.NewReader(`
+		push constant 0
+		function Sys.init 0
+		call Sys.ping 0
+		call Keyboard.readLine 1
+		return
+		function Sys.ping 0
+		call Sys.pong 0
+		return
+		function Sys.pong 0
+		call Sys.ping 0
+		return
+		function Sys.lonely 0
+		call Sys.lonely 0
+		return`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		roots []string
+		want  []string
+	}{
+		{[]string{"Sys.init"}, []string{"Sys.lonely"}},
+		// Main.main isn't part of the program, so only Sys.init counts
+		{[]string{"Main.main", "Sys.init"}, []string{"Sys.lonely"}},
+		{[]string{"Sys.pong"}, []string{"Sys.init", "Sys.lonely"}},
+		{[]string{"Sys.lonely"}, []string{"Sys.init", "Sys.ping", "Sys.pong"}},
+		{nil, []string{"Sys.init", "Sys.ping", "Sys.pong", "Sys.lonely"}},
+	}
+	for _, test := range tests {
+		files, removed := RemoveUnreachable([]*File{sys}, test.roots...)
+		var names []string
+		for _, function := range removed {
+			names = append(names, function.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("roots %v removed %v, want %v", test.roots, names, test.want)
+		}
+		if first := files[0].Commands[0]; first.Op != Push {
+			t.Errorf("roots %v: the command before the first function became %v", test.roots, first)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package vm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Position is the place in a Jack file that a command was compiled from
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	// Subroutine is the full name of the subroutine the command belongs to, such as Board.draw
+	Subroutine string
+}
+
+// String returns the position the way compiler errors show it, such as Board.jack:57
+func (p *Position) String() string {
+	return p.File + ":" + strconv.Itoa(p.Line)
+}
+
+// Units that a source map counts in
+const (
+	// CommandUnit counts the commands of a .vm file
+	CommandUnit = "command"
+	// InstructionUnit counts the instructions of an .asm file, which is the same as their ROM address
+	InstructionUnit = "instruction"
+)
+
+// SourceMap links the commands or instructions of a generated file back to the Jack source
+type SourceMap struct {
+	Version int `json:"version"`
+	// File is the generated file the map describes
+	File     string    `json:"file"`
+	Unit     string    `json:"unit"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping covers the commands or instructions from Start up to but not including End, which all came from
+// the same place
+type Mapping struct {
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Subroutine string `json:"subroutine"`
+}
+
+// Positions returns the position of every command
+func Positions(commands []Command) []*Position {
+	positions := make([]*Position, len(commands))
+	for i, command := range commands {
+		positions[i] = command.Pos
+	}
+	return positions
+}
+
+// NewSourceMap builds the map for file from the position of each of its commands or instructions in order
+// Runs of the same position become a single mapping, and ones without a position are left out
+func NewSourceMap(file string, unit string, positions []*Position) *SourceMap {
+	m := &SourceMap{Version: 1, File: file, Unit: unit, Mappings: []Mapping{}}
+	for i, pos := range positions {
+		if pos == nil {
+			continue
+		}
+		if n := len(m.Mappings); n > 0 && m.Mappings[n-1].End == i && m.Mappings[n-1].position() == *pos {
+			m.Mappings[n-1].End++
+			continue
+		}
+		m.Mappings = append(m.Mappings, Mapping{
+			Start: i, End: i + 1, File: pos.File, Line: pos.Line, Column: pos.Column, Subroutine: pos.Subroutine,
+		})
+	}
+	return m
+}
+
+// position returns where the commands of a mapping came from
+func (m Mapping) position() Position {
+	return Position{File: m.File, Line: m.Line, Column: m.Column, Subroutine: m.Subroutine}
+}
+
+// Lookup returns where command or instruction i came from, or nil if the map doesn't cover it
+func (m *SourceMap) Lookup(i int) *Position {
+	j := sort.Search(len(m.Mappings), func(j int) bool { return m.Mappings[j].End > i })
+	if j == len(m.Mappings) || m.Mappings[j].Start > i {
+		return nil
+	}
+	pos := m.Mappings[j].position()
+	return &pos
+}
+
+// Write writes the map as JSON
+func (m *SourceMap) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
+
+// ReadSourceMap reads a map written by Write
+func ReadSourceMap(r io.Reader) (*SourceMap, error) {
+	m := &SourceMap{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("unsupported source map version %d", m.Version)
+	}
+	return m, nil
+}
+
+// WriteAnnotated writes commands in .vm format like Write, with a comment such as // Board.jack:57 before each
+// run of commands that came from a different line
+func WriteAnnotated(w io.Writer, commands []Command) error {
+	bw := bufio.NewWriter(w)
+	last := ""
+	for _, command := range commands {
+		if command.Pos != nil {
+			if at := command.Pos.String(); at != last {
+				if _, err := bw.WriteString("// " + at + "\n"); err != nil {
+					return err
+				}
+				last = at
+			}
+		}
+		if _, err := bw.WriteString(command.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// AnnotateAsm returns assembly lines with a comment such as // Board.jack:57 before each run of lines that
+// came from a different line, positions holds the position of each line
+func AnnotateAsm(lines []string, positions []*Position) []string {
+	out := make([]string, 0, len(lines))
+	last := ""
+	for i, line := range lines {
+		if pos := positions[i]; pos != nil {
+			if at := pos.String(); at != last {
+				out = append(out, "// "+at)
+				last = at
+			}
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// InstructionPositions turns the position of each line of assembly into the position of each instruction,
+// leaving out labels and comments, so they are indexed by ROM address
+func InstructionPositions(lines []string, positions []*Position) []*Position {
+	var out []*Position
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "(") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		out = append(out, positions[i])
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+package vm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSourceMap checks that runs of commands from the same place are merged, and that the map survives being
+// written and read back
+func TestSourceMap(t *testing.T) {
+	first := &Position{File: "Main.jack", Line: 3, Column: 5, Subroutine: "Main.main"}
+	second := &Position{File: "Main.jack", Line: 4, Column: 9, Subroutine: "Main.main"}
+	// Positions are compared by value, so a copy continues the run
+	again := *second
+	positions := []*Position{nil, first, first, second, &again, nil, first}
+
+	m := NewSourceMap("Main.vm", CommandUnit, positions)
+	want := []Mapping{
+		{Start: 1, End: 3, File: "Main.jack", Line: 3, Column: 5, Subroutine: "Main.main"},
+		{Start: 3, End: 5, File: "Main.jack", Line: 4, Column: 9, Subroutine: "Main.main"},
+		{Start: 6, End: 7, File: "Main.jack", Line: 3, Column: 5, Subroutine: "Main.main"},
+	}
+	if !reflect.DeepEqual(m.Mappings, want) {
+		t.Errorf("mappings %v, want %v", m.Mappings, want)
+	}
+	for i, pos := range positions {
+		got := m.Lookup(i)
+		if (got == nil) != (pos == nil) || got != nil && *got != *pos {
+			t.Errorf("Lookup(%d) = %v, want %v", i, got, pos)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSourceMap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("read back %v, want %v", read, m)
+	}
+}
+
+// TestWriteAnnotated checks that a comment goes before each run of commands from another line,
+// and that the result still parses into the same commands
+func TestWriteAnnotated(t *testing.T) {
+	first := &Position{File: "Main.jack", Line: 3, Column: 5, Subroutine: "Main.main"}
+	second := &Position{File: "Main.jack", Line: 4, Column: 9, Subroutine: "Main.main"}
+	commands := []Command{
+		{Op: Function, Name: "Main.main", Pos: first},
+		{Op: Push, Segment: Constant, Index: 1, Pos: second},
+		{Op: Pop, Segment: Temp, Pos: second},
+		{Op: Push, Segment: Constant},
+		{Op: Return, Pos: second},
+	}
+	var buf bytes.Buffer
+	if err := WriteAnnotated(&buf, commands); err != nil {
+		t.Fatal(err)
+	}
+	want := "// Main.jack:3\nfunction Main.main 0\n// Main.jack:4\npush constant 1\npop temp 0\npush constant 0\nreturn\n"
+	if buf.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	file, err := Parse("Main", strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, command := range file.Commands {
+		command.Pos = commands[i].Pos
+		if command != commands[i] {
+			t.Errorf("command %d parsed as %v, want %v", i, command, commands[i])
+		}
+	}
+}
+
+// TestOptimizePositions checks that commands the peephole optimizer makes up come from the place of the
+// commands they replace
+func TestOptimizePositions(t *testing.T) {
+	cond := &Position{File: "Main.jack", Line: 4, Subroutine: "Main.f"}
+	body := &Position{File: "Main.jack", Line: 5, Subroutine: "Main.f"}
+	commands := []Command{
+		{Op: Function, Name: "Main.f", Index: 2, Pos: cond},
+		{Op: Push, Segment: Local, Pos: cond},
+		{Op: Push, Segment: Local, Index: 1, Pos: cond},
+		{Op: Lt, Pos: cond},
+		{Op: Not, Pos: cond},
+		{Op: IfGoto, Name: "ELSE", Pos: cond},
+		{Op: Goto, Name: "END", Pos: cond},
+		{Op: Label, Name: "ELSE", Pos: cond},
+		{Op: Push, Segment: Constant, Index: 7, Pos: body},
+		{Op: Pop, Segment: Local, Pos: body},
+		{Op: Label, Name: "END", Pos: cond},
+		{Op: Push, Segment: Constant, Pos: body},
+		{Op: Return, Pos: body},
+	}
+	jumps := 0
+	for _, command := range Optimize(commands, nil) {
+		if command.Pos == nil {
+			t.Errorf("%s has no position", command)
+		}
+		if command.Op == IfGoto {
+			jumps++
+			if command.Name != "END" || command.Pos != cond {
+				t.Errorf("%s comes from %v, want if-goto END from %s", command, command.Pos, cond)
+			}
+		}
+	}
+	if jumps != 1 {
+		t.Errorf("%d if-gotos after optimizing, want the negated condition turned into 1", jumps)
+	}
+}
+
+// TestTranslatePositions checks that every line of assembly translated from a command comes from the
+// command's position, and that the positions line up with the instructions once labels are left out
+func TestTranslatePositions(t *testing.T) {
+	first := &Position{File: "Sys.jack", Line: 2, Subroutine: "Sys.init"}
+	second := &Position{File: "Sys.jack", Line: 3, Subroutine: "Sys.init"}
+	file := &File{Name: "Sys", Commands: []Command{
+		{Op: Function, Name: "Sys.init", Index: 1, Pos: first},
+		{Op: Push, Segment: Constant, Index: 5, Pos: second},
+		{Op: Push, Segment: Constant, Index: 6, Pos: second},
+		{Op: Lt, Pos: second},
+		{Op: Pop, Segment: Local, Pos: second},
+		{Op: Push, Segment: Constant, Pos: second},
+		{Op: Return, Pos: second},
+	}}
+	asm, positions := Translate([]*File{file})
+	if len(positions) != len(asm) {
+		t.Fatalf("%d positions for %d lines", len(positions), len(asm))
+	}
+	start := -1
+	for i, line := range asm {
+		if line == "(Sys.init)" {
+			start = i
+		}
+		if start == -1 && positions[i] != nil {
+			t.Errorf("shared line %d, %s, comes from %s", i, line, positions[i])
+		}
+		if start != -1 && positions[i] != first && positions[i] != second {
+			t.Errorf("line %d, %s, comes from %v", i, line, positions[i])
+		}
+	}
+	if start == -1 || positions[start] != first {
+		t.Fatalf("Sys.init doesn't start at its function command")
+	}
+
+	instructions := InstructionPositions(asm, positions)
+	labels := 0
+	for _, line := range asm {
+		if strings.HasPrefix(line, "(") {
+			labels++
+		}
+	}
+	if len(instructions) != len(asm)-labels {
+		t.Errorf("%d instruction positions for %d instructions", len(instructions), len(asm)-labels)
+	}
+
+	annotated := AnnotateAsm(asm, positions)
+	comments := 0
+	for _, line := range annotated {
+		if strings.HasPrefix(line, "// Sys.jack:") {
+			comments++
+		}
+	}
+	if comments != 2 || len(annotated) != len(asm)+2 {
+		t.Errorf("%d comments in %d lines, want 2 in %d", comments, len(annotated), len(asm)+2)
+	}
+}
@@ -0,0 +1,205 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+)
+
+// translator turns VM commands into Hack assembly
+type translator struct {
+	out []string
+	// positions holds where each line of out came from, and pos where the lines being emitted come from
+	positions []*Position
+	pos       *Position
+	file      string
+	function  string
+	returns   int
+}
+
+// segmentBases maps the segments that are reached through a pointer to the register holding it
+var segmentBases = map[Segment]string{
+	Local:    "LCL",
+	Argument: "ARG",
+	This:     "THIS",
+	That:     "THAT",
+}
+
+// Translate translates a linked program into Hack assembly that boots by calling Sys.init, returning the lines
+// of assembly along with the position of the command each line came from, which is nil for the shared code
+// Calls, returns, and comparisons jump to routines shared by the whole program, which keeps the program small
+// at the cost of a few extra instructions each time, and calls to Sys.halt jump straight to the loop the
+// program ends in, the same way Machine stops there
+func Translate(files []*File) ([]string, []*Position) {
+	t := &translator{}
+	t.emit("@256", "D=A", "@SP", "M=D")
+	t.emit("@R13", "M=0", "@Sys.init", "D=A", "@R14", "M=D", "@$HALT", "D=A", "@$CALL", "0;JMP")
+	t.emit("($HALT)", "@$HALT", "0;JMP")
+	t.routines()
+
+	for _, file := range files {
+		t.file = file.Name
+		t.function = ""
+		for _, command := range file.Commands {
+			t.pos = command.Pos
+			t.command(command)
+		}
+	}
+	return t.out, t.positions
+}
+
+// emit adds lines of assembly to the output
+func (t *translator) emit(lines ...string) {
+	t.out = append(t.out, lines...)
+	for range lines {
+		t.positions = append(t.positions, t.pos)
+	}
+}
+
+// pushD pushes the D register
+func (t *translator) pushD() {
+	t.emit("@SP", "AM=M+1", "A=A-1", "M=D")
+}
+
+// popD pops into the D register, leaving A pointing at the slot it came from
+func (t *translator) popD() {
+	t.emit("@SP", "AM=M-1", "D=M")
+}
+
+// routines writes the code shared by every call, return, and comparison
+// $CALL expects the number of arguments in R13, the function in R14, and the return address in D
+// $RETURN is jumped to, and $EQ, $LT, and $GT expect the return address in D and replace the top two
+// values of the stack with the result
+func (t *translator) routines() {
+	t.emit("($CALL)")
+	t.pushD()
+	for _, register := range []string{"LCL", "ARG", "THIS", "THAT"} {
+		t.emit("@"+register, "D=M")
+		t.pushD()
+	}
+	t.emit("@R13", "D=M", "@5", "D=D+A", "@SP", "D=M-D", "@ARG", "M=D")
+	t.emit("@SP", "D=M", "@LCL", "M=D")
+	t.emit("@R14", "A=M", "0;JMP")
+
+	t.emit("($RETURN)")
+	t.emit("@LCL", "D=M", "@R13", "M=D")
+	t.emit("@5", "A=D-A", "D=M", "@R14", "M=D")
+	t.popD()
+	t.emit("@ARG", "A=M", "M=D")
+	t.emit("@ARG", "D=M+1", "@SP", "M=D")
+	for i, register := range []string{"THAT", "THIS", "ARG", "LCL"} {
+		t.emit("@R13", "D=M", "@"+strconv.Itoa(i+1), "A=D-A", "D=M", "@"+register, "M=D")
+	}
+	t.emit("@R14", "A=M", "0;JMP")
+
+	// Comparisons have to cope with the subtraction overflowing, so values of different signs are
+	// decided by their signs alone
+	t.emit("($EQ)", "@R15", "M=D")
+	t.popD()
+	t.emit("A=A-1", "D=M-D", "@$TRUE", "D;JEQ", "@$FALSE", "0;JMP")
+	t.emit("($GT)", "@R15", "M=D")
+	t.popD()
+	t.emit("@R14", "M=D", "@SP", "A=M-1", "D=M", "@R13", "M=D", "@$LT$COMPARE", "0;JMP")
+	t.emit("($LT)", "@R15", "M=D")
+	t.popD()
+	t.emit("@R13", "M=D", "@SP", "A=M-1", "D=M", "@R14", "M=D")
+	// Now R14 < R13 decides the result
+	t.emit("($LT$COMPARE)")
+	t.emit("@R14", "D=M", "@$LT$NEGATIVE", "D;JLT")
+	t.emit("@R13", "D=M", "@$FALSE", "D;JLT", "@$LT$SAME", "0;JMP")
+	t.emit("($LT$NEGATIVE)", "@R13", "D=M", "@$TRUE", "D;JGE")
+	t.emit("($LT$SAME)", "@R13", "D=M", "@R14", "D=M-D", "@$TRUE", "D;JLT")
+	t.emit("($FALSE)", "@SP", "A=M-1", "M=0", "@R15", "A=M", "0;JMP")
+	t.emit("($TRUE)", "@SP", "A=M-1", "M=-1", "@R15", "A=M", "0;JMP")
+}
+
+// address points A at a segment entry without touching D
+// Segments reached through a pointer are only done this way for indexes up to 3, after that it costs more
+// than going through D
+func (t *translator) address(segment Segment, index int) {
+	switch segment {
+	case Static:
+		t.emit("@" + t.file + "." + strconv.Itoa(index))
+	case Temp:
+		t.emit("@R" + strconv.Itoa(5+index))
+	case Pointer:
+		t.emit("@R" + strconv.Itoa(3+index))
+	default:
+		t.emit("@"+segmentBases[segment], "A=M")
+		for i := 0; i < index; i++ {
+			t.emit("A=A+1")
+		}
+	}
+}
+
+// label returns the name a label has in the assembly, labels belong to the function they are in
+func (t *translator) label(name string) string {
+	return t.function + "$" + name
+}
+
+// command translates a single command
+func (t *translator) command(c Command) {
+	switch c.Op {
+	case Add, Sub, And, Or:
+		comp := map[Op]string{Add: "M=D+M", Sub: "M=M-D", And: "M=D&M", Or: "M=D|M"}[c.Op]
+		t.popD()
+		t.emit("A=A-1", comp)
+	case Neg:
+		t.emit("@SP", "A=M-1", "M=-M")
+	case Not:
+		t.emit("@SP", "A=M-1", "M=!M")
+	case Eq, Gt, Lt:
+		ret := t.returnLabel()
+		t.emit("@"+ret, "D=A", "@$"+strings.ToUpper(OpStrMap[c.Op]), "0;JMP", "("+ret+")")
+	case Push:
+		switch {
+		case c.Segment == Constant:
+			t.emit("@"+strconv.Itoa(c.Index), "D=A")
+		case segmentBases[c.Segment] != "" && c.Index > 3:
+			t.emit("@"+strconv.Itoa(c.Index), "D=A", "@"+segmentBases[c.Segment], "A=D+M", "D=M")
+		default:
+			t.address(c.Segment, c.Index)
+			t.emit("D=M")
+		}
+		t.pushD()
+	case Pop:
+		if segmentBases[c.Segment] != "" && c.Index > 3 {
+			t.emit("@"+strconv.Itoa(c.Index), "D=A", "@"+segmentBases[c.Segment], "D=D+M", "@R13", "M=D")
+			t.popD()
+			t.emit("@R13", "A=M", "M=D")
+			return
+		}
+		t.popD()
+		t.address(c.Segment, c.Index)
+		t.emit("M=D")
+	case Label:
+		t.emit("(" + t.label(c.Name) + ")")
+	case Goto:
+		t.emit("@"+t.label(c.Name), "0;JMP")
+	case IfGoto:
+		t.popD()
+		t.emit("@"+t.label(c.Name), "D;JNE")
+	case Function:
+		t.function = c.Name
+		t.returns = 0
+		t.emit("(" + c.Name + ")")
+		for i := 0; i < c.Index; i++ {
+			t.emit("@SP", "AM=M+1", "A=A-1", "M=0")
+		}
+	case Call:
+		if c.Name == "Sys.halt" {
+			t.emit("@$HALT", "0;JMP")
+			return
+		}
+		ret := t.returnLabel()
+		t.emit("@"+strconv.Itoa(c.Index), "D=A", "@R13", "M=D", "@"+c.Name, "D=A", "@R14", "M=D")
+		t.emit("@"+ret, "D=A", "@$CALL", "0;JMP", "("+ret+")")
+	case Return:
+		t.emit("@$RETURN", "0;JMP")
+	}
+}
+
+// returnLabel makes up a label to come back to after jumping to a shared routine
+func (t *translator) returnLabel() string {
+	t.returns++
+	return t.function + "$ret." + strconv.Itoa(t.returns)
+}
@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"jackcompiler/pkg/hack"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestTranslate checks comparisons that overflow when subtracted and calls that have to restore the caller's
+// segments, running the translated program on the Hack CPU
+func TestTranslate(t *testing.T) {
+	pairs := [][2]int16{{-32767, 32767}, {32767, -32767}, {-32768, 1}, {1, -32768}, {-2, 32767}, {20000, -20000}, {5, 5}, {-1, 0}}
+
+	// Inputs are read through this from 7000 and results written through that from 8000
+	var code strings.Builder
+	code.WriteString("function Sys.init 1\npush constant 7000\npop pointer 0\npush constant 8000\npop pointer 1\n")
+	for i := range pairs {
+		for k, op := range []string{"lt", "gt", "eq"} {
+			code.WriteString("push this " + strconv.Itoa(2*i) + "\npush this " + strconv.Itoa(2*i+1) + "\n" + op + "\n")
+			code.WriteString("pop that " + strconv.Itoa(3*i+k) + "\n")
+		}
+	}
+	code.WriteString(`push constant 10
+call Sys.sum 1
+pop that 30
+push constant 1
+push constant 2
+push constant 3
+call Sys.args 3
+pop that 31
+call Sys.dirty 0
+pop temp 0
+call Sys.fresh 0
+pop that 32
+push constant 0
+return
+function Sys.sum 0
+push argument 0
+push constant 0
+eq
+if-goto BASE
+push argument 0
+push argument 0
+push constant 1
+sub
+call Sys.sum 1
+add
+return
+label BASE
+push constant 0
+return
+function Sys.args 0
+push argument 0
+push argument 1
+sub
+push argument 2
+sub
+return
+function Sys.dirty 3
+push constant 111
+pop local 0
+push constant 222
+pop local 1
+push constant 9
+pop pointer 0
+push constant 9
+pop pointer 1
+push local 0
+push local 1
+add
+return
+function Sys.fresh 2
+push local 0
+push local 1
+or
+return
+`)
+	file, err := Parse("Sys", strings.NewReader(code.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, positions := Translate([]*File{file})
+	if len(positions) != len(asm) {
+		t.Fatalf("%d positions for %d lines of assembly", len(positions), len(asm))
+	}
+	program, err := hack.Assemble("Sys.asm", strings.NewReader(strings.Join(asm, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := hack.NewCPU(program)
+	for i, pair := range pairs {
+		cpu.RAM[7000+2*i], cpu.RAM[7000+2*i+1] = pair[0], pair[1]
+	}
+	for !cpu.Looping() && cpu.Steps() < 1000000 {
+		cpu.Step()
+	}
+	if !cpu.Looping() {
+		t.Fatalf("still running after %d instructions", cpu.Steps())
+	}
+
+	truth := map[bool]int16{false: 0, true: -1}
+	for i, pair := range pairs {
+		want := []int16{truth[pair[0] < pair[1]], truth[pair[0] > pair[1]], truth[pair[0] == pair[1]]}
+		for k, op := range []string{"lt", "gt", "eq"} {
+			if got := cpu.RAM[8000+3*i+k]; got != want[k] {
+				t.Errorf("%d %s %d = %d, want %d", pair[0], op, pair[1], got, want[k])
+			}
+		}
+	}
+	// dirty moves this and that, so the results after it only land if they were restored
+	want := map[int]int16{30: 55, 31: -4, 32: 0}
+	for addr, value := range want {
+		if got := cpu.RAM[8000+addr]; got != value {
+			t.Errorf("RAM[%d] = %d, want %d", 8000+addr, got, value)
+		}
+	}
+	// Sys.init was called with no arguments, so its return value is all that is left on the stack
+	if sp := cpu.RAM[SP]; sp != 257 {
+		t.Errorf("SP = %d after halting, want 257", sp)
+	}
+}
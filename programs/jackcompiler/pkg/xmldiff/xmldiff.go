@@ -0,0 +1,184 @@
+// Package xmldiff compares the parse tree and token xml written by the analyzer against reference output,
+// ignoring whitespace
+package xmldiff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Element is an xml element, either holding text such as <keyword> class </keyword> or other elements
+type Element struct {
+	Tag      string
+	Text     string
+	Children []*Element
+	// Line is where the element starts in its file
+	Line int
+}
+
+// ParseFile reads the xml file at path
+func ParseFile(path string) (*Element, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(path, f)
+}
+
+// Parse reads the root element of an xml document
+// name is only used in error messages
+func Parse(name string, r io.Reader) (*Element, error) {
+	d := xml.NewDecoder(r)
+	// The reference tools don't escape string constants, so be forgiving
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	var stack []*Element
+	var root *Element
+	for {
+		line, _ := d.InputPos()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			el := &Element{Tag: t.Name.Local, Line: line}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, el)
+			} else if root == nil {
+				root = el
+			} else {
+				return nil, fmt.Errorf("%s:%d: more than one root element", name, line)
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%s:%d: unexpected </%s>", name, line, t.Name.Local)
+			}
+			el := stack[len(stack)-1]
+			el.Text = strings.TrimSpace(el.Text)
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("%s: no elements", name)
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%s: <%s> is never closed", name, stack[len(stack)-1].Tag)
+	}
+	return root, nil
+}
+
+// Difference is the first place two documents disagree
+// Got or Want is nil when an element is missing from that side
+type Difference struct {
+	Path string
+	Got  *Element
+	Want *Element
+	// GotLine and WantLine are where the difference is in each file, even when one side is missing
+	GotLine  int
+	WantLine int
+	Msg      string
+}
+
+func (d *Difference) Error() string {
+	return d.Path + ": " + d.Msg
+}
+
+// Compare walks both documents in order and returns the first difference, or nil if they match
+// Text is compared with surrounding whitespace removed
+func Compare(got *Element, want *Element) *Difference {
+	return compare(got, want, got.Tag)
+}
+
+// compare checks two elements found at the same path
+func compare(got *Element, want *Element, path string) *Difference {
+	diff := &Difference{Path: path, Got: got, Want: want, GotLine: got.Line, WantLine: want.Line}
+	if got.Tag != want.Tag {
+		diff.Msg = fmt.Sprintf("got <%s>, want <%s>", got.Tag, want.Tag)
+		return diff
+	}
+	if got.Text != want.Text {
+		diff.Msg = fmt.Sprintf("got %s, want %s", describe(got), describe(want))
+		return diff
+	}
+
+	// Siblings with the same tag are numbered from 1, but only when there is more than one of them
+	gotCounts, wantCounts := countTags(got.Children), countTags(want.Children)
+	seen := make(map[string]int)
+	for i := 0; i < len(got.Children) || i < len(want.Children); i++ {
+		var g, w *Element
+		if i < len(got.Children) {
+			g = got.Children[i]
+		}
+		if i < len(want.Children) {
+			w = want.Children[i]
+		}
+
+		var tag string
+		if g != nil {
+			tag = g.Tag
+		} else {
+			tag = w.Tag
+		}
+		seen[tag]++
+		step := path + "/" + tag
+		if gotCounts[tag] > 1 || wantCounts[tag] > 1 {
+			step += "[" + strconv.Itoa(seen[tag]) + "]"
+		}
+
+		switch {
+		case g == nil:
+			return &Difference{Path: step, Want: w, GotLine: lastLine(got), WantLine: w.Line,
+				Msg: fmt.Sprintf("missing %s", describe(w))}
+		case w == nil:
+			return &Difference{Path: step, Got: g, GotLine: g.Line, WantLine: lastLine(want),
+				Msg: fmt.Sprintf("unexpected %s", describe(g))}
+		}
+		if diff := compare(g, w, step); diff != nil {
+			return diff
+		}
+	}
+	return nil
+}
+
+// countTags counts how many elements use each tag
+func countTags(elements []*Element) map[string]int {
+	counts := make(map[string]int)
+	for _, el := range elements {
+		counts[el.Tag]++
+	}
+	return counts
+}
+
+// lastLine returns the line of the last element inside el
+func lastLine(el *Element) int {
+	for len(el.Children) > 0 {
+		el = el.Children[len(el.Children)-1]
+	}
+	return el.Line
+}
+
+// describe returns a short version of an element for messages
+func describe(el *Element) string {
+	if len(el.Children) == 0 && el.Text != "" {
+		return "<" + el.Tag + "> " + el.Text + " </" + el.Tag + ">"
+	}
+	return "<" + el.Tag + ">"
+}
@@ -0,0 +1,126 @@
+package xmldiff
+
+import (
+	"strings"
+	"testing"
+)
+
+// tree is the reference document the others are compared against
+const tree = `<class>
+  <keyword> class </keyword>
+  <identifier> Main </identifier>
+  <statements>
+    <letStatement>
+      <keyword> let </keyword>
+      <identifier> x </identifier>
+    </letStatement>
+    <letStatement>
+      <keyword> let </keyword>
+      <identifier> y </identifier>
+    </letStatement>
+  </statements>
+</class>
+`
+
+// secondLet is the second let statement of tree
+const secondLet = `    <letStatement>
+      <keyword> let </keyword>
+      <identifier> y </identifier>
+    </letStatement>
+`
+
+// TestCompare checks the path, message and lines of the first difference between small trees
+func TestCompare(t *testing.T) {
+	withoutSecond := strings.Replace(tree, secondLet, "", 1)
+	tests := []struct {
+		name      string
+		got, want string
+		// path is empty when the documents match
+		path     string
+		msg      string
+		gotLine  int
+		wantLine int
+	}{
+		{
+			name: "whitespace",
+			got:  strings.NewReplacer("<identifier> Main </identifier>", "<identifier>Main</identifier>", "  <", "\t<").Replace(tree),
+			want: tree,
+		},
+		{
+			name:     "token",
+			got:      strings.Replace(tree, "<identifier> y </identifier>", "<identifier> z </identifier>", 1),
+			want:     tree,
+			path:     "class/statements/letStatement[2]/identifier",
+			msg:      "got <identifier> z </identifier>, want <identifier> y </identifier>",
+			gotLine:  11,
+			wantLine: 11,
+		},
+		{
+			name:     "tag",
+			got:      strings.Replace(tree, secondLet, strings.ReplaceAll(secondLet, "letStatement", "doStatement"), 1),
+			want:     tree,
+			path:     "class/statements/doStatement",
+			msg:      "got <doStatement>, want <letStatement>",
+			gotLine:  9,
+			wantLine: 9,
+		},
+		{
+			name: "missing",
+			got:  withoutSecond,
+			want: tree,
+			path: "class/statements/letStatement[2]",
+			msg:  "missing <letStatement>",
+			// The last thing before where it should have been
+			gotLine:  7,
+			wantLine: 9,
+		},
+		{
+			name:     "unexpected",
+			got:      tree,
+			want:     withoutSecond,
+			path:     "class/statements/letStatement[2]",
+			msg:      "unexpected <letStatement>",
+			gotLine:  9,
+			wantLine: 7,
+		},
+	}
+	for _, test := range tests {
+		got, err := Parse("got.xml", strings.NewReader(test.got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := Parse("want.xml", strings.NewReader(test.want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff := Compare(got, want)
+		switch {
+		case diff == nil && test.path == "":
+		case diff == nil:
+			t.Errorf("%s: no difference found, want %s: %s", test.name, test.path, test.msg)
+		case test.path == "":
+			t.Errorf("%s: got %v, want no difference", test.name, diff)
+		case diff.Path != test.path || diff.Msg != test.msg || diff.GotLine != test.gotLine || diff.WantLine != test.wantLine:
+			t.Errorf("%s: got %v at lines %d and %d, want %s: %s at lines %d and %d", test.name,
+				diff, diff.GotLine, diff.WantLine, test.path, test.msg, test.gotLine, test.wantLine)
+		}
+	}
+}
+
+// TestParseErrors checks that broken documents are reported rather than compared
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		doc string
+		err string
+	}{
+		{"<class>\n  <keyword> class </keyword>\n", "bad.xml: XML syntax error on line 3: unexpected EOF"},
+		{"<class></class>\n<class></class>\n", "bad.xml:2: more than one root element"},
+		{"  \n", "bad.xml: no elements"},
+	}
+	for _, test := range tests {
+		_, err := Parse("bad.xml", strings.NewReader(test.doc))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %s", test.doc, err, test.err)
+		}
+	}
+}